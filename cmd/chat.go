@@ -0,0 +1,654 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/spf13/cobra"
+	"habibi-go/internal/config"
+	"habibi-go/internal/models"
+)
+
+// chatCommands lists the keyboard commands of the chat client
+const chatCommands = `Commands:
+
+  /stop               stop the running turn (Ctrl-C does the same while a turn runs)
+  /switch <session>   switch to another session
+  /sessions           list sessions
+  /history [n]        show the last n messages (default 20)
+  /allow, /deny       answer the oldest pending tool permission prompt
+  /quit               leave (Ctrl-D does the same)`
+
+var chatCmd = &cobra.Command{
+	Use:   "chat [session]",
+	Short: "Chat with a session of a running server from the terminal",
+	Long: `Chat with a session of a running server from the terminal.
+
+The session is given by ID, name, or project/name. Type a message and press enter
+to send it. ` + chatCommands,
+	Args: cobra.ExactArgs(1),
+	Run:  runChat,
+}
+
+var (
+	chatServer   string
+	chatUser     string
+	chatPassword string
+)
+
+func init() {
+	chatCmd.Flags().StringVar(&chatServer, "server", "", "server URL (default from server.host and server.port)")
+	chatCmd.Flags().StringVar(&chatUser, "user", "", "basic auth user (default from server.auth)")
+	chatCmd.Flags().StringVar(&chatPassword, "password", "", "basic auth password (default from server.auth)")
+}
+
+func runChat(cmd *cobra.Command, args []string) {
+	client, err := newChatClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.conn.Close()
+
+	if err := client.switchSession(args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	client.printf("Type a message to send it, /help for commands.\n")
+
+	go client.readEvents()
+	client.readInput(os.Stdin)
+	client.closing.Store(true)
+}
+
+// chatClient talks to a running server over its REST API and WebSocket
+type chatClient struct {
+	baseURL  *url.URL
+	user     string
+	password string
+	http     *http.Client
+	conn     *websocket.Conn
+
+	closing   atomic.Bool
+	mu        sync.Mutex
+	writeMu   sync.Mutex
+	session   *models.Session
+	streaming bool
+	// Stream IDs whose text was printed chunk by chunk
+	streamed map[string]bool
+	// Pending permission prompts of the current session, oldest first
+	permissions []string
+	lastSent    string
+}
+
+func newChatClient() (*chatClient, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	server := chatServer
+	if server == "" {
+		host := cfg.Server.Host
+		if host == "" || host == "0.0.0.0" {
+			host = "127.0.0.1"
+		}
+		server = fmt.Sprintf("http://%s:%d", host, cfg.Server.Port)
+	}
+	baseURL, err := url.Parse(strings.TrimRight(server, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL: %w", err)
+	}
+
+	client := &chatClient{
+		baseURL:  baseURL,
+		user:     chatUser,
+		password: chatPassword,
+		http:     &http.Client{Timeout: 30 * time.Second},
+		streamed: make(map[string]bool),
+	}
+	if client.user == "" && cfg.Server.Auth.Enabled {
+		client.user, client.password = cfg.Server.Auth.Username, cfg.Server.Auth.Password
+	}
+
+	wsURL := *baseURL
+	wsURL.Scheme = "ws"
+	if baseURL.Scheme == "https" {
+		wsURL.Scheme = "wss"
+	}
+	wsURL.Path = baseURL.Path + "/api/ws"
+
+	header := http.Header{}
+	if client.user != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(client.user + ":" + client.password))
+		header.Set("Authorization", "Basic "+credentials)
+	}
+	client.conn, _, err = websocket.DefaultDialer.Dial(wsURL.String(), header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", wsURL.String(), err)
+	}
+
+	return client, nil
+}
+
+// api calls the server's REST API and decodes the data of its response into out
+func (c *chatClient) api(method, path string, out interface{}) error {
+	request, err := http.NewRequest(method, c.baseURL.String()+"/api"+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.user != "" {
+		request.SetBasicAuth(c.user, c.password)
+	}
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to reach server: %w", err)
+	}
+	defer response.Body.Close()
+
+	var body struct {
+		Data  json.RawMessage `json:"data"`
+		Error string          `json:"error"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", path, err)
+	}
+	if response.StatusCode >= 400 {
+		if body.Error == "" {
+			body.Error = response.Status
+		}
+		return fmt.Errorf("%s", body.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body.Data, out)
+}
+
+// send writes one message to the WebSocket
+func (c *chatClient) send(msgType string, data map[string]interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteJSON(map[string]interface{}{
+		"type": msgType,
+		"data": data,
+	})
+}
+
+func (c *chatClient) printf(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stdout, format, a...)
+}
+
+// findSession resolves an ID, a name or project/name to a session
+func (c *chatClient) findSession(ref string) (*models.Session, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		session := &models.Session{}
+		if err := c.api(http.MethodGet, fmt.Sprintf("/sessions/%d", id), session); err != nil {
+			return nil, err
+		}
+		return session, nil
+	}
+
+	projectName, name := "", ref
+	if i := strings.Index(ref, "/"); i >= 0 {
+		projectName, name = ref[:i], ref[i+1:]
+	}
+
+	sessions, projects, err := c.listSessions()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*models.Session
+	for _, session := range sessions {
+		if session.Name == name && (projectName == "" || projects[session.ProjectID] == projectName) {
+			matches = append(matches, session)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("session %q not found", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("several projects have a session named %q; use project/name or the session ID", name)
+	}
+}
+
+// listSessions returns all sessions and the names of their projects
+func (c *chatClient) listSessions() ([]*models.Session, map[int]string, error) {
+	var sessions []*models.Session
+	if err := c.api(http.MethodGet, "/sessions", &sessions); err != nil {
+		return nil, nil, err
+	}
+
+	var projects []*models.Project
+	if err := c.api(http.MethodGet, "/projects", &projects); err != nil {
+		return nil, nil, err
+	}
+	names := make(map[int]string)
+	for _, project := range projects {
+		names[project.ID] = project.Name
+	}
+
+	return sessions, names, nil
+}
+
+// switchSession makes a session the one messages go to and shows its recent history
+func (c *chatClient) switchSession(ref string) error {
+	session, err := c.findSession(ref)
+	if err != nil {
+		return err
+	}
+
+	// Permission prompts only reach the viewers of a session
+	c.mu.Lock()
+	previous := c.session
+	c.mu.Unlock()
+	if previous != nil && previous.ID != session.ID {
+		c.send("session_leave", map[string]interface{}{"session_id": previous.ID})
+	}
+	if err := c.send("session_view", map[string]interface{}{"session_id": session.ID}); err != nil {
+		return err
+	}
+
+	var pending []struct {
+		ID string `json:"id"`
+	}
+	c.api(http.MethodGet, fmt.Sprintf("/sessions/%d/permissions", session.ID), &pending)
+
+	c.mu.Lock()
+	c.session = session
+	c.streaming = session.ActivityStatus == string(models.ActivityStatusStreaming)
+	c.streamed = make(map[string]bool)
+	c.permissions = nil
+	for _, request := range pending {
+		c.permissions = append(c.permissions, request.ID)
+	}
+	c.mu.Unlock()
+
+	c.printf("--- %s (%d) on %s\n", session.Name, session.ID, session.BranchName)
+	return c.showHistory(20)
+}
+
+// showHistory prints the last messages of the current session
+func (c *chatClient) showHistory(limit int) error {
+	c.mu.Lock()
+	session := c.session
+	c.mu.Unlock()
+
+	var messages []*models.ChatMessage
+	if err := c.api(http.MethodGet, fmt.Sprintf("/sessions/%d/chat", session.ID), &messages); err != nil {
+		return err
+	}
+	if len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+
+	for _, msg := range messages {
+		c.printMessage(msg)
+	}
+	return nil
+}
+
+// printMessage renders a stored chat message
+func (c *chatClient) printMessage(msg *models.ChatMessage) {
+	indent := ""
+	if msg.ParentToolUseID != "" {
+		indent = "  | "
+	}
+
+	switch msg.Role {
+	case "user":
+		c.printf("%s> %s\n", indent, msg.Content)
+	case "assistant":
+		switch msg.ContentType {
+		case models.ContentTypeThinking:
+			c.printf("%s(thinking)\n", indent)
+		case models.ContentTypeImage:
+			c.printf("%s(image)\n", indent)
+		default:
+			c.printf("%s%s\n", indent, msg.Content)
+		}
+	case "tool_use":
+		c.printf("%s[%s] %s\n", indent, msg.ToolName, toolSummary(msg.ToolInput))
+	case "tool_result":
+		c.printf("%s  -> %s\n", indent, toolResultSummary(msg.ToolContent))
+	case "system":
+		c.printf("%s[habibi] %s\n", indent, msg.Content)
+	}
+}
+
+// readInput sends typed lines and runs slash commands until stdin closes or /quit
+func (c *chatClient) readInput(input io.Reader) {
+	// Ctrl-C stops a running turn; when nothing runs it leaves
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		for range signals {
+			c.mu.Lock()
+			streaming := c.streaming
+			c.mu.Unlock()
+			if !streaming {
+				c.printf("\n")
+				os.Exit(0)
+			}
+			c.stop()
+		}
+	}()
+
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "/") {
+			c.sendPrompt(line)
+			continue
+		}
+
+		command, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		switch command {
+		case "/quit", "/exit", "/q":
+			return
+		case "/stop":
+			c.stop()
+		case "/switch", "/s":
+			if arg == "" {
+				c.printf("Usage: /switch <session>\n")
+			} else if err := c.switchSession(arg); err != nil {
+				c.printf("[error] %v\n", err)
+			}
+		case "/sessions":
+			c.printSessions()
+		case "/history":
+			limit := 20
+			if n, err := strconv.Atoi(arg); err == nil && n > 0 {
+				limit = n
+			}
+			if err := c.showHistory(limit); err != nil {
+				c.printf("[error] %v\n", err)
+			}
+		case "/allow", "/deny":
+			c.answerPermission(strings.TrimPrefix(command, "/"), arg)
+		case "/help":
+			c.printf("%s\n", chatCommands)
+		default:
+			c.printf("Unknown command %s, /help lists them\n", command)
+		}
+	}
+}
+
+func (c *chatClient) sendPrompt(prompt string) {
+	c.mu.Lock()
+	sessionID := c.session.ID
+	c.lastSent = prompt
+	c.mu.Unlock()
+
+	if err := c.send("session_chat", map[string]interface{}{
+		"session_id": sessionID,
+		"message":    prompt,
+	}); err != nil {
+		c.printf("[error] failed to send: %v\n", err)
+	}
+}
+
+func (c *chatClient) stop() {
+	c.mu.Lock()
+	sessionID := c.session.ID
+	c.mu.Unlock()
+
+	if err := c.send("stop_generation", map[string]interface{}{"session_id": sessionID}); err != nil {
+		c.printf("[error] failed to stop: %v\n", err)
+	}
+}
+
+// answerPermission allows or denies the oldest pending tool call, with an optional message
+func (c *chatClient) answerPermission(decision, message string) {
+	c.mu.Lock()
+	sessionID := c.session.ID
+	if len(c.permissions) == 0 {
+		c.mu.Unlock()
+		c.printf("No permission prompt is waiting\n")
+		return
+	}
+	requestID := c.permissions[0]
+	c.mu.Unlock()
+
+	if err := c.send("permission_response", map[string]interface{}{
+		"session_id": sessionID,
+		"request_id": requestID,
+		"decision":   decision,
+		"message":    message,
+	}); err != nil {
+		c.printf("[error] failed to answer: %v\n", err)
+	}
+}
+
+func (c *chatClient) printSessions() {
+	sessions, projects, err := c.listSessions()
+	if err != nil {
+		c.printf("[error] %v\n", err)
+		return
+	}
+
+	c.mu.Lock()
+	current := c.session.ID
+	c.mu.Unlock()
+
+	for _, session := range sessions {
+		marker := " "
+		if session.ID == current {
+			marker = "*"
+		}
+		c.printf("%s %4d  %s/%s  %s\n", marker, session.ID, projects[session.ProjectID], session.Name, session.ActivityStatus)
+	}
+}
+
+// readEvents prints the server's events for the current session until the connection closes
+func (c *chatClient) readEvents() {
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if c.closing.Load() {
+				return
+			}
+			c.printf("[error] connection closed: %v\n", err)
+			os.Exit(1)
+		}
+
+		// The server batches queued messages into one frame, one per line
+		for _, line := range strings.Split(string(data), "\n") {
+			var msg struct {
+				Type      string                 `json:"type"`
+				SessionID interface{}            `json:"session_id"`
+				Data      map[string]interface{} `json:"data"`
+			}
+			if err := json.Unmarshal([]byte(line), &msg); err != nil {
+				continue
+			}
+			c.handleEvent(msg.Type, msg.SessionID, msg.Data)
+		}
+	}
+}
+
+func (c *chatClient) handleEvent(eventType string, sessionID interface{}, data map[string]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if eventType == "error" {
+		c.printf("[error] %v\n", data["error"])
+		return
+	}
+	if id, ok := sessionID.(float64); !ok || int(id) != c.session.ID {
+		return
+	}
+
+	indent := ""
+	if parent, _ := data["parent_tool_use_id"].(string); parent != "" {
+		indent = "  | "
+	}
+
+	switch eventType {
+	case "claude_output":
+		c.streaming = true
+		streamID, _ := data["stream_id"].(string)
+		switch data["content_type"] {
+		case "text":
+			if chunk, _ := data["is_chunk"].(bool); chunk {
+				if streamID != "" && !c.streamed[streamID] {
+					c.streamed[streamID] = true
+					c.printf("%s", indent)
+				}
+				c.printf("%v", data["output"])
+			} else if c.streamed[streamID] {
+				delete(c.streamed, streamID)
+				c.printf("\n")
+			} else {
+				c.printf("%s%v\n", indent, data["output"])
+			}
+		case "thinking":
+			c.printf("%s(thinking)\n", indent)
+		case "image":
+			c.printf("%s(image)\n", indent)
+		case "tool_use":
+			c.printf("%s[%v] %s\n", indent, data["tool_name"], toolSummary(data["tool_input"]))
+		case "tool_result":
+			c.printf("%s  -> %s\n", indent, toolResultSummary(data["tool_content"]))
+		}
+
+	case "new_chat_message":
+		raw, _ := json.Marshal(data["message"])
+		msg := &models.ChatMessage{}
+		if json.Unmarshal(raw, msg) != nil {
+			return
+		}
+		// Prompts typed here are already on screen
+		if msg.Role == "system" || (msg.Role == "user" && msg.Content != c.lastSent) {
+			c.printMessage(msg)
+		}
+		if msg.Role == "user" {
+			c.streaming = true
+		}
+
+	case "prompt_queued":
+		if prompt, ok := data["prompt"].(map[string]interface{}); ok {
+			c.printf("[queued at position %v]\n", prompt["position"])
+		}
+
+	case "claude_response_complete":
+		c.streaming = false
+		cost := 0.0
+		if usage, ok := data["usage"].(map[string]interface{}); ok {
+			cost, _ = usage["total_cost_usd"].(float64)
+		}
+		c.printf("[done, $%.4f]\n", cost)
+
+	case "claude_error":
+		c.streaming = false
+		c.printf("[error] %v\n", data["error"])
+
+	case "claude_generation_stopped":
+		c.streaming = false
+		c.printf("[stopped]\n")
+
+	case "budget_warning", "budget_exceeded":
+		if limit, ok := data["limit"].(map[string]interface{}); ok {
+			percent, _ := limit["percent"].(float64)
+			c.printf("[budget] %.0f%% of the %v %v budget used\n", percent, limit["period"], limit["unit"])
+		}
+
+	case "prompt_queue_held":
+		c.printf("[queue held] %v\n", data["reason"])
+
+	case "usage_limit_reached":
+		c.streaming = false
+		if limit, ok := data["limit"].(map[string]interface{}); ok {
+			c.printf("[usage limit] %v, retrying at %v\n", limit["message"], limit["reset_at"])
+		}
+
+	case "usage_limit_reset":
+		c.printf("[usage limit] reset\n")
+
+	case "validation_completed":
+		results, _ := data["results"].([]interface{})
+		for _, raw := range results {
+			check, _ := raw.(map[string]interface{})
+			status := "passed"
+			if passed, _ := check["passed"].(bool); !passed {
+				status = fmt.Sprintf("failed, exit code %v", check["exit_code"])
+			}
+			c.printf("[check] %v: %s\n", check["name"], status)
+		}
+
+	case "permission_request":
+		request, _ := data["request"].(map[string]interface{})
+		requestID, _ := request["id"].(string)
+		c.permissions = append(c.permissions, requestID)
+		c.printf("[permission] %v wants to run: %s (/allow or /deny)\n", request["tool_name"], toolSummary(request["input"]))
+
+	case "permission_resolved":
+		requestID, _ := data["request_id"].(string)
+		for i, id := range c.permissions {
+			if id == requestID {
+				c.permissions = append(c.permissions[:i], c.permissions[i+1:]...)
+				break
+			}
+		}
+		c.printf("[permission] %v: %v by %v\n", data["tool_name"], data["decision"], data["decided_by"])
+	}
+}
+
+// toolResultSummary shortens a tool result to its first line
+func toolResultSummary(content interface{}) string {
+	var text string
+	switch value := content.(type) {
+	case string:
+		text = value
+	case []interface{}:
+		// Content blocks, e.g. [{"type": "text", "text": "..."}]
+		for _, block := range value {
+			if fields, ok := block.(map[string]interface{}); ok {
+				if blockText, ok := fields["text"].(string); ok {
+					text += blockText + "\n"
+				}
+			}
+		}
+	default:
+		if content == nil {
+			return "(no output)"
+		}
+		raw, _ := json.Marshal(content)
+		text = string(raw)
+	}
+
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	summary := lines[0]
+	if len(summary) > 100 {
+		summary = summary[:100] + "..."
+	}
+	if summary == "" {
+		return "(no output)"
+	}
+	if len(lines) > 1 {
+		summary += fmt.Sprintf(" (+%d lines)", len(lines)-1)
+	}
+	return summary
+}
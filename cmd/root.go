@@ -36,6 +36,8 @@ func init() {
 	rootCmd.AddCommand(projectCmd)
 	rootCmd.AddCommand(sessionCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(chatCmd)
 }
 
 func initConfig() {
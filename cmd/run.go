@@ -0,0 +1,525 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"habibi-go/internal/config"
+	"habibi-go/internal/database"
+	"habibi-go/internal/database/repositories"
+	"habibi-go/internal/models"
+	"habibi-go/internal/services"
+)
+
+// Exit statuses of the run command
+const (
+	runExitOK           = 0
+	runExitError        = 1
+	runExitTurnFailed   = 2
+	runExitChecksFailed = 3
+	runExitPushFailed   = 4
+	runExitInterrupted  = 130
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run [project-name] [prompt]",
+	Short: "Run one prompt in a session without the web UI",
+	Long: `Run one prompt in a session and stream the agent's output to stdout.
+
+The session is reused if it exists, otherwise it is created. Its name may be a
+template using {{.Date}}, {{.Time}}, {{.Timestamp}} or {{.Unix}}. The command
+waits until the session is idle, including fix-up prompts sent for failing checks.
+With --wait-for-limits a turn that hits a usage limit is retried once the limit
+resets instead of failing the run.
+
+Exit status: 0 success, 1 error, 2 the agent's turn failed, was stopped or timed
+out, 3 checks failed, 4 push failed, 130 interrupted.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run:  runRun,
+}
+
+var (
+	runSession       string
+	runBranch        string
+	runBaseBranch    string
+	runPromptFile    string
+	runOutput        string
+	runChecks        []string
+	runMaxIterations int
+	runPush          bool
+	runRemoteBranch  string
+	runTimeout       time.Duration
+	runWaitForLimits bool
+)
+
+func init() {
+	runCmd.Flags().StringVarP(&runSession, "session", "s", "run-{{.Timestamp}}", "session name or name template")
+	runCmd.Flags().StringVarP(&runBranch, "branch", "b", "", "branch of a new session (default is the session name)")
+	runCmd.Flags().StringVar(&runBaseBranch, "base", "", "base branch of a new session (default is the project's default branch)")
+	runCmd.Flags().StringVarP(&runPromptFile, "prompt-file", "f", "", "read the prompt from a file, - for stdin")
+	runCmd.Flags().StringVarP(&runOutput, "output", "o", "text", "output format: text or json")
+	runCmd.Flags().StringArrayVar(&runChecks, "check", nil, "command that must pass after the turn; replaces the configured checks (repeatable)")
+	runCmd.Flags().IntVar(&runMaxIterations, "max-iterations", -1, "fix-up prompts sent while checks fail (default from the validation settings)")
+	runCmd.Flags().BoolVar(&runPush, "push", false, "push the session branch when the run succeeds")
+	runCmd.Flags().StringVar(&runRemoteBranch, "remote-branch", "", "remote branch to push to (default is the session branch)")
+	runCmd.Flags().DurationVar(&runTimeout, "timeout", 0, "stop the run after this long (default is no limit beyond agents.default_timeout per turn)")
+	runCmd.Flags().BoolVar(&runWaitForLimits, "wait-for-limits", false, "wait for usage limits to reset and retry the turn instead of failing")
+}
+
+func runRun(cmd *cobra.Command, args []string) {
+	os.Exit(headlessRun(args))
+}
+
+// headlessRun does the work of the run command and returns its exit status
+func headlessRun(args []string) int {
+	// The services log to stdout, which belongs to the run's output here
+	out := os.Stdout
+	if viper.GetBool("verbose") {
+		os.Stdout = os.Stderr
+	} else if devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+		os.Stdout = devNull
+	}
+
+	fail := func(format string, a ...interface{}) int {
+		fmt.Fprintf(os.Stderr, "Error: "+format+"\n", a...)
+		return runExitError
+	}
+
+	if runOutput != "text" && runOutput != "json" {
+		return fail("invalid output format %q (use text or json)", runOutput)
+	}
+
+	prompt, err := readRunPrompt(args)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	sessionName, err := expandSessionName(runSession, time.Now())
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fail("failed to load configuration: %v", err)
+	}
+	if err := cfg.CreateDirectories(); err != nil {
+		return fail("failed to create directories: %v", err)
+	}
+
+	db, err := database.New(cfg.Database.Path)
+	if err != nil {
+		return fail("failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations(); err != nil {
+		return fail("failed to run migrations: %v", err)
+	}
+
+	projectRepo := repositories.NewProjectRepository(db.DB)
+	sessionRepo := repositories.NewSessionRepository(db.DB)
+	eventRepo := repositories.NewEventRepository(db.DB)
+
+	gitService := services.NewGitService(cfg.Projects.WorktreeBasePath)
+	sshService := services.NewSSHService()
+	projectService := services.NewProjectService(projectRepo, eventRepo, gitService)
+	sessionService := services.NewSessionService(sessionRepo, projectRepo, eventRepo, gitService, sshService)
+
+	if !models.IsValidPermissionMode(cfg.Agents.PermissionMode) {
+		return fail("invalid agents.permission_mode: %s", cfg.Agents.PermissionMode)
+	}
+	defaultAgentSettings := &models.AgentSettings{PermissionMode: cfg.Agents.PermissionMode}
+	sessionService.SetDefaultAgentSettings(defaultAgentSettings)
+
+	// Nobody can answer tool permission prompts here, so no permission service is set
+	claudeService, err := newClaudeSessionService(cfg, db, gitService, sshService, defaultAgentSettings)
+	if err != nil {
+		return fail("failed to configure agent backend: %v", err)
+	}
+	projectService.SetAgentBackends(claudeService.AgentBackends())
+	sessionService.SetAgentBackends(claudeService.AgentBackends())
+	claudeService.SetMCPServerService(newMCPServerService(cfg, db, sshService))
+	budgetService := newBudgetService(db)
+	claudeService.SetBudgetService(budgetService)
+	claudeService.StartWatchdog(cfg.Agents.HealthCheckInterval)
+	defer claudeService.StopWatchdog()
+	defer claudeService.ClosePersistentAgents()
+
+	project, err := projectService.GetProjectByName(args[0])
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	session, err := sessionService.GetSessionByProjectAndName(project.ID, sessionName)
+	if err != nil {
+		branch := runBranch
+		if branch == "" {
+			branch = sessionName
+		}
+		session, err = sessionService.CreateSession(&models.CreateSessionRequest{
+			ProjectID:  project.ID,
+			Name:       sessionName,
+			BranchName: branch,
+			BaseBranch: runBaseBranch,
+		})
+		if err != nil {
+			return fail("failed to create session: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Created session %s (%d) in %s\n", session.Name, session.ID, session.WorktreePath)
+	} else {
+		fmt.Fprintf(os.Stderr, "Using session %s (%d) in %s\n", session.Name, session.ID, session.WorktreePath)
+	}
+
+	if len(runChecks) > 0 || runMaxIterations >= 0 {
+		if err := setRunChecks(sessionService, project, session); err != nil {
+			return fail("%v", err)
+		}
+	}
+
+	// Turns and checks from before this run do not decide its outcome
+	lastTurnID := 0
+	if turns, err := claudeService.GetTurns(session.ID, 1); err == nil && len(turns) > 0 {
+		lastTurnID = turns[0].ID
+	}
+
+	printer := &runPrinter{out: out, sessionID: session.ID, json: runOutput == "json"}
+	claudeService.SetEventBroadcaster(printer)
+	budgetService.SetEventBroadcaster(printer)
+
+	if _, err := claudeService.SendMessage(session.ID, prompt); err != nil {
+		return fail("failed to start turn: %v", err)
+	}
+
+	// Wait for the session to go idle, stopping it on a signal or timeout
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var deadline <-chan time.Time
+	if runTimeout > 0 {
+		deadline = time.After(runTimeout)
+	}
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	interrupted, timedOut := false, false
+	for claudeService.IsRunning(session.ID) || (runWaitForLimits && waitingForUsageLimit(claudeService, session.ID)) {
+		select {
+		case <-signals:
+			interrupted = true
+			claudeService.ReleaseSession(session.ID)
+		case <-deadline:
+			timedOut = true
+			claudeService.ReleaseSession(session.ID)
+		case <-ticker.C:
+		}
+	}
+
+	// Without --wait-for-limits the prompt kept for the retry goes with the run
+	if claudeService.GetUsageLimit(session.ID) != nil {
+		claudeService.ReleaseSession(session.ID)
+	}
+
+	result := collectRunResult(claudeService, session.ID, lastTurnID)
+	result.Session = session.Name
+	result.Branch = session.BranchName
+	result.WorktreePath = session.WorktreePath
+
+	switch {
+	case interrupted:
+		result.ExitCode = runExitInterrupted
+		result.Error = "interrupted"
+	case timedOut:
+		result.ExitCode = runExitTurnFailed
+		result.Error = fmt.Sprintf("timed out after %s", runTimeout)
+	case result.TurnStatus != string(models.TurnStatusCompleted):
+		result.ExitCode = runExitTurnFailed
+	case result.ChecksPassed != nil && !*result.ChecksPassed:
+		result.ExitCode = runExitChecksFailed
+	case runPush:
+		if err := sessionService.PushSession(session.ID, runRemoteBranch); err != nil {
+			result.ExitCode = runExitPushFailed
+			result.Error = err.Error()
+		} else {
+			result.Pushed = true
+		}
+	}
+
+	printer.Result(result)
+	return result.ExitCode
+}
+
+// waitingForUsageLimit reports whether the session waits out a usage limit, or has just
+// been released from one and is about to retry its prompt
+func waitingForUsageLimit(claudeService *services.ClaudeSessionService, sessionID int) bool {
+	return claudeService.GetUsageLimit(sessionID) != nil || len(claudeService.GetQueue(sessionID)) > 0
+}
+
+// readRunPrompt takes the prompt from the arguments, a file or stdin
+func readRunPrompt(args []string) (string, error) {
+	if runPromptFile != "" && len(args) > 1 {
+		return "", fmt.Errorf("give the prompt as an argument or with --prompt-file, not both")
+	}
+
+	prompt := ""
+	switch {
+	case len(args) > 1:
+		prompt = args[1]
+	case runPromptFile == "-":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read prompt from stdin: %w", err)
+		}
+		prompt = string(data)
+	case runPromptFile != "":
+		data, err := os.ReadFile(runPromptFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read prompt file: %w", err)
+		}
+		prompt = string(data)
+	}
+
+	if strings.TrimSpace(prompt) == "" {
+		return "", fmt.Errorf("a prompt is required")
+	}
+	return prompt, nil
+}
+
+// expandSessionName fills in a session name template
+func expandSessionName(name string, now time.Time) (string, error) {
+	tmpl, err := template.New("session").Option("missingkey=error").Parse(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid session name template: %w", err)
+	}
+
+	var expanded bytes.Buffer
+	err = tmpl.Execute(&expanded, map[string]interface{}{
+		"Date":      now.Format("20060102"),
+		"Time":      now.Format("150405"),
+		"Timestamp": now.Format("20060102-150405"),
+		"Unix":      now.Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid session name template: %w", err)
+	}
+
+	if strings.TrimSpace(expanded.String()) == "" {
+		return "", fmt.Errorf("session name is required")
+	}
+	return expanded.String(), nil
+}
+
+// setRunChecks stores the checks given on the command line in the session's config
+func setRunChecks(sessionService *services.SessionService, project *models.Project, session *models.Session) error {
+	settings, err := models.ResolveValidationSettings(project, session)
+	if err != nil {
+		return err
+	}
+	if settings == nil {
+		settings = &models.ValidationSettings{}
+	}
+
+	if len(runChecks) > 0 {
+		settings.Checks = nil
+		for _, command := range runChecks {
+			settings.Checks = append(settings.Checks, models.ValidationCheck{Command: command})
+		}
+	}
+	if runMaxIterations >= 0 {
+		settings.MaxIterations = &runMaxIterations
+	}
+
+	sessionConfig := make(map[string]interface{})
+	for key, value := range session.Config {
+		sessionConfig[key] = value
+	}
+	sessionConfig[models.ValidationConfigKey] = settings
+
+	if _, err := sessionService.UpdateSession(session.ID, &models.UpdateSessionRequest{Config: sessionConfig}); err != nil {
+		return fmt.Errorf("failed to set checks: %w", err)
+	}
+	return nil
+}
+
+// runResult is the outcome of a headless run, printed last
+type runResult struct {
+	Session      string   `json:"session"`
+	Branch       string   `json:"branch"`
+	WorktreePath string   `json:"worktree_path"`
+	Turns        int      `json:"turns"`
+	TurnStatus   string   `json:"turn_status"`
+	ChecksPassed *bool    `json:"checks_passed,omitempty"`
+	FailedChecks []string `json:"failed_checks,omitempty"`
+	CostUSD      float64  `json:"total_cost_usd"`
+	Pushed       bool     `json:"pushed"`
+	Error        string   `json:"error,omitempty"`
+	ExitCode     int      `json:"exit_code"`
+}
+
+// collectRunResult looks at the turns and checks that ran after lastTurnID
+func collectRunResult(claudeService *services.ClaudeSessionService, sessionID, lastTurnID int) *runResult {
+	result := &runResult{}
+
+	turns, err := claudeService.GetTurns(sessionID, -1)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	for _, turn := range turns {
+		if turn.ID <= lastTurnID {
+			continue
+		}
+		result.Turns++
+		result.TurnStatus = turn.Status
+		result.CostUSD += turn.TotalCostUSD
+		// A turn retried after a usage limit or a failing check leaves the last one's error
+		result.Error = turn.Error
+	}
+
+	if runs, err := claudeService.GetSessionValidation(sessionID, 1); err == nil && len(runs) > 0 && runs[0].TurnID > lastTurnID {
+		passed := runs[0].Passed
+		result.ChecksPassed = &passed
+		for _, check := range runs[0].Results {
+			if !check.Passed {
+				result.FailedChecks = append(result.FailedChecks, check.Name)
+			}
+		}
+	}
+
+	return result
+}
+
+// runPrinter writes the events of one session to stdout as text or JSON lines
+type runPrinter struct {
+	out       io.Writer
+	sessionID int
+	json      bool
+	mu        sync.Mutex
+}
+
+func (p *runPrinter) BroadcastEvent(eventType string, agentID int, data interface{}) {
+	fields, ok := data.(map[string]interface{})
+	if !ok || fields["session_id"] != p.sessionID {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.json {
+		p.writeJSON(eventType, data)
+		return
+	}
+
+	switch eventType {
+	case "claude_output":
+		p.printOutput(fields)
+	case "claude_error":
+		fmt.Fprintf(p.out, "[error] %v\n", fields["error"])
+	case "claude_generation_stopped":
+		fmt.Fprintln(p.out, "[stopped]")
+	case "usage_limit_reached":
+		if limit, ok := fields["limit"].(*models.UsageLimit); ok {
+			fmt.Fprintf(p.out, "[usage limit] %s, resets %s\n", limit.Message, limit.ResetAt.Format(time.RFC3339))
+		}
+	case "usage_limit_reset":
+		fmt.Fprintln(p.out, "[usage limit] reset")
+	case "budget_warning", "budget_exceeded":
+		if limit, ok := fields["limit"].(*models.BudgetLimit); ok {
+			fmt.Fprintf(p.out, "[budget] %.0f%% of the %s %s budget used\n", limit.Percent, limit.Period, limit.Unit)
+		}
+	case "new_chat_message":
+		if msg, ok := fields["message"].(*models.ChatMessage); ok && msg.Role == "system" {
+			fmt.Fprintf(p.out, "[habibi] %s\n", msg.Content)
+		}
+	case "validation_completed":
+		if results, ok := fields["results"].([]models.ValidationCheckResult); ok {
+			for _, check := range results {
+				status := "passed"
+				if !check.Passed {
+					status = fmt.Sprintf("failed, exit code %d", check.ExitCode)
+				}
+				fmt.Fprintf(p.out, "[check] %s: %s\n", check.Name, status)
+			}
+		}
+	}
+}
+
+// printOutput prints agent text and the tools it calls; tool results are left out
+func (p *runPrinter) printOutput(fields map[string]interface{}) {
+	if chunk, _ := fields["is_chunk"].(bool); chunk {
+		return
+	}
+
+	switch fields["content_type"] {
+	case "text":
+		fmt.Fprintln(p.out, fields["output"])
+	case "tool_use":
+		fmt.Fprintf(p.out, "[%v] %s\n", fields["tool_name"], toolSummary(fields["tool_input"]))
+	}
+}
+
+// toolSummary picks the input field that says most about a tool call
+func toolSummary(input interface{}) string {
+	values, ok := input.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	for _, key := range []string{"command", "file_path", "path", "pattern", "url", "description"} {
+		if value, ok := values[key].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Result prints the outcome of the run
+func (p *runPrinter) Result(result *runResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.json {
+		p.writeJSON("run_result", result)
+		return
+	}
+
+	status := result.TurnStatus
+	if result.ChecksPassed != nil {
+		if *result.ChecksPassed {
+			status += ", checks passed"
+		} else {
+			status += fmt.Sprintf(", checks failed: %s", strings.Join(result.FailedChecks, ", "))
+		}
+	}
+	if result.Pushed {
+		status += ", pushed"
+	}
+	if result.Error != "" {
+		status += ": " + result.Error
+	}
+	fmt.Fprintf(p.out, "[done] %s on %s: %s (%d turns, $%.4f)\n", result.Session, result.Branch, status, result.Turns, result.CostUSD)
+}
+
+func (p *runPrinter) writeJSON(eventType string, data interface{}) {
+	line, err := json.Marshal(map[string]interface{}{
+		"type": eventType,
+		"data": data,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode %s event: %v\n", eventType, err)
+		return
+	}
+	fmt.Fprintln(p.out, string(line))
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 
 	"github.com/gin-gonic/gin"
@@ -17,6 +18,7 @@ import (
 	"habibi-go/internal/config"
 	"habibi-go/internal/database"
 	"habibi-go/internal/database/repositories"
+	"habibi-go/internal/models"
 	"habibi-go/internal/services"
 )
 
@@ -44,6 +46,63 @@ func init() {
 	serverCmd.Flags().BoolVar(&devMode, "dev", false, "development mode")
 }
 
+// newMCPServerService sets up the project MCP server registry; config files for local
+// sessions are written next to the database
+func newMCPServerService(cfg *config.Config, db *database.DB, sshService *services.SSHService) *services.MCPServerService {
+	mcpRepo := repositories.NewMCPServerRepository(db.DB)
+	projectRepo := repositories.NewProjectRepository(db.DB)
+	sessionRepo := repositories.NewSessionRepository(db.DB)
+	return services.NewMCPServerService(mcpRepo, projectRepo, sessionRepo, sshService, filepath.Join(filepath.Dir(cfg.Database.Path), "mcp"))
+}
+
+// newBudgetService sets up the spend budgets checked before each turn
+func newBudgetService(db *database.DB) *services.BudgetService {
+	budgetRepo := repositories.NewBudgetRepository(db.DB)
+	turnRepo := repositories.NewTurnRepository(db.DB)
+	projectRepo := repositories.NewProjectRepository(db.DB)
+	sessionRepo := repositories.NewSessionRepository(db.DB)
+	return services.NewBudgetService(budgetRepo, turnRepo, projectRepo, sessionRepo)
+}
+
+// newClaudeSessionService sets up the service that runs agents on sessions, with the
+// scheduler, timeouts and backends from the configuration
+func newClaudeSessionService(cfg *config.Config, db *database.DB, gitService *services.GitService, sshService *services.SSHService, defaultAgentSettings *models.AgentSettings) (*services.ClaudeSessionService, error) {
+	projectRepo := repositories.NewProjectRepository(db.DB)
+	sessionRepo := repositories.NewSessionRepository(db.DB)
+	eventRepo := repositories.NewEventRepository(db.DB)
+	chatRepo := repositories.NewChatMessageV2Repository(db.DB)
+	turnRepo := repositories.NewTurnRepository(db.DB)
+	todoRepo := repositories.NewTodoRepository(db.DB)
+	validationRepo := repositories.NewValidationRepository(db.DB)
+	usageLimitRepo := repositories.NewUsageLimitRepository(db.DB)
+	
+	// Configure Claude binary path
+	claudeBinaryPath := "claude"
+	if cfg.Agents.ClaudeBinaryPath != "" {
+		claudeBinaryPath = cfg.Agents.ClaudeBinaryPath
+	}
+	
+	claudeSessionService := services.NewClaudeSessionService(sessionRepo, projectRepo, chatRepo, eventRepo, turnRepo, todoRepo, validationRepo, usageLimitRepo, claudeBinaryPath)
+	claudeSessionService.SetScheduler(services.NewAgentScheduler(cfg.Agents.MaxConcurrent, cfg.Agents.MaxConcurrentPerProject))
+	claudeSessionService.SetTimeouts(cfg.Agents.DefaultTimeout, cfg.Agents.NoOutputTimeout)
+	claudeSessionService.SetStopGracePeriod(cfg.Agents.StopGracePeriod)
+	claudeSessionService.SetSSHService(sshService)
+	claudeSessionService.SetGitService(gitService)
+	claudeSessionService.SetDefaultAgentSettings(defaultAgentSettings)
+	claudeSessionService.SetPersistentProcesses(cfg.Agents.PersistentProcesses, cfg.Agents.PersistentIdleTimeout)
+	claudeSessionService.SetUsageLimitRetryDelay(cfg.Agents.UsageLimitRetryDelay)
+	claudeSessionService.RegisterAgentBackend(services.NewClaudeRunner(claudeBinaryPath, cfg.Agents.StreamPartialMessages))
+	for name, backend := range cfg.Agents.Backends {
+		runner, err := services.NewCommandRunner(name, backend.Command, backend.Args, backend.Output)
+		if err != nil {
+			return nil, err
+		}
+		claudeSessionService.RegisterAgentBackend(runner)
+	}
+	
+	return claudeSessionService, nil
+}
+
 func runServer(cmd *cobra.Command, args []string) {
 	// Load configuration
 	cfg, err := config.Load()
@@ -81,6 +140,7 @@ func runServer(cmd *cobra.Command, args []string) {
 	sessionRepo := repositories.NewSessionRepository(db.DB)
 	eventRepo := repositories.NewEventRepository(db.DB)
 	chatRepo := repositories.NewChatMessageV2Repository(db.DB)
+	attemptRepo := repositories.NewAttemptRepository(db.DB)
 	
 	// Initialize services
 	gitService := services.NewGitService(cfg.Projects.WorktreeBasePath)
@@ -88,14 +148,53 @@ func runServer(cmd *cobra.Command, args []string) {
 	projectService := services.NewProjectService(projectRepo, eventRepo, gitService)
 	sessionService := services.NewSessionService(sessionRepo, projectRepo, eventRepo, gitService, sshService)
 	
-	// Configure Claude binary path
-	claudeBinaryPath := "claude"
-	if cfg.Agents.ClaudeBinaryPath != "" {
-		claudeBinaryPath = cfg.Agents.ClaudeBinaryPath
+	// Agent settings for projects and sessions that do not configure their own
+	if !models.IsValidPermissionMode(cfg.Agents.PermissionMode) {
+		log.Fatalf("Invalid agents.permission_mode: %s", cfg.Agents.PermissionMode)
 	}
+	defaultAgentSettings := &models.AgentSettings{PermissionMode: cfg.Agents.PermissionMode}
+	sessionService.SetDefaultAgentSettings(defaultAgentSettings)
 	
 	// Initialize Claude session service
-	claudeSessionService := services.NewClaudeSessionService(sessionRepo, projectRepo, chatRepo, eventRepo, claudeBinaryPath)
+	claudeSessionService, err := newClaudeSessionService(cfg, db, gitService, sshService, defaultAgentSettings)
+	if err != nil {
+		log.Fatalf("Failed to configure agent backend: %v", err)
+	}
+	projectService.SetAgentBackends(claudeSessionService.AgentBackends())
+	sessionService.SetAgentBackends(claudeSessionService.AgentBackends())
+	mcpServerService := newMCPServerService(cfg, db, sshService)
+	claudeSessionService.SetMCPServerService(mcpServerService)
+	budgetService := newBudgetService(db)
+	claudeSessionService.SetBudgetService(budgetService)
+	
+	// Tool permission prompts for sessions that do not bypass permissions
+	permissionDefault := services.PermissionDecision(cfg.Agents.PermissionPromptDefault)
+	if permissionDefault != services.PermissionAllow && permissionDefault != services.PermissionDeny {
+		log.Fatalf("Invalid agents.permission_prompt_default: %s (use allow or deny)", cfg.Agents.PermissionPromptDefault)
+	}
+	permissionURL := cfg.Agents.PermissionPromptURL
+	if permissionURL == "" {
+		host := cfg.Server.Host
+		if host == "" || host == "0.0.0.0" {
+			host = "127.0.0.1"
+		}
+		permissionURL = fmt.Sprintf("http://%s:%d", host, cfg.Server.Port)
+	}
+	permissionService := services.NewPermissionService(sessionRepo, projectRepo, eventRepo, permissionURL, cfg.Agents.PermissionPromptTimeout, permissionDefault)
+	permissionService.SetRemoteReachable(cfg.Agents.PermissionPromptURL != "")
+	claudeSessionService.SetPermissionService(permissionService)
+	
+	// Clean up sessions left streaming by a server that stopped mid-turn
+	if err := claudeSessionService.ReconcileInterruptedSessions(cfg.Agents.KillOrphansOnStartup); err != nil {
+		log.Printf("Failed to reconcile interrupted sessions: %v", err)
+	}
+	
+	// Best-of-N runs start sessions and their turns through the services above
+	attemptService := services.NewAttemptService(attemptRepo, projectRepo, sessionService, claudeSessionService, gitService, sshService)
+	
+	claudeSessionService.StartWatchdog(cfg.Agents.HealthCheckInterval)
+	defer claudeSessionService.StopWatchdog()
+	defer claudeSessionService.ClosePersistentAgents()
 	
 	// Initialize handlers
 	projectHandler := handlers.NewProjectHandler(projectService)
@@ -103,8 +202,16 @@ func runServer(cmd *cobra.Command, args []string) {
 	websocketHandler := handlers.NewWebSocketHandler(claudeSessionService)
 	chatHandler := handlers.NewChatHandler(chatRepo, sessionRepo)
 	terminalHandler := handlers.NewTerminalHandler(sessionService)
+	claudeHandler := handlers.NewClaudeHandler(claudeSessionService)
+	permissionHandler := handlers.NewPermissionHandler(permissionService)
+	attemptHandler := handlers.NewAttemptHandler(attemptService)
+	mcpServerHandler := handlers.NewMCPServerHandler(mcpServerService)
+	budgetHandler := handlers.NewBudgetHandler(budgetService)
 	
 	// Set cross-handler dependencies
+	websocketHandler.SetPermissionService(permissionService)
+	websocketHandler.SetAttemptService(attemptService)
+	websocketHandler.SetBudgetService(budgetService)
 	sessionHandler.SetWebSocketHandler(websocketHandler)
 	sessionHandler.SetTerminalHandler(terminalHandler)
 	
@@ -112,7 +219,7 @@ func runServer(cmd *cobra.Command, args []string) {
 	websocketHandler.StartHub()
 	
 	// Initialize router
-	router := api.NewRouter(projectHandler, sessionHandler, websocketHandler, chatHandler, terminalHandler)
+	router := api.NewRouter(projectHandler, sessionHandler, websocketHandler, chatHandler, terminalHandler, claudeHandler, permissionHandler, attemptHandler, mcpServerHandler, budgetHandler)
 	
 	// Set auth config
 	router.SetAuthConfig(&cfg.Server.Auth)
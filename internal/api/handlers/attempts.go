@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"habibi-go/internal/models"
+	"habibi-go/internal/services"
+)
+
+// AttemptHandler serves best-of-N runs: one prompt sent to several new sessions
+type AttemptHandler struct {
+	attemptService *services.AttemptService
+}
+
+func NewAttemptHandler(attemptService *services.AttemptService) *AttemptHandler {
+	return &AttemptHandler{
+		attemptService: attemptService,
+	}
+}
+
+// CreateAttemptGroup starts a prompt in several new sessions
+func (h *AttemptHandler) CreateAttemptGroup(c *gin.Context) {
+	var req models.CreateAttemptGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	group, err := h.attemptService.CreateAttemptGroup(&req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    group,
+	})
+}
+
+// GetProjectAttemptGroups lists a project's attempt groups
+func (h *AttemptHandler) GetProjectAttemptGroups(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid project ID",
+		})
+		return
+	}
+
+	groups, err := h.attemptService.GetProjectAttemptGroups(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if groups == nil {
+		groups = []*models.AttemptGroup{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    groups,
+	})
+}
+
+// GetAttemptGroup returns an attempt group with its attempts
+func (h *AttemptHandler) GetAttemptGroup(c *gin.Context) {
+	groupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid attempt group ID",
+		})
+		return
+	}
+
+	group, err := h.attemptService.GetAttemptGroup(groupID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    group,
+	})
+}
+
+// CompareAttempts shows the attempts of a group side by side
+func (h *AttemptHandler) CompareAttempts(c *gin.Context) {
+	groupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid attempt group ID",
+		})
+		return
+	}
+
+	comparison, err := h.attemptService.CompareAttempts(groupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    comparison,
+	})
+}
+
+// KeepAttempt keeps one attempt and closes the others
+func (h *AttemptHandler) KeepAttempt(c *gin.Context) {
+	groupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid attempt group ID",
+		})
+		return
+	}
+
+	var req struct {
+		SessionID int `json:"session_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	group, err := h.attemptService.KeepAttempt(groupID, req.SessionID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    group,
+	})
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"habibi-go/internal/api/middleware"
+	"habibi-go/internal/models"
+	"habibi-go/internal/services"
+)
+
+// BudgetHandler serves project and session spend budgets and their overrides
+type BudgetHandler struct {
+	budgetService *services.BudgetService
+}
+
+func NewBudgetHandler(budgetService *services.BudgetService) *BudgetHandler {
+	return &BudgetHandler{
+		budgetService: budgetService,
+	}
+}
+
+// GetProjectBudget reports a project's daily and monthly budgets
+func (h *BudgetHandler) GetProjectBudget(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid project ID",
+		})
+		return
+	}
+
+	status, err := h.budgetService.GetProjectStatus(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    status,
+	})
+}
+
+// GetSessionBudget reports the budgets that apply to a session
+func (h *BudgetHandler) GetSessionBudget(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	status, err := h.budgetService.GetSessionStatus(sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    status,
+	})
+}
+
+// OverrideProjectBudget lets a project's sessions run past their budgets for a while
+func (h *BudgetHandler) OverrideProjectBudget(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid project ID",
+		})
+		return
+	}
+
+	var req models.BudgetOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	override, err := h.budgetService.GrantProjectOverride(projectID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    override,
+	})
+}
+
+// RevokeProjectBudgetOverride ends the overrides granted to a project
+func (h *BudgetHandler) RevokeProjectBudgetOverride(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid project ID",
+		})
+		return
+	}
+
+	if err := h.budgetService.RevokeProjectOverrides(projectID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Budget override revoked",
+	})
+}
+
+// OverrideSessionBudget lets one session run past its budgets for a while
+func (h *BudgetHandler) OverrideSessionBudget(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	var req models.BudgetOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	override, err := h.budgetService.GrantSessionOverride(sessionID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    override,
+	})
+}
+
+// RevokeSessionBudgetOverride ends the overrides granted to a session
+func (h *BudgetHandler) RevokeSessionBudgetOverride(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	if err := h.budgetService.RevokeSessionOverrides(sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Budget override revoked",
+	})
+}
+
+// budgetChangeAllowed refuses a config update that changes the budget settings unless
+// the request carries the admin token, since raising a budget is like overriding it.
+// It writes the error response and returns false when the change is refused.
+func budgetChangeAllowed(c *gin.Context, current, requested map[string]interface{}) bool {
+	if requested == nil || middleware.IsAdmin(c) {
+		return true
+	}
+	if reflect.DeepEqual(current[models.BudgetConfigKey], requested[models.BudgetConfigKey]) {
+		return true
+	}
+
+	c.JSON(http.StatusForbidden, middleware.AdminRequiredResponse())
+	return false
+}
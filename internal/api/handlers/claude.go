@@ -0,0 +1,638 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"habibi-go/internal/models"
+	"habibi-go/internal/services"
+)
+
+// ClaudeHandler exposes Claude run state for sessions
+type ClaudeHandler struct {
+	claudeService *services.ClaudeSessionService
+}
+
+func NewClaudeHandler(claudeService *services.ClaudeSessionService) *ClaudeHandler {
+	return &ClaudeHandler{
+		claudeService: claudeService,
+	}
+}
+
+// GetConversations lists the Claude conversations recorded for a session
+func (h *ClaudeHandler) GetConversations(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	conversations, err := h.claudeService.ListConversations(sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    conversations,
+	})
+}
+
+// ResumeConversation selects a previous Claude conversation for the session's next turn
+func (h *ClaudeHandler) ResumeConversation(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	var req struct {
+		ClaudeSessionID string `json:"claude_session_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := h.claudeService.ResumeConversation(sessionID, req.ClaudeSessionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Conversation selected",
+	})
+}
+
+// NewConversation makes the session's next turn start a fresh Claude conversation
+func (h *ClaudeHandler) NewConversation(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	if err := h.claudeService.StartNewConversation(sessionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "New conversation will start on the next message",
+	})
+}
+
+// GetSessionTurns lists a session's recent turns with their usage and cost
+func (h *ClaudeHandler) GetSessionTurns(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	limit := 100
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid limit",
+			})
+			return
+		}
+	}
+
+	turns, err := h.claudeService.GetTurns(sessionID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    turns,
+	})
+}
+
+// GetTurn returns a single turn and the chat messages it produced
+func (h *ClaudeHandler) GetTurn(c *gin.Context) {
+	turnID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid turn ID",
+		})
+		return
+	}
+
+	turn, messages, err := h.claudeService.GetTurn(turnID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"turn":     turn,
+			"messages": messages,
+			// Sub-agent messages nested under the Task call that started them
+			"message_tree": models.BuildMessageTree(messages),
+		},
+	})
+}
+
+// GetTurnDiff returns the files a turn changed in the worktree, with their diffs
+func (h *ClaudeHandler) GetTurnDiff(c *gin.Context) {
+	turnID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid turn ID",
+		})
+		return
+	}
+
+	files, err := h.claudeService.GetTurnDiff(turnID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"files": files,
+		},
+	})
+}
+
+// RestoreTurnSnapshot puts the session's worktree back to how it was before or after a turn
+func (h *ClaudeHandler) RestoreTurnSnapshot(c *gin.Context) {
+	turnID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid turn ID",
+		})
+		return
+	}
+
+	// Without a body the worktree goes back to before the turn
+	req := struct {
+		Point string `json:"point"`
+	}{Point: services.SnapshotBefore}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	backup, err := h.claudeService.RestoreTurnSnapshot(turnID, req.Point)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"turn_id": turnID,
+			"point":   req.Point,
+			// Snapshot of the worktree as it was before the restore
+			"backup": backup,
+		},
+	})
+}
+
+// GetTurnValidation returns the checks run after a turn and their results
+func (h *ClaudeHandler) GetTurnValidation(c *gin.Context) {
+	turnID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid turn ID",
+		})
+		return
+	}
+
+	runs, err := h.claudeService.GetTurnValidation(turnID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    runs,
+	})
+}
+
+// GetSessionValidation lists a session's recent validation runs, oldest first
+func (h *ClaudeHandler) GetSessionValidation(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	limit := 100
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid limit",
+			})
+			return
+		}
+	}
+
+	runs, err := h.claudeService.GetSessionValidation(sessionID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    runs,
+	})
+}
+
+// GetTurnTranscript returns the raw agent output saved for a turn as JSON lines
+func (h *ClaudeHandler) GetTurnTranscript(c *gin.Context) {
+	turnID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid turn ID",
+		})
+		return
+	}
+
+	data, err := h.claudeService.GetTurnTranscript(turnID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/x-ndjson", data)
+}
+
+// RebuildChatHistory replaces a session's agent messages with ones parsed again from the saved transcripts
+func (h *ClaudeHandler) RebuildChatHistory(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	result, err := h.claudeService.RebuildChatHistory(sessionID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// GetTodos returns the task list the agent keeps for a session
+func (h *ClaudeHandler) GetTodos(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	list, err := h.claudeService.GetTodos(sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    list,
+	})
+}
+
+// GetTodoHistory lists the versions of a session's task list, oldest first
+func (h *ClaudeHandler) GetTodoHistory(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	limit := 100
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid limit",
+			})
+			return
+		}
+	}
+
+	lists, err := h.claudeService.GetTodoHistory(sessionID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    lists,
+	})
+}
+
+// GetSessionUsage returns the total tokens and cost spent in a session
+func (h *ClaudeHandler) GetSessionUsage(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	usage, err := h.claudeService.GetSessionUsage(sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    usage,
+	})
+}
+
+// GetProjectUsage returns the total tokens and cost spent across a project's sessions
+func (h *ClaudeHandler) GetProjectUsage(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid project ID",
+		})
+		return
+	}
+
+	usage, err := h.claudeService.GetProjectUsage(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    usage,
+	})
+}
+
+// GetQueue lists the prompts waiting for a session's running turn to finish
+func (h *ClaudeHandler) GetQueue(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.claudeService.GetQueue(sessionID),
+	})
+}
+
+// ReorderQueue sets the order in which a session's queued prompts run
+func (h *ClaudeHandler) ReorderQueue(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	var req struct {
+		PromptIDs []int `json:"prompt_ids" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := h.claudeService.ReorderQueue(sessionID, req.PromptIDs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.claudeService.GetQueue(sessionID),
+	})
+}
+
+// CancelQueuedPrompt removes a prompt from a session's queue
+func (h *ClaudeHandler) CancelQueuedPrompt(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	promptID, err := strconv.Atoi(c.Param("promptId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid prompt ID",
+		})
+		return
+	}
+
+	if err := h.claudeService.CancelQueuedPrompt(sessionID, promptID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Queued prompt cancelled",
+	})
+}
+
+// ClearQueue cancels every prompt queued for a session
+func (h *ClaudeHandler) ClearQueue(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	count := h.claudeService.ClearQueue(sessionID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("Cancelled %d queued prompts", count),
+	})
+}
+
+// GetUsageLimit reports the usage limit a session waits out before retrying its prompt
+func (h *ClaudeHandler) GetUsageLimit(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.claudeService.GetUsageLimit(sessionID),
+	})
+}
+
+// RetryUsageLimit stops waiting for a session's usage limit and retries its prompt now
+func (h *ClaudeHandler) RetryUsageLimit(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	if err := h.claudeService.RetryUsageLimit(sessionID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Retrying queued prompts",
+	})
+}
+
+// GetAgentBackends lists the agent backends a project or session can select
+func (h *ClaudeHandler) GetAgentBackends(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.claudeService.AgentBackends(),
+	})
+}
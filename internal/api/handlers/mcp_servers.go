@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"habibi-go/internal/models"
+	"habibi-go/internal/services"
+)
+
+// MCPServerHandler serves each project's MCP server registry and the servers each
+// session loads
+type MCPServerHandler struct {
+	mcpService *services.MCPServerService
+}
+
+func NewMCPServerHandler(mcpService *services.MCPServerService) *MCPServerHandler {
+	return &MCPServerHandler{
+		mcpService: mcpService,
+	}
+}
+
+// GetProjectServers lists a project's MCP servers
+func (h *MCPServerHandler) GetProjectServers(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid project ID",
+		})
+		return
+	}
+
+	servers, err := h.mcpService.GetProjectServers(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    servers,
+	})
+}
+
+// CreateServer adds an MCP server to a project
+func (h *MCPServerHandler) CreateServer(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid project ID",
+		})
+		return
+	}
+
+	var req models.MCPServerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	server, err := h.mcpService.CreateServer(projectID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    server,
+	})
+}
+
+// GetServer returns one MCP server definition
+func (h *MCPServerHandler) GetServer(c *gin.Context) {
+	serverID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid MCP server ID",
+		})
+		return
+	}
+
+	server, err := h.mcpService.GetServer(serverID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    server,
+	})
+}
+
+// UpdateServer replaces an MCP server definition
+func (h *MCPServerHandler) UpdateServer(c *gin.Context) {
+	serverID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid MCP server ID",
+		})
+		return
+	}
+
+	var req models.MCPServerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	server, err := h.mcpService.UpdateServer(serverID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    server,
+	})
+}
+
+// DeleteServer removes an MCP server from its project
+func (h *MCPServerHandler) DeleteServer(c *gin.Context) {
+	serverID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid MCP server ID",
+		})
+		return
+	}
+
+	if err := h.mcpService.DeleteServer(serverID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "MCP server deleted successfully",
+	})
+}
+
+// GetSessionServers lists the MCP servers of a session's project and whether the session loads each
+func (h *MCPServerHandler) GetSessionServers(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	servers, err := h.mcpService.GetSessionServers(sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    servers,
+	})
+}
+
+// SetSessionServer turns an MCP server on or off for a session
+func (h *MCPServerHandler) SetSessionServer(c *gin.Context) {
+	sessionID, serverID, ok := sessionServerParams(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	servers, err := h.mcpService.SetSessionServer(sessionID, serverID, req.Enabled)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    servers,
+	})
+}
+
+// ResetSessionServer returns a session to its project's default for an MCP server
+func (h *MCPServerHandler) ResetSessionServer(c *gin.Context) {
+	sessionID, serverID, ok := sessionServerParams(c)
+	if !ok {
+		return
+	}
+
+	servers, err := h.mcpService.SetSessionServer(sessionID, serverID, nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    servers,
+	})
+}
+
+func sessionServerParams(c *gin.Context) (int, int, bool) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return 0, 0, false
+	}
+
+	serverID, err := strconv.Atoi(c.Param("serverId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid MCP server ID",
+		})
+		return 0, 0, false
+	}
+
+	return sessionID, serverID, true
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"habibi-go/internal/services"
+)
+
+// PermissionHandler serves the permission prompt tool agents call and the
+// endpoints viewers use to answer it
+type PermissionHandler struct {
+	permissionService *services.PermissionService
+}
+
+func NewPermissionHandler(permissionService *services.PermissionService) *PermissionHandler {
+	return &PermissionHandler{
+		permissionService: permissionService,
+	}
+}
+
+// mcpRequest is a JSON-RPC 2.0 request or notification
+type mcpRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type mcpResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *mcpError       `json:"error,omitempty"`
+}
+
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// HandleMCP is a minimal MCP server over HTTP exposing the permission prompt tool
+func (h *PermissionHandler) HandleMCP(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" || !h.permissionService.ValidToken(token) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Unknown permission token",
+		})
+		return
+	}
+
+	var req mcpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, mcpResponse{
+			JSONRPC: "2.0",
+			ID:      json.RawMessage("null"),
+			Error:   &mcpError{Code: -32700, Message: err.Error()},
+		})
+		return
+	}
+
+	// Notifications such as notifications/initialized need no answer
+	if len(req.ID) == 0 {
+		c.Status(http.StatusAccepted)
+		return
+	}
+
+	resp := mcpResponse{JSONRPC: "2.0", ID: req.ID}
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params)
+		if params.ProtocolVersion == "" {
+			params.ProtocolVersion = "2024-11-05"
+		}
+		resp.Result = gin.H{
+			"protocolVersion": params.ProtocolVersion,
+			"capabilities":    gin.H{"tools": gin.H{}},
+			"serverInfo":      gin.H{"name": "habibi", "version": "1.0.0"},
+		}
+	case "ping":
+		resp.Result = gin.H{}
+	case "tools/list":
+		resp.Result = gin.H{"tools": []gin.H{permissionPromptToolSchema()}}
+	case "tools/call":
+		result, err := h.callPermissionPrompt(c, token, req.Params)
+		if err != nil {
+			resp.Error = &mcpError{Code: -32602, Message: err.Error()}
+			break
+		}
+		resp.Result = result
+	default:
+		resp.Error = &mcpError{Code: -32601, Message: fmt.Sprintf("method not found: %s", req.Method)}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleMCPStream tells clients this server does not open server-sent event streams
+func (h *PermissionHandler) HandleMCPStream(c *gin.Context) {
+	c.Status(http.StatusMethodNotAllowed)
+}
+
+func (h *PermissionHandler) callPermissionPrompt(c *gin.Context, token string, rawParams json.RawMessage) (gin.H, error) {
+	var params struct {
+		Name      string `json:"name"`
+		Arguments struct {
+			ToolName  string      `json:"tool_name"`
+			Input     interface{} `json:"input"`
+			ToolUseID string      `json:"tool_use_id"`
+		} `json:"arguments"`
+	}
+	if err := json.Unmarshal(rawParams, &params); err != nil {
+		return nil, fmt.Errorf("invalid tool call: %w", err)
+	}
+	if params.Name != services.PermissionMCPToolName {
+		return nil, fmt.Errorf("unknown tool: %s", params.Name)
+	}
+
+	// Waiting for a human can outlast the server's write timeout
+	deadline := time.Now().Add(h.permissionService.Timeout() + time.Minute)
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(deadline); err != nil {
+		fmt.Printf("Failed to extend write deadline for permission prompt: %v\n", err)
+	}
+
+	result, err := h.permissionService.RequestApproval(c.Request.Context(), token, params.Arguments.ToolName, params.Arguments.Input, params.Arguments.ToolUseID)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal permission result: %w", err)
+	}
+	return gin.H{
+		"content": []gin.H{{"type": "text", "text": string(text)}},
+	}, nil
+}
+
+func permissionPromptToolSchema() gin.H {
+	return gin.H{
+		"name":        services.PermissionMCPToolName,
+		"description": "Ask the habibi user whether a tool call may run",
+		"inputSchema": gin.H{
+			"type": "object",
+			"properties": gin.H{
+				"tool_name":   gin.H{"type": "string"},
+				"input":       gin.H{"type": "object"},
+				"tool_use_id": gin.H{"type": "string"},
+			},
+			"required": []string{"tool_name", "input"},
+		},
+	}
+}
+
+// GetPendingPermissions lists the tool calls waiting for a decision in a session
+func (h *PermissionHandler) GetPendingPermissions(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.permissionService.Pending(sessionID),
+	})
+}
+
+// RespondPermission allows or denies a pending tool call
+func (h *PermissionHandler) RespondPermission(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid session ID",
+		})
+		return
+	}
+
+	var req struct {
+		Decision string `json:"decision" binding:"required"`
+		Message  string `json:"message"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := h.permissionService.Respond(sessionID, c.Param("requestId"), services.PermissionDecision(req.Decision), req.Message); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Decision recorded",
+	})
+}
@@ -111,6 +111,20 @@ func (h *ProjectHandler) UpdateProject(c *gin.Context) {
 		return
 	}
 	
+	if req.Config != nil {
+		current, err := h.projectService.GetProject(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		if !budgetChangeAllowed(c, current.Config, req.Config) {
+			return
+		}
+	}
+	
 	project, err := h.projectService.UpdateProject(id, &req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -157,6 +157,20 @@ func (h *SessionHandler) UpdateSession(c *gin.Context) {
 		return
 	}
 	
+	if req.Config != nil {
+		current, err := h.sessionService.GetSession(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		if !budgetChangeAllowed(c, current.Config, req.Config) {
+			return
+		}
+	}
+	
 	session, err := h.sessionService.UpdateSession(id, &req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -19,8 +20,9 @@ var upgrader = websocket.Upgrader{
 }
 
 type WebSocketHandler struct {
-	hub           *Hub
-	claudeService *services.ClaudeSessionService
+	hub               *Hub
+	claudeService     *services.ClaudeSessionService
+	permissionService *services.PermissionService
 }
 
 func NewWebSocketHandler(claudeService *services.ClaudeSessionService) *WebSocketHandler {
@@ -35,6 +37,22 @@ func NewWebSocketHandler(claudeService *services.ClaudeSessionService) *WebSocke
 	return handler
 }
 
+// SetPermissionService lets viewers answer tool permission prompts and receive them
+func (h *WebSocketHandler) SetPermissionService(permissionService *services.PermissionService) {
+	h.permissionService = permissionService
+	permissionService.SetEventBroadcaster(h)
+}
+
+// SetBudgetService broadcasts budget warnings and overrides to viewers
+func (h *WebSocketHandler) SetBudgetService(budgetService *services.BudgetService) {
+	budgetService.SetEventBroadcaster(h)
+}
+
+// SetAttemptService broadcasts the progress of best-of-N runs to viewers
+func (h *WebSocketHandler) SetAttemptService(attemptService *services.AttemptService) {
+	attemptService.SetEventBroadcaster(h)
+}
+
 func (h *WebSocketHandler) StartHub() {
 	go h.hub.Run()
 }
@@ -64,14 +82,23 @@ type Hub struct {
 	broadcast  chan []byte
 	register   chan *Client
 	unregister chan *Client
+	
+	// Messages only for the clients viewing a session
+	sessionBroadcast chan sessionMessage
+}
+
+type sessionMessage struct {
+	sessionID int
+	data      []byte
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte, 256),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
+		clients:          make(map[*Client]bool),
+		broadcast:        make(chan []byte, 256),
+		sessionBroadcast: make(chan sessionMessage, 256),
+		register:         make(chan *Client),
+		unregister:       make(chan *Client),
 	}
 }
 
@@ -98,6 +125,19 @@ func (h *Hub) Run() {
 					delete(h.clients, client)
 				}
 			}
+			
+		case message := <-h.sessionBroadcast:
+			for client := range h.clients {
+				if !client.isViewing(message.sessionID) {
+					continue
+				}
+				select {
+				case client.send <- message.data:
+				default:
+					close(client.send)
+					delete(h.clients, client)
+				}
+			}
 		}
 	}
 }
@@ -107,6 +147,31 @@ type Client struct {
 	conn    *websocket.Conn
 	send    chan []byte
 	handler *WebSocketHandler
+	
+	// Sessions the client views, which get the events meant only for their viewers
+	viewingMutex sync.Mutex
+	viewing      map[int]bool
+}
+
+// view marks a session as viewed by the client, or no longer viewed
+func (c *Client) view(sessionID int, viewing bool) {
+	c.viewingMutex.Lock()
+	defer c.viewingMutex.Unlock()
+	
+	if c.viewing == nil {
+		c.viewing = make(map[int]bool)
+	}
+	if viewing {
+		c.viewing[sessionID] = true
+	} else {
+		delete(c.viewing, sessionID)
+	}
+}
+
+func (c *Client) isViewing(sessionID int) bool {
+	c.viewingMutex.Lock()
+	defer c.viewingMutex.Unlock()
+	return c.viewing[sessionID]
 }
 
 const (
@@ -210,10 +275,16 @@ func (c *Client) handleMessage(message []byte) {
 	log.Printf("Parsed message type: %s", msg.Type)
 	
 	switch msg.Type {
+	case "session_view", "session_leave":
+		c.handleSessionView(msg)
 	case "session_chat":
 		c.handleSessionChat(msg)
 	case "stop_generation":
 		c.handleStopGeneration(msg)
+	case "queue_list", "queue_reorder", "queue_cancel", "queue_clear":
+		c.handlePromptQueue(msg)
+	case "permission_response":
+		c.handlePermissionResponse(msg)
 	case "ping":
 		c.sendMessage(WSMessage{Type: "pong"})
 	default:
@@ -239,10 +310,12 @@ func (c *Client) handleSessionChat(msg WSMessage) {
 		return
 	}
 	
+	c.view(int(sessionID), true)
 	log.Printf("Sending message to Claude service for session %d: %s", int(sessionID), message)
 	
 	// Send message via Claude service
-	if err := c.handler.claudeService.SendMessage(int(sessionID), message); err != nil {
+	queued, err := c.handler.claudeService.SendMessage(int(sessionID), message)
+	if err != nil {
 		log.Printf("Claude service error: %v", err)
 		c.sendError(fmt.Sprintf("Failed to send message: %v", err))
 		return
@@ -251,11 +324,119 @@ func (c *Client) handleSessionChat(msg WSMessage) {
 	log.Printf("Message sent successfully, sending acknowledgment")
 	
 	// Send acknowledgment
+	ack := map[string]interface{}{
+		"session_id": int(sessionID),
+		"status":     "sent",
+	}
+	if queued != nil {
+		ack["status"] = "queued"
+		ack["prompt_id"] = queued.ID
+		ack["queue_position"] = queued.Position
+	}
 	c.sendMessage(WSMessage{
 		Type: "chat_sent",
+		Data: ack,
+	})
+}
+
+// handleSessionView starts or stops sending the client the events meant only for the
+// viewers of a session, such as permission prompts
+func (c *Client) handleSessionView(msg WSMessage) {
+	data, _ := msg.Data.(map[string]interface{})
+	sessionID, ok := data["session_id"].(float64)
+	if !ok || sessionID == 0 {
+		c.sendError("Session ID is required")
+		return
+	}
+	
+	c.view(int(sessionID), msg.Type == "session_view")
+}
+
+func (c *Client) handlePromptQueue(msg WSMessage) {
+	data, _ := msg.Data.(map[string]interface{})
+	sessionID, ok := data["session_id"].(float64)
+	if !ok || sessionID == 0 {
+		c.sendError("Session ID is required")
+		return
+	}
+	
+	service := c.handler.claudeService
+	switch msg.Type {
+	case "queue_reorder":
+		rawIDs, ok := data["prompt_ids"].([]interface{})
+		if !ok {
+			c.sendError("prompt_ids is required")
+			return
+		}
+		promptIDs := make([]int, 0, len(rawIDs))
+		for _, rawID := range rawIDs {
+			id, ok := rawID.(float64)
+			if !ok {
+				c.sendError("prompt_ids must be numbers")
+				return
+			}
+			promptIDs = append(promptIDs, int(id))
+		}
+		if err := service.ReorderQueue(int(sessionID), promptIDs); err != nil {
+			c.sendError(fmt.Sprintf("Failed to reorder queue: %v", err))
+			return
+		}
+	case "queue_cancel":
+		promptID, ok := data["prompt_id"].(float64)
+		if !ok {
+			c.sendError("prompt_id is required")
+			return
+		}
+		if err := service.CancelQueuedPrompt(int(sessionID), int(promptID)); err != nil {
+			c.sendError(fmt.Sprintf("Failed to cancel prompt: %v", err))
+			return
+		}
+	case "queue_clear":
+		service.ClearQueue(int(sessionID))
+	}
+	
+	c.sendMessage(WSMessage{
+		Type: "prompt_queue",
 		Data: map[string]interface{}{
 			"session_id": int(sessionID),
-			"status":     "sent",
+			"queue":      service.GetQueue(int(sessionID)),
+		},
+	})
+}
+
+func (c *Client) handlePermissionResponse(msg WSMessage) {
+	data, _ := msg.Data.(map[string]interface{})
+	sessionID, ok := data["session_id"].(float64)
+	if !ok || sessionID == 0 {
+		c.sendError("Session ID is required")
+		return
+	}
+	
+	requestID, _ := data["request_id"].(string)
+	decision, _ := data["decision"].(string)
+	if requestID == "" || decision == "" {
+		c.sendError("request_id and decision are required")
+		return
+	}
+	message, _ := data["message"].(string)
+	c.view(int(sessionID), true)
+	
+	if c.handler.permissionService == nil {
+		c.sendError("Permission prompts are not enabled")
+		return
+	}
+	
+	if err := c.handler.permissionService.Respond(int(sessionID), requestID, services.PermissionDecision(decision), message); err != nil {
+		c.sendError(fmt.Sprintf("Failed to record decision: %v", err))
+		return
+	}
+	
+	c.sendMessage(WSMessage{
+		Type: "permission_response_recorded",
+		Data: map[string]interface{}{
+			"session_id": int(sessionID),
+			"request_id": requestID,
+			"decision":   decision,
 		},
 	})
 }
@@ -325,15 +506,6 @@ func (h *WebSocketHandler) BroadcastEvent(eventType string, agentID int, data in
 		if sessionID, exists := dataMap["session_id"]; exists {
 			msg.SessionID = sessionID
 		}
-		
-		// Special logging for TodoWrite
-		if eventType == "claude_output" {
-			if contentType, ok := dataMap["content_type"].(string); ok && contentType == "tool_use" {
-				if toolName, ok := dataMap["tool_name"].(string); ok && toolName == "TodoWrite" {
-					log.Printf("TODOWRITE BROADCAST: %+v", dataMap)
-				}
-			}
-		}
 	}
 	
 	msgData, err := json.Marshal(msg)
@@ -342,10 +514,24 @@ func (h *WebSocketHandler) BroadcastEvent(eventType string, agentID int, data in
 		return
 	}
 	
+	if viewerEvents[eventType] {
+		if sessionID, ok := msg.SessionID.(int); ok {
+			h.hub.sessionBroadcast <- sessionMessage{sessionID: sessionID, data: msgData}
+			return
+		}
+	}
+	
 	log.Printf("Broadcasting WebSocket message: %s", string(msgData))
 	h.hub.broadcast <- msgData
 }
 
+// viewerEvents only go to the clients viewing the event's session: permission prompts
+// show the tool input and are answered by whoever sees them
+var viewerEvents = map[string]bool{
+	"permission_request":  true,
+	"permission_resolved": true,
+}
+
 // BroadcastSessionUpdate broadcasts a session update to all connected clients
 func (h *WebSocketHandler) BroadcastSessionUpdate(session interface{}) {
 	msg := WSMessage{
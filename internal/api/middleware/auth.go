@@ -42,4 +42,48 @@ func BasicAuth(cfg *config.AuthConfig) gin.HandlerFunc {
 
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// adminContextKey marks requests that carry the admin token
+const adminContextKey = "admin"
+
+// AdminToken marks requests whose X-Admin-Token header matches server.auth.admin_token
+// as admin requests. Without a configured token no request is an admin request.
+func AdminToken(cfg *config.AuthConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg != nil && cfg.AdminToken != "" {
+			token := c.GetHeader("X-Admin-Token")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) == 1 {
+				c.Set(adminContextKey, true)
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// IsAdmin reports whether AdminToken accepted the request's admin token
+func IsAdmin(c *gin.Context) bool {
+	return c.GetBool(adminContextKey)
+}
+
+// RequireAdmin guards admin endpoints, such as budget overrides. They are refused
+// unless the request carries the admin token, so they stay closed until one is set.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsAdmin(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, AdminRequiredResponse())
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// AdminRequiredResponse is the body of a request refused for lacking the admin token
+func AdminRequiredResponse() gin.H {
+	return gin.H{
+		"success": false,
+		"error":   "Admin token required (set server.auth.admin_token and send it in X-Admin-Token)",
+	}
+}
@@ -14,13 +14,18 @@ import (
 )
 
 type Router struct {
-	projectHandler   *handlers.ProjectHandler
-	sessionHandler   *handlers.SessionHandler
-	websocketHandler *handlers.WebSocketHandler
-	chatHandler      *handlers.ChatHandler
-	terminalHandler  *handlers.TerminalHandler
-	webAssets        embed.FS
-	authConfig       *config.AuthConfig
+	projectHandler    *handlers.ProjectHandler
+	sessionHandler    *handlers.SessionHandler
+	websocketHandler  *handlers.WebSocketHandler
+	chatHandler       *handlers.ChatHandler
+	terminalHandler   *handlers.TerminalHandler
+	claudeHandler     *handlers.ClaudeHandler
+	permissionHandler *handlers.PermissionHandler
+	attemptHandler    *handlers.AttemptHandler
+	mcpServerHandler  *handlers.MCPServerHandler
+	budgetHandler     *handlers.BudgetHandler
+	webAssets         embed.FS
+	authConfig        *config.AuthConfig
 }
 
 func NewRouter(
@@ -29,13 +34,23 @@ func NewRouter(
 	websocketHandler *handlers.WebSocketHandler,
 	chatHandler *handlers.ChatHandler,
 	terminalHandler *handlers.TerminalHandler,
+	claudeHandler *handlers.ClaudeHandler,
+	permissionHandler *handlers.PermissionHandler,
+	attemptHandler *handlers.AttemptHandler,
+	mcpServerHandler *handlers.MCPServerHandler,
+	budgetHandler *handlers.BudgetHandler,
 ) *Router {
 	return &Router{
-		projectHandler:   projectHandler,
-		sessionHandler:   sessionHandler,
-		websocketHandler: websocketHandler,
-		chatHandler:      chatHandler,
-		terminalHandler:  terminalHandler,
+		projectHandler:    projectHandler,
+		sessionHandler:    sessionHandler,
+		websocketHandler:  websocketHandler,
+		chatHandler:       chatHandler,
+		terminalHandler:   terminalHandler,
+		claudeHandler:     claudeHandler,
+		permissionHandler: permissionHandler,
+		attemptHandler:    attemptHandler,
+		mcpServerHandler:  mcpServerHandler,
+		budgetHandler:     budgetHandler,
 	}
 }
 
@@ -52,11 +67,22 @@ func (r *Router) SetupRoutes(engine *gin.Engine) {
 	engine.Use(middleware.CORS())
 	engine.Use(middleware.Logger())
 
+	// Permission prompt tool called by running agents (MCP over HTTP). The per-run token
+	// in the Authorization header authenticates it, so it is registered before basic auth
+	// applies and agents never get the server's credentials. A header keeps the token out
+	// of the request log.
+	engine.POST("/api/mcp/permissions", r.permissionHandler.HandleMCP)
+	engine.GET("/api/mcp/permissions", r.permissionHandler.HandleMCPStream)
+
 	// Apply auth middleware if configured
 	if r.authConfig != nil {
 		engine.Use(middleware.BasicAuth(r.authConfig))
 	}
 
+	// Admin-only endpoints need the admin token, and are closed when none is configured
+	engine.Use(middleware.AdminToken(r.authConfig))
+	admin := middleware.RequireAdmin()
+
 	// API routes
 	api := engine.Group("/api")
 
@@ -74,6 +100,13 @@ func (r *Router) SetupRoutes(engine *gin.Engine) {
 		projects.GET("/stats", r.projectHandler.GetProjectStats)
 		projects.POST("/:id/run-startup-script", r.projectHandler.RunStartupScript)
 		projects.GET("/file", r.projectHandler.GetProjectFile)
+		projects.GET("/:id/usage", r.claudeHandler.GetProjectUsage)
+		projects.GET("/:id/attempts", r.attemptHandler.GetProjectAttemptGroups)
+		projects.GET("/:id/mcp-servers", r.mcpServerHandler.GetProjectServers)
+		projects.POST("/:id/mcp-servers", r.mcpServerHandler.CreateServer)
+		projects.GET("/:id/budget", r.budgetHandler.GetProjectBudget)
+		projects.POST("/:id/budget/override", admin, r.budgetHandler.OverrideProjectBudget)
+		projects.DELETE("/:id/budget/override", admin, r.budgetHandler.RevokeProjectBudgetOverride)
 	}
 
 	// Sessions routes
@@ -102,8 +135,77 @@ func (r *Router) SetupRoutes(engine *gin.Engine) {
 		sessions.GET("/:id/chat", r.chatHandler.GetSessionChatHistory)
 		sessions.DELETE("/:id/chat", r.chatHandler.DeleteSessionChatHistory)
 		sessions.POST("/:id/chat", r.chatHandler.SendChatMessage)
-	}
+		sessions.POST("/:id/chat/rebuild", admin, r.claudeHandler.RebuildChatHistory)
 
+		// Claude conversations for sessions
+		sessions.GET("/:id/conversations", r.claudeHandler.GetConversations)
+		sessions.POST("/:id/conversations/resume", r.claudeHandler.ResumeConversation)
+		sessions.POST("/:id/conversations/new", r.claudeHandler.NewConversation)
+		
+		// Claude turns and usage for sessions
+		sessions.GET("/:id/turns", r.claudeHandler.GetSessionTurns)
+		sessions.GET("/:id/usage", r.claudeHandler.GetSessionUsage)
+		
+		// Task list the agent keeps with TodoWrite
+		sessions.GET("/:id/todos", r.claudeHandler.GetTodos)
+		sessions.GET("/:id/todos/history", r.claudeHandler.GetTodoHistory)
+		
+		// Checks run after each turn
+		sessions.GET("/:id/validation", r.claudeHandler.GetSessionValidation)
+		
+		// Prompts waiting for a session's running turn
+		sessions.GET("/:id/queue", r.claudeHandler.GetQueue)
+		sessions.PUT("/:id/queue", r.claudeHandler.ReorderQueue)
+		sessions.DELETE("/:id/queue", r.claudeHandler.ClearQueue)
+		sessions.DELETE("/:id/queue/:promptId", r.claudeHandler.CancelQueuedPrompt)
+		sessions.GET("/:id/usage-limit", r.claudeHandler.GetUsageLimit)
+		sessions.DELETE("/:id/usage-limit", r.claudeHandler.RetryUsageLimit)
+		
+		// Tool permission prompts
+		sessions.GET("/:id/permissions", r.permissionHandler.GetPendingPermissions)
+		sessions.POST("/:id/permissions/:requestId", r.permissionHandler.RespondPermission)
+		
+		// MCP servers of the project the session loads
+		sessions.GET("/:id/mcp-servers", r.mcpServerHandler.GetSessionServers)
+		sessions.PUT("/:id/mcp-servers/:serverId", r.mcpServerHandler.SetSessionServer)
+		sessions.DELETE("/:id/mcp-servers/:serverId", r.mcpServerHandler.ResetSessionServer)
+		
+		// Spend budgets
+		sessions.GET("/:id/budget", r.budgetHandler.GetSessionBudget)
+		sessions.POST("/:id/budget/override", admin, r.budgetHandler.OverrideSessionBudget)
+		sessions.DELETE("/:id/budget/override", admin, r.budgetHandler.RevokeSessionBudgetOverride)
+	}
+	
+	// Turns routes
+	turns := api.Group("/turns")
+	{
+		turns.GET("/:id", r.claudeHandler.GetTurn)
+		turns.GET("/:id/transcript", r.claudeHandler.GetTurnTranscript)
+		turns.GET("/:id/diff", r.claudeHandler.GetTurnDiff)
+		turns.POST("/:id/restore", r.claudeHandler.RestoreTurnSnapshot)
+		turns.GET("/:id/validation", r.claudeHandler.GetTurnValidation)
+	}
+	
+	// Best-of-N runs: one prompt in several sessions
+	attempts := api.Group("/attempts")
+	{
+		attempts.POST("", r.attemptHandler.CreateAttemptGroup)
+		attempts.GET("/:id", r.attemptHandler.GetAttemptGroup)
+		attempts.GET("/:id/compare", r.attemptHandler.CompareAttempts)
+		attempts.POST("/:id/keep", r.attemptHandler.KeepAttempt)
+	}
+	
+	// MCP server definitions registered for projects
+	mcpServers := api.Group("/mcp-servers")
+	{
+		mcpServers.GET("/:id", r.mcpServerHandler.GetServer)
+		mcpServers.PUT("/:id", r.mcpServerHandler.UpdateServer)
+		mcpServers.DELETE("/:id", r.mcpServerHandler.DeleteServer)
+	}
+	
+	// Agent backends available to projects and sessions
+	api.GET("/agents/backends", r.claudeHandler.GetAgentBackends)
+	
 	// WebSocket endpoint
 	api.GET("/ws", r.websocketHandler.HandleWebSocket)
 
@@ -141,6 +243,13 @@ func (r *Router) SetupRoutes(engine *gin.Engine) {
 			v1Projects.GET("/stats", r.projectHandler.GetProjectStats)
 			v1Projects.POST("/:id/run-startup-script", r.projectHandler.RunStartupScript)
 			v1Projects.GET("/file", r.projectHandler.GetProjectFile)
+			v1Projects.GET("/:id/usage", r.claudeHandler.GetProjectUsage)
+			v1Projects.GET("/:id/attempts", r.attemptHandler.GetProjectAttemptGroups)
+			v1Projects.GET("/:id/mcp-servers", r.mcpServerHandler.GetProjectServers)
+			v1Projects.POST("/:id/mcp-servers", r.mcpServerHandler.CreateServer)
+			v1Projects.GET("/:id/budget", r.budgetHandler.GetProjectBudget)
+			v1Projects.POST("/:id/budget/override", admin, r.budgetHandler.OverrideProjectBudget)
+			v1Projects.DELETE("/:id/budget/override", admin, r.budgetHandler.RevokeProjectBudgetOverride)
 		}
 
 		// Sessions routes
@@ -160,9 +269,59 @@ func (r *Router) SetupRoutes(engine *gin.Engine) {
 			v1Sessions.GET("/:id/chat", r.chatHandler.GetSessionChatHistory)
 			v1Sessions.DELETE("/:id/chat", r.chatHandler.DeleteSessionChatHistory)
 			v1Sessions.POST("/:id/chat", r.chatHandler.SendChatMessage)
+			v1Sessions.POST("/:id/chat/rebuild", admin, r.claudeHandler.RebuildChatHistory)
+			v1Sessions.GET("/:id/conversations", r.claudeHandler.GetConversations)
+			v1Sessions.POST("/:id/conversations/resume", r.claudeHandler.ResumeConversation)
+			v1Sessions.POST("/:id/conversations/new", r.claudeHandler.NewConversation)
+			v1Sessions.GET("/:id/turns", r.claudeHandler.GetSessionTurns)
+			v1Sessions.GET("/:id/usage", r.claudeHandler.GetSessionUsage)
+			v1Sessions.GET("/:id/todos", r.claudeHandler.GetTodos)
+			v1Sessions.GET("/:id/todos/history", r.claudeHandler.GetTodoHistory)
+			v1Sessions.GET("/:id/validation", r.claudeHandler.GetSessionValidation)
+			v1Sessions.GET("/:id/queue", r.claudeHandler.GetQueue)
+			v1Sessions.PUT("/:id/queue", r.claudeHandler.ReorderQueue)
+			v1Sessions.DELETE("/:id/queue", r.claudeHandler.ClearQueue)
+			v1Sessions.DELETE("/:id/queue/:promptId", r.claudeHandler.CancelQueuedPrompt)
+			v1Sessions.GET("/:id/usage-limit", r.claudeHandler.GetUsageLimit)
+			v1Sessions.DELETE("/:id/usage-limit", r.claudeHandler.RetryUsageLimit)
+			v1Sessions.GET("/:id/permissions", r.permissionHandler.GetPendingPermissions)
+			v1Sessions.POST("/:id/permissions/:requestId", r.permissionHandler.RespondPermission)
+			v1Sessions.GET("/:id/mcp-servers", r.mcpServerHandler.GetSessionServers)
+			v1Sessions.PUT("/:id/mcp-servers/:serverId", r.mcpServerHandler.SetSessionServer)
+			v1Sessions.DELETE("/:id/mcp-servers/:serverId", r.mcpServerHandler.ResetSessionServer)
+			v1Sessions.GET("/:id/budget", r.budgetHandler.GetSessionBudget)
+			v1Sessions.POST("/:id/budget/override", admin, r.budgetHandler.OverrideSessionBudget)
+			v1Sessions.DELETE("/:id/budget/override", admin, r.budgetHandler.RevokeSessionBudgetOverride)
 			v1Sessions.POST("/:id/open-editor", r.sessionHandler.OpenWithEditor)
 			v1Sessions.POST("/:id/run-startup-script", r.sessionHandler.RunStartupScript)
 		}
+		
+		// Turns routes
+		v1Turns := v1.Group("/turns")
+		{
+			v1Turns.GET("/:id", r.claudeHandler.GetTurn)
+			v1Turns.GET("/:id/transcript", r.claudeHandler.GetTurnTranscript)
+			v1Turns.GET("/:id/diff", r.claudeHandler.GetTurnDiff)
+			v1Turns.POST("/:id/restore", r.claudeHandler.RestoreTurnSnapshot)
+			v1Turns.GET("/:id/validation", r.claudeHandler.GetTurnValidation)
+		}
+		
+		v1Attempts := v1.Group("/attempts")
+		{
+			v1Attempts.POST("", r.attemptHandler.CreateAttemptGroup)
+			v1Attempts.GET("/:id", r.attemptHandler.GetAttemptGroup)
+			v1Attempts.GET("/:id/compare", r.attemptHandler.CompareAttempts)
+			v1Attempts.POST("/:id/keep", r.attemptHandler.KeepAttempt)
+		}
+		
+		v1MCPServers := v1.Group("/mcp-servers")
+		{
+			v1MCPServers.GET("/:id", r.mcpServerHandler.GetServer)
+			v1MCPServers.PUT("/:id", r.mcpServerHandler.UpdateServer)
+			v1MCPServers.DELETE("/:id", r.mcpServerHandler.DeleteServer)
+		}
+		
+		v1.GET("/agents/backends", r.claudeHandler.GetAgentBackends)
 	}
 
 	// Serve static files if webAssets is set
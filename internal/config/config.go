@@ -32,6 +32,8 @@ type AuthConfig struct {
 	Enabled  bool   `mapstructure:"enabled"`
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
+	// AdminToken is required in X-Admin-Token for admin endpoints; empty disables them
+	AdminToken string `mapstructure:"admin_token"`
 }
 
 type DatabaseConfig struct {
@@ -48,12 +50,41 @@ type ProjectsConfig struct {
 }
 
 type AgentsConfig struct {
-	DefaultTimeout       time.Duration  `mapstructure:"default_timeout"`
-	MaxConcurrent        int            `mapstructure:"max_concurrent"`
-	HealthCheckInterval  time.Duration  `mapstructure:"health_check_interval"`
-	LogRetentionDays     int            `mapstructure:"log_retention_days"`
-	ResourceLimits       ResourceLimits `mapstructure:"resource_limits"`
-	ClaudeBinaryPath     string         `mapstructure:"claude_binary_path"`
+	DefaultTimeout          time.Duration  `mapstructure:"default_timeout"`
+	NoOutputTimeout         time.Duration  `mapstructure:"no_output_timeout"`
+	StopGracePeriod         time.Duration  `mapstructure:"stop_grace_period"`
+	MaxConcurrent           int            `mapstructure:"max_concurrent"`
+	MaxConcurrentPerProject int            `mapstructure:"max_concurrent_per_project"`
+	HealthCheckInterval     time.Duration  `mapstructure:"health_check_interval"`
+	LogRetentionDays        int            `mapstructure:"log_retention_days"`
+	ResourceLimits          ResourceLimits `mapstructure:"resource_limits"`
+	ClaudeBinaryPath        string         `mapstructure:"claude_binary_path"`
+	// Permission mode for projects and sessions that do not set one
+	PermissionMode string `mapstructure:"permission_mode"`
+	// How long a tool permission prompt waits for a viewer, and what happens after
+	PermissionPromptTimeout time.Duration `mapstructure:"permission_prompt_timeout"`
+	PermissionPromptDefault string        `mapstructure:"permission_prompt_default"`
+	// Base URL agents use to reach habibi; defaults to the server's host and port
+	PermissionPromptURL string `mapstructure:"permission_prompt_url"`
+	// Kill agent processes a previous server left running in session worktrees
+	KillOrphansOnStartup bool `mapstructure:"kill_orphans_on_startup"`
+	// Stream Claude's answers token by token instead of a message at a time
+	StreamPartialMessages bool `mapstructure:"stream_partial_messages"`
+	// Keep one Claude process per session, fed prompts over stdin, and close it after the idle timeout
+	PersistentProcesses   bool          `mapstructure:"persistent_processes"`
+	PersistentIdleTimeout time.Duration `mapstructure:"persistent_idle_timeout"`
+	// How long to wait before retrying a turn that hit a limit which did not say when it resets
+	UsageLimitRetryDelay time.Duration `mapstructure:"usage_limit_retry_delay"`
+	// Extra agent CLIs, keyed by the name projects and sessions select them with
+	Backends map[string]AgentBackendConfig `mapstructure:"backends"`
+}
+
+// AgentBackendConfig describes an agent CLI run through the generic command adapter
+type AgentBackendConfig struct {
+	Command string   `mapstructure:"command"`
+	Args    []string `mapstructure:"args"`
+	// Output is "text" (plain stdout) or "jsonl" (one agent event per line)
+	Output string `mapstructure:"output"`
 }
 
 type ResourceLimits struct {
@@ -126,6 +157,7 @@ func setDefaults() {
 	viper.SetDefault("server.auth.enabled", false)
 	viper.SetDefault("server.auth.username", "")
 	viper.SetDefault("server.auth.password", "")
+	viper.SetDefault("server.auth.admin_token", "")
 	
 	// Database defaults
 	viper.SetDefault("database.path", "~/.habibi-go/data.db")
@@ -140,12 +172,23 @@ func setDefaults() {
 	
 	// Agents defaults
 	viper.SetDefault("agents.default_timeout", "30m")
+	viper.SetDefault("agents.no_output_timeout", "10m")
+	viper.SetDefault("agents.stop_grace_period", "5s")
 	viper.SetDefault("agents.max_concurrent", 10)
+	viper.SetDefault("agents.max_concurrent_per_project", 0)
 	viper.SetDefault("agents.health_check_interval", "30s")
 	viper.SetDefault("agents.log_retention_days", 7)
 	viper.SetDefault("agents.resource_limits.memory_mb", 1024)
 	viper.SetDefault("agents.resource_limits.cpu_percent", 50)
 	viper.SetDefault("agents.claude_binary_path", "claude")
+	viper.SetDefault("agents.permission_mode", "bypassPermissions")
+	viper.SetDefault("agents.permission_prompt_timeout", "5m")
+	viper.SetDefault("agents.permission_prompt_default", "deny")
+	viper.SetDefault("agents.kill_orphans_on_startup", false)
+	viper.SetDefault("agents.stream_partial_messages", true)
+	viper.SetDefault("agents.persistent_processes", false)
+	viper.SetDefault("agents.persistent_idle_timeout", "15m")
+	viper.SetDefault("agents.usage_limit_retry_delay", "5m")
 	
 	// Slack defaults
 	viper.SetDefault("slack.enabled", false)
@@ -125,10 +125,23 @@ func (db *DB) RunMigrations() error {
 			tool_content TEXT,
 			FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
 		)`,
+		`CREATE TABLE IF NOT EXISTS turns (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id INTEGER NOT NULL,
+			claude_session_id TEXT,
+			prompt TEXT NOT NULL,
+			status TEXT DEFAULT 'running',
+			error TEXT,
+			started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			completed_at DATETIME,
+			FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+		)`,
 		`CREATE INDEX IF NOT EXISTS idx_sessions_project_id ON sessions(project_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_events_created_at ON events(created_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_events_entity ON events(entity_type, entity_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_chat_messages_session_id ON chat_messages(session_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_turns_session_id ON turns(session_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_turns_claude_session_id ON turns(claude_session_id)`,
 	}
 	
 	for i, migration := range migrations {
@@ -152,7 +165,7 @@ func (db *DB) RunMigrations() error {
 		return fmt.Errorf("failed to add last_activity_at column: %w", err)
 	}
 	
-	if err := db.addColumnIfNotExists("sessions", "activity_status", "TEXT DEFAULT 'idle' CHECK(activity_status IN ('idle', 'streaming', 'new', 'viewed'))"); err != nil {
+	if err := db.addColumnIfNotExists("sessions", "activity_status", "TEXT DEFAULT 'idle' CHECK(activity_status IN ('idle', 'streaming', 'new', 'viewed', 'waiting_limit'))"); err != nil {
 		return fmt.Errorf("failed to add activity_status column: %w", err)
 	}
 	
@@ -167,9 +180,259 @@ func (db *DB) RunMigrations() error {
 		return fmt.Errorf("failed to fix session status constraint: %w", err)
 	}
 	
+	// Track the Claude conversation each session continues
+	if err := db.addColumnIfNotExists("sessions", "claude_session_id", "TEXT"); err != nil {
+		return fmt.Errorf("failed to add claude_session_id column: %w", err)
+	}
+	
+	// Sessions wait out agent usage limits in their own activity status
+	if err := db.fixActivityStatusConstraint(); err != nil {
+		return fmt.Errorf("failed to fix activity status constraint: %w", err)
+	}
+	
+	// Agent backend the session's conversation belongs to; added after the table rebuilds above
+	if err := db.addColumnIfNotExists("sessions", "conversation_backend", "TEXT"); err != nil {
+		return fmt.Errorf("failed to add conversation_backend column: %w", err)
+	}
+	
+	// Usage reported by Claude's result message for each turn
+	turnUsageColumns := []struct{ name, def string }{
+		{"input_tokens", "INTEGER DEFAULT 0"},
+		{"output_tokens", "INTEGER DEFAULT 0"},
+		{"cache_creation_input_tokens", "INTEGER DEFAULT 0"},
+		{"cache_read_input_tokens", "INTEGER DEFAULT 0"},
+		{"total_cost_usd", "REAL DEFAULT 0"},
+		{"duration_ms", "INTEGER DEFAULT 0"},
+		{"duration_api_ms", "INTEGER DEFAULT 0"},
+		{"num_turns", "INTEGER DEFAULT 0"},
+		{"is_error", "BOOLEAN DEFAULT 0"},
+		{"result_subtype", "TEXT"},
+	}
+	for _, col := range turnUsageColumns {
+		if err := db.addColumnIfNotExists("turns", col.name, col.def); err != nil {
+			return fmt.Errorf("failed to add turns.%s column: %w", col.name, err)
+		}
+	}
+	
+	// Link chat messages to the turn that produced them
+	if err := db.addColumnIfNotExists("chat_messages", "turn_id", "INTEGER REFERENCES turns(id) ON DELETE SET NULL"); err != nil {
+		return fmt.Errorf("failed to add chat_messages.turn_id column: %w", err)
+	}
+	
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_chat_messages_turn_id ON chat_messages(turn_id)`); err != nil {
+		return fmt.Errorf("failed to create chat_messages turn_id index: %w", err)
+	}
+	
+	// Agent backend that ran each turn
+	if err := db.addColumnIfNotExists("turns", "backend", "TEXT DEFAULT 'claude'"); err != nil {
+		return fmt.Errorf("failed to add turns.backend column: %w", err)
+	}
+	
+	// Model settings each turn ran with
+	turnSettingsColumns := []struct{ name, def string }{
+		{"model", "TEXT"},
+		{"max_turns", "INTEGER DEFAULT 0"},
+		{"append_system_prompt", "TEXT"},
+	}
+	for _, col := range turnSettingsColumns {
+		if err := db.addColumnIfNotExists("turns", col.name, col.def); err != nil {
+			return fmt.Errorf("failed to add turns.%s column: %w", col.name, err)
+		}
+	}
+	
+	// Sub-agent nesting and non-text content of chat messages
+	chatMessageContentColumns := []struct{ name, def string }{
+		{"parent_tool_use_id", "TEXT"},
+		{"content_type", "TEXT"},
+		{"content_data", "TEXT"},
+	}
+	for _, col := range chatMessageContentColumns {
+		if err := db.addColumnIfNotExists("chat_messages", col.name, col.def); err != nil {
+			return fmt.Errorf("failed to add chat_messages.%s column: %w", col.name, err)
+		}
+	}
+	
+	// Worktree snapshots taken around each turn
+	turnSnapshotColumns := []struct{ name, def string }{
+		{"snapshot_before", "TEXT"},
+		{"snapshot_after", "TEXT"},
+	}
+	for _, col := range turnSnapshotColumns {
+		if err := db.addColumnIfNotExists("turns", col.name, col.def); err != nil {
+			return fmt.Errorf("failed to add turns.%s column: %w", col.name, err)
+		}
+	}
+	
+	// Raw agent output of each turn, gzip compressed, for rebuilding chat history
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS turn_transcripts (
+		turn_id INTEGER PRIMARY KEY,
+		backend TEXT NOT NULL,
+		data BLOB NOT NULL,
+		line_count INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (turn_id) REFERENCES turns(id) ON DELETE CASCADE
+	)`); err != nil {
+		return fmt.Errorf("failed to create turn_transcripts table: %w", err)
+	}
+	
+	// When each transcript line arrived, so rebuilt messages keep their times
+	if err := db.addColumnIfNotExists("turn_transcripts", "line_times", "TEXT"); err != nil {
+		return fmt.Errorf("failed to add turn_transcripts.line_times column: %w", err)
+	}
+	
+	// Task lists agents write with TodoWrite, one row per call
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS session_todos (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER NOT NULL,
+		turn_id INTEGER REFERENCES turns(id) ON DELETE SET NULL,
+		tool_use_id TEXT,
+		todos TEXT NOT NULL DEFAULT '[]',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+	)`); err != nil {
+		return fmt.Errorf("failed to create session_todos table: %w", err)
+	}
+	
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_session_todos_session_id ON session_todos(session_id)`); err != nil {
+		return fmt.Errorf("failed to create session_todos session_id index: %w", err)
+	}
+	
+	// Sessions from before session_todos get their latest list from the chat history
+	if _, err := db.Exec(backfillSessionTodos); err != nil {
+		return fmt.Errorf("failed to backfill session_todos: %w", err)
+	}
+	
+	// Checks run in the worktree after each turn
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS validation_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER NOT NULL,
+		turn_id INTEGER NOT NULL,
+		iteration INTEGER DEFAULT 0,
+		passed BOOLEAN DEFAULT 0,
+		results TEXT NOT NULL DEFAULT '[]',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE,
+		FOREIGN KEY (turn_id) REFERENCES turns(id) ON DELETE CASCADE
+	)`); err != nil {
+		return fmt.Errorf("failed to create validation_runs table: %w", err)
+	}
+	
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_validation_runs_turn_id ON validation_runs(turn_id)`); err != nil {
+		return fmt.Errorf("failed to create validation_runs turn_id index: %w", err)
+	}
+	
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS attempt_groups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		prompt TEXT NOT NULL,
+		base_branch TEXT DEFAULT '',
+		status TEXT DEFAULT 'open',
+		kept_session_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		decided_at DATETIME,
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	)`); err != nil {
+		return fmt.Errorf("failed to create attempt_groups table: %w", err)
+	}
+	
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS attempts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		group_id INTEGER NOT NULL,
+		number INTEGER NOT NULL,
+		session_id INTEGER NOT NULL,
+		session_name TEXT NOT NULL,
+		branch_name TEXT NOT NULL,
+		status TEXT DEFAULT 'open',
+		FOREIGN KEY (group_id) REFERENCES attempt_groups(id) ON DELETE CASCADE
+	)`); err != nil {
+		return fmt.Errorf("failed to create attempts table: %w", err)
+	}
+	
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_attempts_group_id ON attempts(group_id)`); err != nil {
+		return fmt.Errorf("failed to create attempts group_id index: %w", err)
+	}
+	
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS mcp_servers (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL DEFAULT 'stdio',
+		command TEXT DEFAULT '',
+		args TEXT NOT NULL DEFAULT '[]',
+		env TEXT NOT NULL DEFAULT '{}',
+		url TEXT DEFAULT '',
+		headers TEXT NOT NULL DEFAULT '{}',
+		enabled BOOLEAN DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+		UNIQUE(project_id, name)
+	)`); err != nil {
+		return fmt.Errorf("failed to create mcp_servers table: %w", err)
+	}
+	
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS session_mcp_servers (
+		session_id INTEGER NOT NULL,
+		mcp_server_id INTEGER NOT NULL,
+		enabled BOOLEAN NOT NULL,
+		PRIMARY KEY (session_id, mcp_server_id),
+		FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE,
+		FOREIGN KEY (mcp_server_id) REFERENCES mcp_servers(id) ON DELETE CASCADE
+	)`); err != nil {
+		return fmt.Errorf("failed to create session_mcp_servers table: %w", err)
+	}
+	
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS budget_overrides (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER NOT NULL,
+		session_id INTEGER,
+		reason TEXT DEFAULT '',
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+		FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+	)`); err != nil {
+		return fmt.Errorf("failed to create budget_overrides table: %w", err)
+	}
+	
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_budget_overrides_project_id ON budget_overrides(project_id)`); err != nil {
+		return fmt.Errorf("failed to create budget_overrides project_id index: %w", err)
+	}
+	
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS usage_limit_waits (
+		session_id INTEGER PRIMARY KEY,
+		turn_id INTEGER,
+		prompt TEXT NOT NULL,
+		validation_iteration INTEGER DEFAULT 0,
+		message TEXT DEFAULT '',
+		reset_at DATETIME NOT NULL,
+		exact BOOLEAN DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+	)`); err != nil {
+		return fmt.Errorf("failed to create usage_limit_waits table: %w", err)
+	}
+	
 	return nil
 }
 
+// backfillSessionTodos copies the latest TodoWrite call of the main agent from the chat
+// history of every session that has no task list yet
+const backfillSessionTodos = `
+	INSERT INTO session_todos (session_id, turn_id, tool_use_id, todos, created_at)
+	SELECT session_id, turn_id, tool_use_id, json_extract(tool_input, '$.todos'), created_at
+	FROM chat_messages
+	WHERE id IN (
+		SELECT MAX(id) FROM chat_messages
+		WHERE role = 'tool_use' AND tool_name = 'TodoWrite'
+		  AND (parent_tool_use_id IS NULL OR parent_tool_use_id = '')
+		  AND json_valid(tool_input) AND json_type(tool_input, '$.todos') = 'array'
+		GROUP BY session_id
+	)
+	AND session_id NOT IN (SELECT session_id FROM session_todos)
+`
+
 func (db *DB) Close() error {
 	return db.DB.Close()
 }
@@ -319,7 +582,7 @@ func (db *DB) fixSessionStatusConstraint() error {
 			last_used_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			original_branch TEXT,
 			last_activity_at DATETIME,
-			activity_status TEXT DEFAULT 'idle' CHECK(activity_status IN ('idle', 'streaming', 'new', 'viewed')),
+			activity_status TEXT DEFAULT 'idle' CHECK(activity_status IN ('idle', 'streaming', 'new', 'viewed', 'waiting_limit')),
 			last_viewed_at DATETIME,
 			FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
 			UNIQUE(project_id, name)
@@ -382,6 +645,82 @@ func (db *DB) fixSessionStatusConstraint() error {
 	return tx.Commit()
 }
 
+// fixActivityStatusConstraint lets sessions use the 'waiting_limit' activity status. The
+// sessions table is rebuilt from its current definition, keeping every column.
+func (db *DB) fixActivityStatusConstraint() error {
+	var tableSQL string
+	err := db.QueryRow(`
+		SELECT sql FROM sqlite_master 
+		WHERE type='table' AND name='sessions'
+	`).Scan(&tableSQL)
+	
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return fmt.Errorf("failed to check sessions table: %w", err)
+	}
+	
+	if strings.Contains(tableSQL, "waiting_limit") {
+		return nil
+	}
+	
+	fmt.Println("Updating sessions table to support the 'waiting_limit' activity status...")
+	
+	newSQL := strings.Replace(tableSQL, "CREATE TABLE sessions", "CREATE TABLE sessions_new", 1)
+	newSQL = strings.Replace(newSQL, "'new', 'viewed')", "'new', 'viewed', 'waiting_limit')", 1)
+	if !strings.Contains(newSQL, "sessions_new") || !strings.Contains(newSQL, "waiting_limit") {
+		return fmt.Errorf("unexpected sessions table definition: %s", tableSQL)
+	}
+	
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	
+	if _, err := tx.Exec(newSQL); err != nil {
+		return fmt.Errorf("failed to create new sessions table: %w", err)
+	}
+	
+	columns := []string{}
+	rows, err := tx.Query(`PRAGMA table_info(sessions)`)
+	if err != nil {
+		return fmt.Errorf("failed to get table info: %w", err)
+	}
+	for rows.Next() {
+		var cid int
+		var name, dtype string
+		var notnull, pk int
+		var dfltValue sql.NullString
+		if err := rows.Scan(&cid, &name, &dtype, &notnull, &dfltValue, &pk); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan column info: %w", err)
+		}
+		columns = append(columns, name)
+	}
+	rows.Close()
+	
+	columnList := strings.Join(columns, ", ")
+	if _, err := tx.Exec(fmt.Sprintf(`INSERT INTO sessions_new (%s) SELECT %s FROM sessions`, columnList, columnList)); err != nil {
+		return fmt.Errorf("failed to copy sessions: %w", err)
+	}
+	
+	if _, err := tx.Exec(`DROP TABLE sessions`); err != nil {
+		return fmt.Errorf("failed to drop old sessions table: %w", err)
+	}
+	
+	if _, err := tx.Exec(`ALTER TABLE sessions_new RENAME TO sessions`); err != nil {
+		return fmt.Errorf("failed to rename sessions table: %w", err)
+	}
+	
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_sessions_project_id ON sessions(project_id)`); err != nil {
+		return fmt.Errorf("failed to recreate index: %w", err)
+	}
+	
+	return tx.Commit()
+}
+
 // simplifyAgentArchitecture migrates from agent-based to session-based chat
 func (db *DB) simplifyAgentArchitecture() error {
 	// Check if we've already migrated
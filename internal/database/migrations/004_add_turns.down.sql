@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_turns_claude_session_id;
+DROP INDEX IF EXISTS idx_turns_session_id;
+DROP TABLE IF EXISTS turns;
+
+ALTER TABLE sessions DROP COLUMN claude_session_id;
@@ -0,0 +1,18 @@
+-- Turns table (one row per Claude run)
+CREATE TABLE turns (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER NOT NULL,
+    claude_session_id TEXT,
+    prompt TEXT NOT NULL,
+    status TEXT DEFAULT 'running',
+    error TEXT,
+    started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    completed_at DATETIME,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_turns_session_id ON turns(session_id);
+CREATE INDEX idx_turns_claude_session_id ON turns(claude_session_id);
+
+-- Claude conversation the session continues on its next turn
+ALTER TABLE sessions ADD COLUMN claude_session_id TEXT;
@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS idx_chat_messages_turn_id;
+ALTER TABLE chat_messages DROP COLUMN turn_id;
+
+ALTER TABLE turns DROP COLUMN result_subtype;
+ALTER TABLE turns DROP COLUMN is_error;
+ALTER TABLE turns DROP COLUMN num_turns;
+ALTER TABLE turns DROP COLUMN duration_api_ms;
+ALTER TABLE turns DROP COLUMN duration_ms;
+ALTER TABLE turns DROP COLUMN total_cost_usd;
+ALTER TABLE turns DROP COLUMN cache_read_input_tokens;
+ALTER TABLE turns DROP COLUMN cache_creation_input_tokens;
+ALTER TABLE turns DROP COLUMN output_tokens;
+ALTER TABLE turns DROP COLUMN input_tokens;
@@ -0,0 +1,16 @@
+-- Usage reported by Claude's result message for each turn
+ALTER TABLE turns ADD COLUMN input_tokens INTEGER DEFAULT 0;
+ALTER TABLE turns ADD COLUMN output_tokens INTEGER DEFAULT 0;
+ALTER TABLE turns ADD COLUMN cache_creation_input_tokens INTEGER DEFAULT 0;
+ALTER TABLE turns ADD COLUMN cache_read_input_tokens INTEGER DEFAULT 0;
+ALTER TABLE turns ADD COLUMN total_cost_usd REAL DEFAULT 0;
+ALTER TABLE turns ADD COLUMN duration_ms INTEGER DEFAULT 0;
+ALTER TABLE turns ADD COLUMN duration_api_ms INTEGER DEFAULT 0;
+ALTER TABLE turns ADD COLUMN num_turns INTEGER DEFAULT 0;
+ALTER TABLE turns ADD COLUMN is_error BOOLEAN DEFAULT 0;
+ALTER TABLE turns ADD COLUMN result_subtype TEXT;
+
+-- Link chat messages to the turn that produced them
+ALTER TABLE chat_messages ADD COLUMN turn_id INTEGER REFERENCES turns(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_chat_messages_turn_id ON chat_messages(turn_id);
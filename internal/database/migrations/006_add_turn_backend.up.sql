@@ -0,0 +1,2 @@
+-- Agent backend that ran each turn
+ALTER TABLE turns ADD COLUMN backend TEXT DEFAULT 'claude';
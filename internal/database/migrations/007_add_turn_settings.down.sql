@@ -0,0 +1,3 @@
+ALTER TABLE turns DROP COLUMN append_system_prompt;
+ALTER TABLE turns DROP COLUMN max_turns;
+ALTER TABLE turns DROP COLUMN model;
@@ -0,0 +1,4 @@
+-- Model settings each turn ran with
+ALTER TABLE turns ADD COLUMN model TEXT;
+ALTER TABLE turns ADD COLUMN max_turns INTEGER DEFAULT 0;
+ALTER TABLE turns ADD COLUMN append_system_prompt TEXT;
@@ -0,0 +1,3 @@
+ALTER TABLE chat_messages DROP COLUMN content_data;
+ALTER TABLE chat_messages DROP COLUMN content_type;
+ALTER TABLE chat_messages DROP COLUMN parent_tool_use_id;
@@ -0,0 +1,4 @@
+-- Sub-agent nesting and non-text content of chat messages
+ALTER TABLE chat_messages ADD COLUMN parent_tool_use_id TEXT;
+ALTER TABLE chat_messages ADD COLUMN content_type TEXT;
+ALTER TABLE chat_messages ADD COLUMN content_data TEXT;
@@ -0,0 +1,9 @@
+-- Raw agent output of each turn, gzip compressed, for rebuilding chat history
+CREATE TABLE turn_transcripts (
+    turn_id INTEGER PRIMARY KEY,
+    backend TEXT NOT NULL,
+    data BLOB NOT NULL,
+    line_count INTEGER DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (turn_id) REFERENCES turns(id) ON DELETE CASCADE
+);
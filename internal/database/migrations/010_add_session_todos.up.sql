@@ -0,0 +1,24 @@
+-- Task lists agents write with TodoWrite, one row per call
+CREATE TABLE session_todos (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER NOT NULL,
+    turn_id INTEGER REFERENCES turns(id) ON DELETE SET NULL,
+    tool_use_id TEXT,
+    todos TEXT NOT NULL DEFAULT '[]',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_session_todos_session_id ON session_todos(session_id);
+
+-- Sessions start from the latest task list the main agent wrote before this table existed
+INSERT INTO session_todos (session_id, turn_id, tool_use_id, todos, created_at)
+SELECT session_id, turn_id, tool_use_id, json_extract(tool_input, '$.todos'), created_at
+FROM chat_messages
+WHERE id IN (
+    SELECT MAX(id) FROM chat_messages
+    WHERE role = 'tool_use' AND tool_name = 'TodoWrite'
+      AND (parent_tool_use_id IS NULL OR parent_tool_use_id = '')
+      AND json_valid(tool_input) AND json_type(tool_input, '$.todos') = 'array'
+    GROUP BY session_id
+);
@@ -0,0 +1,2 @@
+ALTER TABLE turns DROP COLUMN snapshot_after;
+ALTER TABLE turns DROP COLUMN snapshot_before;
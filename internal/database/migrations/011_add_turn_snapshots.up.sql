@@ -0,0 +1,3 @@
+-- Commits holding the worktree as it was before and after each turn
+ALTER TABLE turns ADD COLUMN snapshot_before TEXT;
+ALTER TABLE turns ADD COLUMN snapshot_after TEXT;
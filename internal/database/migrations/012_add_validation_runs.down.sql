@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_validation_runs_turn_id;
+DROP TABLE IF EXISTS validation_runs;
@@ -0,0 +1,14 @@
+-- Checks run in the worktree after each turn
+CREATE TABLE validation_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER NOT NULL,
+    turn_id INTEGER NOT NULL,
+    iteration INTEGER DEFAULT 0,
+    passed BOOLEAN DEFAULT 0,
+    results TEXT NOT NULL DEFAULT '[]',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (turn_id) REFERENCES turns(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_validation_runs_turn_id ON validation_runs(turn_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_attempts_group_id;
+DROP TABLE IF EXISTS attempts;
+DROP TABLE IF EXISTS attempt_groups;
@@ -0,0 +1,27 @@
+-- One prompt sent to several sessions at once
+CREATE TABLE attempt_groups (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    prompt TEXT NOT NULL,
+    base_branch TEXT DEFAULT '',
+    status TEXT DEFAULT 'open',
+    kept_session_id INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    decided_at DATETIME,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
+
+-- Attempts keep their session ID after the session is closed
+CREATE TABLE attempts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_id INTEGER NOT NULL,
+    number INTEGER NOT NULL,
+    session_id INTEGER NOT NULL,
+    session_name TEXT NOT NULL,
+    branch_name TEXT NOT NULL,
+    status TEXT DEFAULT 'open',
+    FOREIGN KEY (group_id) REFERENCES attempt_groups(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_attempts_group_id ON attempts(group_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS session_mcp_servers;
+DROP TABLE IF EXISTS mcp_servers;
@@ -0,0 +1,27 @@
+-- MCP servers a project's sessions can load
+CREATE TABLE mcp_servers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL DEFAULT 'stdio',
+    command TEXT DEFAULT '',
+    args TEXT NOT NULL DEFAULT '[]',
+    env TEXT NOT NULL DEFAULT '{}',
+    url TEXT DEFAULT '',
+    headers TEXT NOT NULL DEFAULT '{}',
+    enabled BOOLEAN DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    UNIQUE(project_id, name)
+);
+
+-- Sessions that turn a server on or off regardless of the project's default
+CREATE TABLE session_mcp_servers (
+    session_id INTEGER NOT NULL,
+    mcp_server_id INTEGER NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (session_id, mcp_server_id),
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (mcp_server_id) REFERENCES mcp_servers(id) ON DELETE CASCADE
+);
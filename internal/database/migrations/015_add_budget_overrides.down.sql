@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_budget_overrides_project_id;
+DROP TABLE IF EXISTS budget_overrides;
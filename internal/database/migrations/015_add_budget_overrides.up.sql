@@ -0,0 +1,13 @@
+-- Overrides letting a project's sessions, or one session, run past their budgets
+CREATE TABLE budget_overrides (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    session_id INTEGER,
+    reason TEXT DEFAULT '',
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_budget_overrides_project_id ON budget_overrides(project_id);
@@ -0,0 +1,28 @@
+-- Allow sessions to wait for an agent usage limit to reset
+-- SQLite can't change a CHECK constraint, so the sessions table is rebuilt
+CREATE TABLE sessions_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    branch_name TEXT NOT NULL,
+    original_branch TEXT,
+    worktree_path TEXT NOT NULL,
+    status TEXT DEFAULT 'active' CHECK(status IN ('active', 'paused', 'stopped', 'closed')),
+    config TEXT DEFAULT '{}',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_activity_at DATETIME,
+    activity_status TEXT DEFAULT 'idle' CHECK(activity_status IN ('idle', 'streaming', 'new', 'viewed', 'waiting_limit')),
+    last_viewed_at DATETIME,
+    claude_session_id TEXT,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    UNIQUE(project_id, name)
+);
+
+INSERT INTO sessions_new (id, project_id, name, branch_name, original_branch, worktree_path, status, config, created_at, last_used_at, last_activity_at, activity_status, last_viewed_at, claude_session_id)
+SELECT id, project_id, name, branch_name, original_branch, worktree_path, status, config, created_at, last_used_at, last_activity_at, activity_status, last_viewed_at, claude_session_id
+FROM sessions;
+
+DROP TABLE sessions;
+ALTER TABLE sessions_new RENAME TO sessions;
+CREATE INDEX IF NOT EXISTS idx_sessions_project_id ON sessions(project_id);
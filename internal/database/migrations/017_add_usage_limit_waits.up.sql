@@ -0,0 +1,12 @@
+-- Prompts kept for retry until a session's usage limit resets, so they survive a restart
+CREATE TABLE usage_limit_waits (
+    session_id INTEGER PRIMARY KEY,
+    turn_id INTEGER,
+    prompt TEXT NOT NULL,
+    validation_iteration INTEGER DEFAULT 0,
+    message TEXT DEFAULT '',
+    reset_at DATETIME NOT NULL,
+    exact BOOLEAN DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
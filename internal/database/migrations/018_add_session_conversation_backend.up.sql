@@ -0,0 +1,2 @@
+-- Agent backend the session's conversation ID belongs to
+ALTER TABLE sessions ADD COLUMN conversation_backend TEXT;
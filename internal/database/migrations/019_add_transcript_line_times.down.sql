@@ -0,0 +1 @@
+ALTER TABLE turn_transcripts DROP COLUMN line_times;
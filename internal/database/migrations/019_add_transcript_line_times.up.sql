@@ -0,0 +1,2 @@
+-- When each line of a turn's transcript arrived, as a JSON array of Unix milliseconds
+ALTER TABLE turn_transcripts ADD COLUMN line_times TEXT;
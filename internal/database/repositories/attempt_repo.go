@@ -0,0 +1,236 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"habibi-go/internal/models"
+)
+
+// AttemptRepository handles database operations for best-of-N attempt groups
+type AttemptRepository struct {
+	db *sql.DB
+}
+
+// NewAttemptRepository creates a new attempt repository
+func NewAttemptRepository(db *sql.DB) *AttemptRepository {
+	return &AttemptRepository{db: db}
+}
+
+// CreateGroup stores a new attempt group without its attempts
+func (r *AttemptRepository) CreateGroup(group *models.AttemptGroup) error {
+	if group.CreatedAt.IsZero() {
+		group.CreatedAt = time.Now()
+	}
+	if group.Status == "" {
+		group.Status = string(models.AttemptGroupStatusOpen)
+	}
+
+	result, err := r.db.Exec(
+		`INSERT INTO attempt_groups (project_id, name, prompt, base_branch, status, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		group.ProjectID,
+		group.Name,
+		group.Prompt,
+		group.BaseBranch,
+		group.Status,
+		group.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert attempt group: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	group.ID = int(id)
+	return nil
+}
+
+// CreateAttempt stores one attempt of a group
+func (r *AttemptRepository) CreateAttempt(attempt *models.Attempt) error {
+	if attempt.Status == "" {
+		attempt.Status = string(models.AttemptStatusOpen)
+	}
+
+	result, err := r.db.Exec(
+		`INSERT INTO attempts (group_id, number, session_id, session_name, branch_name, status)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		attempt.GroupID,
+		attempt.Number,
+		attempt.SessionID,
+		attempt.SessionName,
+		attempt.BranchName,
+		attempt.Status,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert attempt: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	attempt.ID = int(id)
+	return nil
+}
+
+// GetGroup retrieves an attempt group with its attempts
+func (r *AttemptRepository) GetGroup(id int) (*models.AttemptGroup, error) {
+	row := r.db.QueryRow(`
+		SELECT id, project_id, name, prompt, base_branch, status, kept_session_id, created_at, decided_at
+		FROM attempt_groups
+		WHERE id = ?
+	`, id)
+
+	group, err := scanAttemptGroup(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("attempt group not found")
+		}
+		return nil, fmt.Errorf("failed to get attempt group: %w", err)
+	}
+
+	if group.Attempts, err = r.getAttempts(group.ID); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// GetGroupsByProject retrieves a project's attempt groups, newest first
+func (r *AttemptRepository) GetGroupsByProject(projectID int) ([]*models.AttemptGroup, error) {
+	rows, err := r.db.Query(`
+		SELECT id, project_id, name, prompt, base_branch, status, kept_session_id, created_at, decided_at
+		FROM attempt_groups
+		WHERE project_id = ?
+		ORDER BY id DESC
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attempt groups: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []*models.AttemptGroup
+	for rows.Next() {
+		group, err := scanAttemptGroup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attempt group: %w", err)
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating attempt groups: %w", err)
+	}
+
+	for _, group := range groups {
+		if group.Attempts, err = r.getAttempts(group.ID); err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+// DeleteGroup removes an attempt group and its attempts
+func (r *AttemptRepository) DeleteGroup(id int) error {
+	if _, err := r.db.Exec(`DELETE FROM attempts WHERE group_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete attempts: %w", err)
+	}
+	if _, err := r.db.Exec(`DELETE FROM attempt_groups WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete attempt group: %w", err)
+	}
+	return nil
+}
+
+// UpdateAttemptStatus records whether an attempt was kept or closed
+func (r *AttemptRepository) UpdateAttemptStatus(id int, status models.AttemptStatus) error {
+	if _, err := r.db.Exec(`UPDATE attempts SET status = ? WHERE id = ?`, string(status), id); err != nil {
+		return fmt.Errorf("failed to update attempt status: %w", err)
+	}
+	return nil
+}
+
+// Decide marks a group decided in favour of the kept session
+func (r *AttemptRepository) Decide(id int, keptSessionID int) error {
+	_, err := r.db.Exec(
+		`UPDATE attempt_groups SET status = ?, kept_session_id = ?, decided_at = ? WHERE id = ?`,
+		string(models.AttemptGroupStatusDecided),
+		keptSessionID,
+		time.Now(),
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to decide attempt group: %w", err)
+	}
+	return nil
+}
+
+func (r *AttemptRepository) getAttempts(groupID int) ([]*models.Attempt, error) {
+	rows, err := r.db.Query(`
+		SELECT id, group_id, number, session_id, session_name, branch_name, status
+		FROM attempts
+		WHERE group_id = ?
+		ORDER BY number ASC
+	`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attempts: %w", err)
+	}
+	defer rows.Close()
+
+	attempts := []*models.Attempt{}
+	for rows.Next() {
+		attempt := &models.Attempt{}
+		err := rows.Scan(
+			&attempt.ID,
+			&attempt.GroupID,
+			&attempt.Number,
+			&attempt.SessionID,
+			&attempt.SessionName,
+			&attempt.BranchName,
+			&attempt.Status,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attempt: %w", err)
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating attempts: %w", err)
+	}
+
+	return attempts, nil
+}
+
+func scanAttemptGroup(row interface{ Scan(...interface{}) error }) (*models.AttemptGroup, error) {
+	group := &models.AttemptGroup{}
+	var keptSessionID sql.NullInt64
+	var decidedAt sql.NullTime
+
+	err := row.Scan(
+		&group.ID,
+		&group.ProjectID,
+		&group.Name,
+		&group.Prompt,
+		&group.BaseBranch,
+		&group.Status,
+		&keptSessionID,
+		&group.CreatedAt,
+		&decidedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if keptSessionID.Valid {
+		id := int(keptSessionID.Int64)
+		group.KeptSessionID = &id
+	}
+	if decidedAt.Valid {
+		group.DecidedAt = &decidedAt.Time
+	}
+	return group, nil
+}
@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"habibi-go/internal/models"
+)
+
+// BudgetRepository handles database operations for budget overrides
+type BudgetRepository struct {
+	db *sql.DB
+}
+
+// NewBudgetRepository creates a new budget repository
+func NewBudgetRepository(db *sql.DB) *BudgetRepository {
+	return &BudgetRepository{db: db}
+}
+
+// CreateOverride stores a budget override for a project, or one of its sessions
+func (r *BudgetRepository) CreateOverride(override *models.BudgetOverride) error {
+	if override.CreatedAt.IsZero() {
+		override.CreatedAt = time.Now()
+	}
+
+	var sessionID sql.NullInt64
+	if override.SessionID != nil {
+		sessionID = sql.NullInt64{Int64: int64(*override.SessionID), Valid: true}
+	}
+
+	result, err := r.db.Exec(
+		`INSERT INTO budget_overrides (project_id, session_id, reason, expires_at, created_at)
+		 VALUES (?, ?, ?, ?, ?)`,
+		override.ProjectID,
+		sessionID,
+		override.Reason,
+		override.ExpiresAt,
+		override.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert budget override: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	override.ID = int(id)
+	return nil
+}
+
+// GetActiveOverrides retrieves the unexpired overrides that apply to a project, or to
+// one of its sessions when sessionID is not zero
+func (r *BudgetRepository) GetActiveOverrides(projectID, sessionID int, now time.Time) ([]*models.BudgetOverride, error) {
+	rows, err := r.db.Query(`
+		SELECT id, project_id, session_id, reason, expires_at, created_at
+		FROM budget_overrides
+		WHERE project_id = ? AND (session_id IS NULL OR session_id = ?) AND expires_at > ?
+		ORDER BY expires_at DESC
+	`, projectID, sessionID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query budget overrides: %w", err)
+	}
+	defer rows.Close()
+
+	overrides := []*models.BudgetOverride{}
+	for rows.Next() {
+		override := &models.BudgetOverride{}
+		var overrideSessionID sql.NullInt64
+		err := rows.Scan(
+			&override.ID,
+			&override.ProjectID,
+			&overrideSessionID,
+			&override.Reason,
+			&override.ExpiresAt,
+			&override.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan budget override: %w", err)
+		}
+		if overrideSessionID.Valid {
+			id := int(overrideSessionID.Int64)
+			override.SessionID = &id
+		}
+		overrides = append(overrides, override)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating budget overrides: %w", err)
+	}
+
+	return overrides, nil
+}
+
+// DeleteProjectOverrides removes the overrides granted to a project as a whole
+func (r *BudgetRepository) DeleteProjectOverrides(projectID int) error {
+	if _, err := r.db.Exec(`DELETE FROM budget_overrides WHERE project_id = ? AND session_id IS NULL`, projectID); err != nil {
+		return fmt.Errorf("failed to delete budget overrides: %w", err)
+	}
+	return nil
+}
+
+// DeleteSessionOverrides removes the overrides granted to one session
+func (r *BudgetRepository) DeleteSessionOverrides(sessionID int) error {
+	if _, err := r.db.Exec(`DELETE FROM budget_overrides WHERE session_id = ?`, sessionID); err != nil {
+		return fmt.Errorf("failed to delete budget overrides: %w", err)
+	}
+	return nil
+}
@@ -21,13 +21,110 @@ func NewChatMessageV2Repository(db *sql.DB) *ChatMessageV2Repository {
 
 // Create inserts a new chat message
 func (r *ChatMessageV2Repository) Create(message *models.ChatMessage) error {
+	values, err := chatMessageValues(message)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(
+		`INSERT INTO chat_messages (session_id, turn_id, role, content, tool_name, tool_input, tool_use_id, tool_content,
+		                            parent_tool_use_id, content_type, content_data)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		values...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert chat message: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	message.ID = int(id)
+	message.CreatedAt = time.Now()
+	return nil
+}
+
+// ReplaceTurnMessages swaps the agent's messages of a turn (assistant, tool_use and
+// tool_result) for the given ones. User and system messages stay. New messages without
+// a time take that of the first message they replace so the history keeps its order.
+func (r *ChatMessageV2Repository) ReplaceTurnMessages(turnID int, messages []*models.ChatMessage) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Kept as the driver returns it and written back unchanged
+	var createdAt interface{}
+	err = tx.QueryRow(`
+		SELECT COALESCE(
+			(SELECT MIN(created_at) FROM chat_messages
+			 WHERE turn_id = ? AND role IN ('assistant', 'tool_use', 'tool_result')),
+			(SELECT started_at FROM turns WHERE id = ?))
+	`, turnID, turnID).Scan(&createdAt)
+	if err != nil {
+		return fmt.Errorf("failed to get turn message time: %w", err)
+	}
+	if createdAt == nil {
+		createdAt = time.Now()
+	}
+
+	_, err = tx.Exec(
+		"DELETE FROM chat_messages WHERE turn_id = ? AND role IN ('assistant', 'tool_use', 'tool_result')",
+		turnID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete turn chat messages: %w", err)
+	}
+
+	for _, message := range messages {
+		values, err := chatMessageValues(message)
+		if err != nil {
+			return err
+		}
+		messageCreatedAt := createdAt
+		if !message.CreatedAt.IsZero() {
+			// In the format of the column's CURRENT_TIMESTAMP default, so times sort alike
+			messageCreatedAt = message.CreatedAt.UTC().Format("2006-01-02 15:04:05")
+		}
+
+		result, err := tx.Exec(
+			`INSERT INTO chat_messages (session_id, turn_id, role, content, tool_name, tool_input, tool_use_id, tool_content,
+			                            parent_tool_use_id, content_type, content_data, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			append(values, messageCreatedAt)...,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert chat message: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get last insert id: %w", err)
+		}
+		message.ID = int(id)
+		if t, ok := messageCreatedAt.(time.Time); ok {
+			message.CreatedAt = t
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// chatMessageValues returns a message's values in the column order of the inserts above
+func chatMessageValues(message *models.ChatMessage) ([]interface{}, error) {
 	// Handle tool metadata
 	var toolInput, toolContent sql.NullString
 	
 	if message.ToolInput != nil {
 		data, err := json.Marshal(message.ToolInput)
 		if err != nil {
-			return fmt.Errorf("failed to marshal tool input: %w", err)
+			return nil, fmt.Errorf("failed to marshal tool input: %w", err)
 		}
 		toolInput = sql.NullString{String: string(data), Valid: true}
 	}
@@ -35,41 +132,44 @@ func (r *ChatMessageV2Repository) Create(message *models.ChatMessage) error {
 	if message.ToolContent != nil {
 		data, err := json.Marshal(message.ToolContent)
 		if err != nil {
-			return fmt.Errorf("failed to marshal tool content: %w", err)
+			return nil, fmt.Errorf("failed to marshal tool content: %w", err)
 		}
 		toolContent = sql.NullString{String: string(data), Valid: true}
 	}
 
-	result, err := r.db.Exec(
-		`INSERT INTO chat_messages (session_id, role, content, tool_name, tool_input, tool_use_id, tool_content)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+	var contentData sql.NullString
+	if message.ContentData != nil {
+		data, err := json.Marshal(message.ContentData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal content data: %w", err)
+		}
+		contentData = sql.NullString{String: string(data), Valid: true}
+	}
+
+	return []interface{}{
 		message.SessionID,
+		sql.NullInt64{Int64: int64(message.TurnID), Valid: message.TurnID != 0},
 		message.Role,
 		message.Content,
 		sql.NullString{String: message.ToolName, Valid: message.ToolName != ""},
 		toolInput,
 		sql.NullString{String: message.ToolUseID, Valid: message.ToolUseID != ""},
 		toolContent,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to insert chat message: %w", err)
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return fmt.Errorf("failed to get last insert id: %w", err)
-	}
-
-	message.ID = int(id)
-	message.CreatedAt = time.Now()
-	return nil
+		sql.NullString{String: message.ParentToolUseID, Valid: message.ParentToolUseID != ""},
+		sql.NullString{String: message.ContentType, Valid: message.ContentType != ""},
+		contentData,
+	}, nil
 }
 
+// chatMessageColumns is the column list scanChatMessage expects
+const chatMessageColumns = `id, session_id, COALESCE(turn_id, 0), role, content, created_at,
+		       tool_name, tool_input, tool_use_id, tool_content,
+		       parent_tool_use_id, content_type, content_data`
+
 // GetBySessionID retrieves all messages for a session
 func (r *ChatMessageV2Repository) GetBySessionID(sessionID int, limit int) ([]*models.ChatMessage, error) {
 	query := `
-		SELECT id, session_id, role, content, created_at, 
-		       tool_name, tool_input, tool_use_id, tool_content
+		SELECT ` + chatMessageColumns + `
 		FROM chat_messages
 		WHERE session_id = ?
 		ORDER BY created_at DESC, id DESC
@@ -84,44 +184,10 @@ func (r *ChatMessageV2Repository) GetBySessionID(sessionID int, limit int) ([]*m
 
 	var messages []*models.ChatMessage
 	for rows.Next() {
-		msg := &models.ChatMessage{}
-		var toolName, toolInput, toolUseID, toolContent sql.NullString
-		
-		err := rows.Scan(
-			&msg.ID,
-			&msg.SessionID,
-			&msg.Role,
-			&msg.Content,
-			&msg.CreatedAt,
-			&toolName,
-			&toolInput,
-			&toolUseID,
-			&toolContent,
-		)
+		msg, err := scanChatMessage(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan chat message: %w", err)
-		}
-
-		// Handle tool metadata
-		if toolName.Valid {
-			msg.ToolName = toolName.String
-		}
-		if toolUseID.Valid {
-			msg.ToolUseID = toolUseID.String
+			return nil, err
 		}
-		if toolInput.Valid {
-			if err := json.Unmarshal([]byte(toolInput.String), &msg.ToolInput); err != nil {
-				// If unmarshal fails, store as string
-				msg.ToolInput = toolInput.String
-			}
-		}
-		if toolContent.Valid {
-			if err := json.Unmarshal([]byte(toolContent.String), &msg.ToolContent); err != nil {
-				// If unmarshal fails, store as string
-				msg.ToolContent = toolContent.String
-			}
-		}
-
 		messages = append(messages, msg)
 	}
 
@@ -137,19 +203,60 @@ func (r *ChatMessageV2Repository) GetBySessionID(sessionID int, limit int) ([]*m
 	return messages, nil
 }
 
+// GetByTurnID retrieves all messages produced by a turn in chronological order
+func (r *ChatMessageV2Repository) GetByTurnID(turnID int) ([]*models.ChatMessage, error) {
+	rows, err := r.db.Query(`
+		SELECT `+chatMessageColumns+`
+		FROM chat_messages
+		WHERE turn_id = ?
+		ORDER BY created_at ASC, id ASC
+	`, turnID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query turn chat messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*models.ChatMessage
+	for rows.Next() {
+		msg, err := scanChatMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating chat messages: %w", err)
+	}
+
+	return messages, nil
+}
+
 // GetByID retrieves a specific message by ID
 func (r *ChatMessageV2Repository) GetByID(id int) (*models.ChatMessage, error) {
-	msg := &models.ChatMessage{}
-	var toolName, toolInput, toolUseID, toolContent sql.NullString
-	
-	err := r.db.QueryRow(`
-		SELECT id, session_id, role, content, created_at, 
-		       tool_name, tool_input, tool_use_id, tool_content
+	row := r.db.QueryRow(`
+		SELECT `+chatMessageColumns+`
 		FROM chat_messages
 		WHERE id = ?
-	`, id).Scan(
+	`, id)
+
+	msg, err := scanChatMessage(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat message by ID: %w", err)
+	}
+	return msg, nil
+}
+
+// scanChatMessage reads one message selected with chatMessageColumns
+func scanChatMessage(row interface{ Scan(...interface{}) error }) (*models.ChatMessage, error) {
+	msg := &models.ChatMessage{}
+	var toolName, toolInput, toolUseID, toolContent sql.NullString
+	var parentToolUseID, contentType, contentData sql.NullString
+
+	err := row.Scan(
 		&msg.ID,
 		&msg.SessionID,
+		&msg.TurnID,
 		&msg.Role,
 		&msg.Content,
 		&msg.CreatedAt,
@@ -157,21 +264,21 @@ func (r *ChatMessageV2Repository) GetByID(id int) (*models.ChatMessage, error) {
 		&toolInput,
 		&toolUseID,
 		&toolContent,
+		&parentToolUseID,
+		&contentType,
+		&contentData,
 	)
-	
 	if err != nil {
-		return nil, fmt.Errorf("failed to get chat message by ID: %w", err)
+		return nil, fmt.Errorf("failed to scan chat message: %w", err)
 	}
 
-	// Handle tool metadata
-	if toolName.Valid {
-		msg.ToolName = toolName.String
-	}
-	if toolUseID.Valid {
-		msg.ToolUseID = toolUseID.String
-	}
+	msg.ToolName = toolName.String
+	msg.ToolUseID = toolUseID.String
+	msg.ParentToolUseID = parentToolUseID.String
+	msg.ContentType = contentType.String
 	if toolInput.Valid {
 		if err := json.Unmarshal([]byte(toolInput.String), &msg.ToolInput); err != nil {
+			// If unmarshal fails, store as string
 			msg.ToolInput = toolInput.String
 		}
 	}
@@ -180,6 +287,11 @@ func (r *ChatMessageV2Repository) GetByID(id int) (*models.ChatMessage, error) {
 			msg.ToolContent = toolContent.String
 		}
 	}
+	if contentData.Valid {
+		if err := json.Unmarshal([]byte(contentData.String), &msg.ContentData); err != nil {
+			msg.ContentData = contentData.String
+		}
+	}
 
 	return msg, nil
 }
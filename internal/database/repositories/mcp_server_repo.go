@@ -0,0 +1,277 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"habibi-go/internal/models"
+)
+
+// MCPServerRepository handles database operations for project MCP servers and the
+// sessions that turn them on or off
+type MCPServerRepository struct {
+	db *sql.DB
+}
+
+// NewMCPServerRepository creates a new MCP server repository
+func NewMCPServerRepository(db *sql.DB) *MCPServerRepository {
+	return &MCPServerRepository{db: db}
+}
+
+// Create stores a new MCP server definition
+func (r *MCPServerRepository) Create(server *models.MCPServer) error {
+	now := time.Now()
+	server.CreatedAt = now
+	server.UpdatedAt = now
+
+	args, env, headers, err := marshalMCPServerFields(server)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(
+		`INSERT INTO mcp_servers (project_id, name, type, command, args, env, url, headers, enabled, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		server.ProjectID,
+		server.Name,
+		server.Type,
+		server.Command,
+		args,
+		env,
+		server.URL,
+		headers,
+		server.Enabled,
+		server.CreatedAt,
+		server.UpdatedAt,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return fmt.Errorf("MCP server %q already exists in this project", server.Name)
+		}
+		return fmt.Errorf("failed to insert MCP server: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	server.ID = int(id)
+	return nil
+}
+
+// GetByID retrieves an MCP server definition
+func (r *MCPServerRepository) GetByID(id int) (*models.MCPServer, error) {
+	row := r.db.QueryRow(`
+		SELECT id, project_id, name, type, command, args, env, url, headers, enabled, created_at, updated_at
+		FROM mcp_servers
+		WHERE id = ?
+	`, id)
+
+	server, err := scanMCPServer(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("MCP server not found")
+		}
+		return nil, fmt.Errorf("failed to get MCP server: %w", err)
+	}
+	return server, nil
+}
+
+// GetByProject retrieves a project's MCP servers by name
+func (r *MCPServerRepository) GetByProject(projectID int) ([]*models.MCPServer, error) {
+	rows, err := r.db.Query(`
+		SELECT id, project_id, name, type, command, args, env, url, headers, enabled, created_at, updated_at
+		FROM mcp_servers
+		WHERE project_id = ?
+		ORDER BY name ASC
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query MCP servers: %w", err)
+	}
+	defer rows.Close()
+
+	servers := []*models.MCPServer{}
+	for rows.Next() {
+		server, err := scanMCPServer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan MCP server: %w", err)
+		}
+		servers = append(servers, server)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating MCP servers: %w", err)
+	}
+
+	return servers, nil
+}
+
+// Update saves a changed MCP server definition
+func (r *MCPServerRepository) Update(server *models.MCPServer) error {
+	server.UpdatedAt = time.Now()
+
+	args, env, headers, err := marshalMCPServerFields(server)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(
+		`UPDATE mcp_servers
+		 SET name = ?, type = ?, command = ?, args = ?, env = ?, url = ?, headers = ?, enabled = ?, updated_at = ?
+		 WHERE id = ?`,
+		server.Name,
+		server.Type,
+		server.Command,
+		args,
+		env,
+		server.URL,
+		headers,
+		server.Enabled,
+		server.UpdatedAt,
+		server.ID,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return fmt.Errorf("MCP server %q already exists in this project", server.Name)
+		}
+		return fmt.Errorf("failed to update MCP server: %w", err)
+	}
+	return nil
+}
+
+// Delete removes an MCP server and the session choices made for it
+func (r *MCPServerRepository) Delete(id int) error {
+	if _, err := r.db.Exec(`DELETE FROM session_mcp_servers WHERE mcp_server_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete session MCP servers: %w", err)
+	}
+	if _, err := r.db.Exec(`DELETE FROM mcp_servers WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete MCP server: %w", err)
+	}
+	return nil
+}
+
+// GetSessionOverrides returns the servers a session turned on or off, by server ID
+func (r *MCPServerRepository) GetSessionOverrides(sessionID int) (map[int]bool, error) {
+	rows, err := r.db.Query(`
+		SELECT mcp_server_id, enabled
+		FROM session_mcp_servers
+		WHERE session_id = ?
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session MCP servers: %w", err)
+	}
+	defer rows.Close()
+
+	overrides := make(map[int]bool)
+	for rows.Next() {
+		var serverID int
+		var enabled bool
+		if err := rows.Scan(&serverID, &enabled); err != nil {
+			return nil, fmt.Errorf("failed to scan session MCP server: %w", err)
+		}
+		overrides[serverID] = enabled
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating session MCP servers: %w", err)
+	}
+
+	return overrides, nil
+}
+
+// SetSessionOverride turns a server on or off for one session
+func (r *MCPServerRepository) SetSessionOverride(sessionID, serverID int, enabled bool) error {
+	_, err := r.db.Exec(
+		`INSERT INTO session_mcp_servers (session_id, mcp_server_id, enabled) VALUES (?, ?, ?)
+		 ON CONFLICT(session_id, mcp_server_id) DO UPDATE SET enabled = excluded.enabled`,
+		sessionID,
+		serverID,
+		enabled,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set session MCP server: %w", err)
+	}
+	return nil
+}
+
+// DeleteSessionOverride returns a session to the project's default for a server
+func (r *MCPServerRepository) DeleteSessionOverride(sessionID, serverID int) error {
+	_, err := r.db.Exec(
+		`DELETE FROM session_mcp_servers WHERE session_id = ? AND mcp_server_id = ?`,
+		sessionID,
+		serverID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete session MCP server: %w", err)
+	}
+	return nil
+}
+
+func marshalMCPServerFields(server *models.MCPServer) (string, string, string, error) {
+	args := server.Args
+	if args == nil {
+		args = []string{}
+	}
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to marshal MCP server args: %w", err)
+	}
+
+	env := server.Env
+	if env == nil {
+		env = map[string]string{}
+	}
+	envJSON, err := json.Marshal(env)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to marshal MCP server env: %w", err)
+	}
+
+	headers := server.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	headersJSON, err := json.Marshal(headers)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to marshal MCP server headers: %w", err)
+	}
+
+	return string(argsJSON), string(envJSON), string(headersJSON), nil
+}
+
+func scanMCPServer(row interface{ Scan(...interface{}) error }) (*models.MCPServer, error) {
+	server := &models.MCPServer{}
+	var args, env, headers string
+
+	err := row.Scan(
+		&server.ID,
+		&server.ProjectID,
+		&server.Name,
+		&server.Type,
+		&server.Command,
+		&args,
+		&env,
+		&server.URL,
+		&headers,
+		&server.Enabled,
+		&server.CreatedAt,
+		&server.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(args), &server.Args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal MCP server args: %w", err)
+	}
+	if err := json.Unmarshal([]byte(env), &server.Env); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal MCP server env: %w", err)
+	}
+	if err := json.Unmarshal([]byte(headers), &server.Headers); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal MCP server headers: %w", err)
+	}
+	return server, nil
+}
@@ -46,7 +46,8 @@ func (r *SessionRepository) Create(session *models.Session) error {
 func (r *SessionRepository) GetByID(id int) (*models.Session, error) {
 	query := `
 		SELECT id, project_id, name, branch_name, worktree_path, status, config, created_at, last_used_at,
-		       last_activity_at, activity_status, last_viewed_at
+		       last_activity_at, activity_status, last_viewed_at, COALESCE(claude_session_id, ''),
+		       COALESCE(conversation_backend, 'claude')
 		FROM sessions
 		WHERE id = ?
 	`
@@ -58,6 +59,7 @@ func (r *SessionRepository) GetByID(id int) (*models.Session, error) {
 		&session.ID, &session.ProjectID, &session.Name, &session.BranchName,
 		&session.WorktreePath, &session.Status, &configStr, &session.CreatedAt,
 		&session.LastUsedAt, &session.LastActivityAt, &session.ActivityStatus, &session.LastViewedAt,
+		&session.ClaudeSessionID, &session.ConversationBackend,
 	)
 	
 	if err != nil {
@@ -77,7 +79,8 @@ func (r *SessionRepository) GetByID(id int) (*models.Session, error) {
 func (r *SessionRepository) GetByProjectAndName(projectID int, name string) (*models.Session, error) {
 	query := `
 		SELECT id, project_id, name, branch_name, worktree_path, status, config, created_at, last_used_at,
-		       last_activity_at, activity_status, last_viewed_at
+		       last_activity_at, activity_status, last_viewed_at, COALESCE(claude_session_id, ''),
+		       COALESCE(conversation_backend, 'claude')
 		FROM sessions
 		WHERE project_id = ? AND name = ?
 	`
@@ -89,6 +92,7 @@ func (r *SessionRepository) GetByProjectAndName(projectID int, name string) (*mo
 		&session.ID, &session.ProjectID, &session.Name, &session.BranchName,
 		&session.WorktreePath, &session.Status, &configStr, &session.CreatedAt,
 		&session.LastUsedAt, &session.LastActivityAt, &session.ActivityStatus, &session.LastViewedAt,
+		&session.ClaudeSessionID, &session.ConversationBackend,
 	)
 	
 	if err != nil {
@@ -108,7 +112,8 @@ func (r *SessionRepository) GetByProjectAndName(projectID int, name string) (*mo
 func (r *SessionRepository) GetByProjectID(projectID int) ([]*models.Session, error) {
 	query := `
 		SELECT id, project_id, name, branch_name, worktree_path, status, config, created_at, last_used_at,
-		       last_activity_at, activity_status, last_viewed_at
+		       last_activity_at, activity_status, last_viewed_at, COALESCE(claude_session_id, ''),
+		       COALESCE(conversation_backend, 'claude')
 		FROM sessions
 		WHERE project_id = ?
 		ORDER BY last_used_at DESC
@@ -130,6 +135,7 @@ func (r *SessionRepository) GetByProjectID(projectID int) ([]*models.Session, er
 			&session.ID, &session.ProjectID, &session.Name, &session.BranchName,
 			&session.WorktreePath, &session.Status, &configStr, &session.CreatedAt,
 			&session.LastUsedAt, &session.LastActivityAt, &session.ActivityStatus, &session.LastViewedAt,
+			&session.ClaudeSessionID, &session.ConversationBackend,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan session: %w", err)
@@ -148,7 +154,8 @@ func (r *SessionRepository) GetByProjectID(projectID int) ([]*models.Session, er
 func (r *SessionRepository) GetAll() ([]*models.Session, error) {
 	query := `
 		SELECT id, project_id, name, branch_name, worktree_path, status, config, created_at, last_used_at,
-		       last_activity_at, activity_status, last_viewed_at
+		       last_activity_at, activity_status, last_viewed_at, COALESCE(claude_session_id, ''),
+		       COALESCE(conversation_backend, 'claude')
 		FROM sessions
 		ORDER BY last_used_at DESC
 	`
@@ -169,6 +176,7 @@ func (r *SessionRepository) GetAll() ([]*models.Session, error) {
 			&session.ID, &session.ProjectID, &session.Name, &session.BranchName,
 			&session.WorktreePath, &session.Status, &configStr, &session.CreatedAt,
 			&session.LastUsedAt, &session.LastActivityAt, &session.ActivityStatus, &session.LastViewedAt,
+			&session.ClaudeSessionID, &session.ConversationBackend,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan session: %w", err)
@@ -396,6 +404,49 @@ func (r *SessionRepository) GetStats() (map[string]interface{}, error) {
 	return stats, nil
 }
 
+// GetByActivityStatus retrieves all sessions with the given activity status
+func (r *SessionRepository) GetByActivityStatus(activityStatus string) ([]*models.Session, error) {
+	query := `
+		SELECT id, project_id, name, branch_name, worktree_path, status, config, created_at, last_used_at,
+		       last_activity_at, activity_status, last_viewed_at, COALESCE(claude_session_id, ''),
+		       COALESCE(conversation_backend, 'claude')
+		FROM sessions
+		WHERE activity_status = ?
+		ORDER BY last_used_at DESC
+	`
+	
+	rows, err := r.db.Query(query, activityStatus)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions by activity status: %w", err)
+	}
+	defer rows.Close()
+	
+	var sessions []*models.Session
+	
+	for rows.Next() {
+		var session models.Session
+		var configStr string
+		
+		err := rows.Scan(
+			&session.ID, &session.ProjectID, &session.Name, &session.BranchName,
+			&session.WorktreePath, &session.Status, &configStr, &session.CreatedAt,
+			&session.LastUsedAt, &session.LastActivityAt, &session.ActivityStatus, &session.LastViewedAt,
+			&session.ClaudeSessionID, &session.ConversationBackend,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		
+		if err := session.UnmarshalConfig(configStr); err != nil {
+			return nil, err
+		}
+		
+		sessions = append(sessions, &session)
+	}
+	
+	return sessions, nil
+}
+
 func (r *SessionRepository) UpdateActivityStatus(id int, status string) error {
 	query := `UPDATE sessions SET activity_status = ?, last_activity_at = CURRENT_TIMESTAMP WHERE id = ?`
 	
@@ -415,5 +466,21 @@ func (r *SessionRepository) UpdateLastViewed(id int) error {
 		return fmt.Errorf("failed to update last viewed time: %w", err)
 	}
 	
+	return nil
+}
+
+// UpdateClaudeSessionID records the conversation the session continues on its next turn
+// and the agent backend it belongs to
+func (r *SessionRepository) UpdateClaudeSessionID(id int, claudeSessionID, backend string) error {
+	query := `UPDATE sessions SET claude_session_id = ?, conversation_backend = ? WHERE id = ?`
+	
+	_, err := r.db.Exec(query,
+		sql.NullString{String: claudeSessionID, Valid: claudeSessionID != ""},
+		sql.NullString{String: backend, Valid: backend != ""},
+		id)
+	if err != nil {
+		return fmt.Errorf("failed to update claude session ID: %w", err)
+	}
+	
 	return nil
 }
\ No newline at end of file
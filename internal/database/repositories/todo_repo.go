@@ -0,0 +1,136 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"habibi-go/internal/models"
+)
+
+// TodoRepository handles database operations for the task lists agents keep
+type TodoRepository struct {
+	db *sql.DB
+}
+
+// NewTodoRepository creates a new todo repository
+func NewTodoRepository(db *sql.DB) *TodoRepository {
+	return &TodoRepository{db: db}
+}
+
+// Create stores a new version of a session's task list
+func (r *TodoRepository) Create(list *models.TodoList) error {
+	if list.CreatedAt.IsZero() {
+		list.CreatedAt = time.Now()
+	}
+	if list.Todos == nil {
+		list.Todos = []models.Todo{}
+	}
+
+	todos, err := json.Marshal(list.Todos)
+	if err != nil {
+		return fmt.Errorf("failed to marshal todos: %w", err)
+	}
+
+	result, err := r.db.Exec(
+		`INSERT INTO session_todos (session_id, turn_id, tool_use_id, todos, created_at)
+		 VALUES (?, ?, ?, ?, ?)`,
+		list.SessionID,
+		sql.NullInt64{Int64: int64(list.TurnID), Valid: list.TurnID != 0},
+		sql.NullString{String: list.ToolUseID, Valid: list.ToolUseID != ""},
+		string(todos),
+		list.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert todo list: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	list.ID = int(id)
+	return nil
+}
+
+// GetLatest retrieves a session's current task list; it returns nil if the agent never wrote one
+func (r *TodoRepository) GetLatest(sessionID int) (*models.TodoList, error) {
+	row := r.db.QueryRow(`
+		SELECT id, session_id, COALESCE(turn_id, 0), tool_use_id, todos, created_at
+		FROM session_todos
+		WHERE session_id = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`, sessionID)
+
+	list, err := scanTodoList(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todo list: %w", err)
+	}
+	return list, nil
+}
+
+// GetHistory retrieves the most recent versions of a session's task list in chronological order
+func (r *TodoRepository) GetHistory(sessionID int, limit int) ([]*models.TodoList, error) {
+	rows, err := r.db.Query(`
+		SELECT id, session_id, COALESCE(turn_id, 0), tool_use_id, todos, created_at
+		FROM session_todos
+		WHERE session_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, sessionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query todo lists: %w", err)
+	}
+	defer rows.Close()
+
+	var lists []*models.TodoList
+	for rows.Next() {
+		list, err := scanTodoList(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan todo list: %w", err)
+		}
+		lists = append(lists, list)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating todo lists: %w", err)
+	}
+
+	// Reverse to get chronological order
+	for i, j := 0, len(lists)-1; i < j; i, j = i+1, j-1 {
+		lists[i], lists[j] = lists[j], lists[i]
+	}
+
+	return lists, nil
+}
+
+// scanTodoList reads one row of session_todos
+func scanTodoList(row interface{ Scan(...interface{}) error }) (*models.TodoList, error) {
+	list := &models.TodoList{}
+	var toolUseID sql.NullString
+	var todos string
+
+	err := row.Scan(
+		&list.ID,
+		&list.SessionID,
+		&list.TurnID,
+		&toolUseID,
+		&todos,
+		&list.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	list.ToolUseID = toolUseID.String
+	if err := json.Unmarshal([]byte(todos), &list.Todos); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal todos: %w", err)
+	}
+	return list, nil
+}
@@ -0,0 +1,451 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"habibi-go/internal/models"
+)
+
+// TurnRepository handles database operations for Claude turns
+type TurnRepository struct {
+	db *sql.DB
+}
+
+// NewTurnRepository creates a new turn repository
+func NewTurnRepository(db *sql.DB) *TurnRepository {
+	return &TurnRepository{db: db}
+}
+
+// Create inserts a new turn
+func (r *TurnRepository) Create(turn *models.Turn) error {
+	if turn.StartedAt.IsZero() {
+		turn.StartedAt = time.Now()
+	}
+	if turn.Status == "" {
+		turn.Status = string(models.TurnStatusRunning)
+	}
+	if turn.Backend == "" {
+		turn.Backend = "claude"
+	}
+
+	result, err := r.db.Exec(
+		`INSERT INTO turns (session_id, claude_session_id, prompt, backend, model, max_turns, append_system_prompt, status, started_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		turn.SessionID,
+		sql.NullString{String: turn.ClaudeSessionID, Valid: turn.ClaudeSessionID != ""},
+		turn.Prompt,
+		turn.Backend,
+		sql.NullString{String: turn.Model, Valid: turn.Model != ""},
+		turn.MaxTurns,
+		sql.NullString{String: turn.AppendSystemPrompt, Valid: turn.AppendSystemPrompt != ""},
+		turn.Status,
+		turn.StartedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert turn: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	turn.ID = int(id)
+	return nil
+}
+
+// GetByID retrieves a specific turn by ID
+func (r *TurnRepository) GetByID(id int) (*models.Turn, error) {
+	turn := &models.Turn{}
+	var claudeSessionID, model, appendSystemPrompt, errorMsg, resultSubtype sql.NullString
+	var snapshotBefore, snapshotAfter sql.NullString
+
+	err := r.db.QueryRow(`
+		SELECT id, session_id, claude_session_id, prompt, COALESCE(backend, 'claude'),
+		       model, COALESCE(max_turns, 0), append_system_prompt, status, error, started_at, completed_at,
+		       input_tokens, output_tokens, cache_creation_input_tokens, cache_read_input_tokens,
+		       total_cost_usd, duration_ms, duration_api_ms, num_turns, is_error, result_subtype,
+		       snapshot_before, snapshot_after
+		FROM turns
+		WHERE id = ?
+	`, id).Scan(
+		&turn.ID,
+		&turn.SessionID,
+		&claudeSessionID,
+		&turn.Prompt,
+		&turn.Backend,
+		&model,
+		&turn.MaxTurns,
+		&appendSystemPrompt,
+		&turn.Status,
+		&errorMsg,
+		&turn.StartedAt,
+		&turn.CompletedAt,
+		&turn.InputTokens,
+		&turn.OutputTokens,
+		&turn.CacheCreationInputTokens,
+		&turn.CacheReadInputTokens,
+		&turn.TotalCostUSD,
+		&turn.DurationMS,
+		&turn.DurationAPIMS,
+		&turn.NumTurns,
+		&turn.IsError,
+		&resultSubtype,
+		&snapshotBefore,
+		&snapshotAfter,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("turn not found")
+		}
+		return nil, fmt.Errorf("failed to get turn: %w", err)
+	}
+
+	turn.ClaudeSessionID = claudeSessionID.String
+	turn.Model = model.String
+	turn.AppendSystemPrompt = appendSystemPrompt.String
+	turn.Error = errorMsg.String
+	turn.ResultSubtype = resultSubtype.String
+	turn.SnapshotBefore = snapshotBefore.String
+	turn.SnapshotAfter = snapshotAfter.String
+	return turn, nil
+}
+
+// GetBySessionID retrieves the most recent turns for a session in chronological order
+func (r *TurnRepository) GetBySessionID(sessionID int, limit int) ([]*models.Turn, error) {
+	rows, err := r.db.Query(`
+		SELECT id, session_id, claude_session_id, prompt, COALESCE(backend, 'claude'),
+		       model, COALESCE(max_turns, 0), append_system_prompt, status, error, started_at, completed_at,
+		       input_tokens, output_tokens, cache_creation_input_tokens, cache_read_input_tokens,
+		       total_cost_usd, duration_ms, duration_api_ms, num_turns, is_error, result_subtype,
+		       snapshot_before, snapshot_after
+		FROM turns
+		WHERE session_id = ?
+		ORDER BY started_at DESC, id DESC
+		LIMIT ?
+	`, sessionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query turns: %w", err)
+	}
+	defer rows.Close()
+
+	turns, err := scanTurns(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reverse to get chronological order
+	for i, j := 0, len(turns)-1; i < j; i, j = i+1, j-1 {
+		turns[i], turns[j] = turns[j], turns[i]
+	}
+
+	return turns, nil
+}
+
+// GetByStatus retrieves all turns with the given status, oldest first
+func (r *TurnRepository) GetByStatus(status models.TurnStatus) ([]*models.Turn, error) {
+	rows, err := r.db.Query(`
+		SELECT id, session_id, claude_session_id, prompt, COALESCE(backend, 'claude'),
+		       model, COALESCE(max_turns, 0), append_system_prompt, status, error, started_at, completed_at,
+		       input_tokens, output_tokens, cache_creation_input_tokens, cache_read_input_tokens,
+		       total_cost_usd, duration_ms, duration_api_ms, num_turns, is_error, result_subtype,
+		       snapshot_before, snapshot_after
+		FROM turns
+		WHERE status = ?
+		ORDER BY started_at ASC, id ASC
+	`, string(status))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query turns: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTurns(rows)
+}
+
+// scanTurns reads turn rows selected with the standard column list
+func scanTurns(rows *sql.Rows) ([]*models.Turn, error) {
+	var turns []*models.Turn
+	for rows.Next() {
+		turn := &models.Turn{}
+		var claudeSessionID, model, appendSystemPrompt, errorMsg, resultSubtype sql.NullString
+		var snapshotBefore, snapshotAfter sql.NullString
+
+		err := rows.Scan(
+			&turn.ID,
+			&turn.SessionID,
+			&claudeSessionID,
+			&turn.Prompt,
+			&turn.Backend,
+			&model,
+			&turn.MaxTurns,
+			&appendSystemPrompt,
+			&turn.Status,
+			&errorMsg,
+			&turn.StartedAt,
+			&turn.CompletedAt,
+			&turn.InputTokens,
+			&turn.OutputTokens,
+			&turn.CacheCreationInputTokens,
+			&turn.CacheReadInputTokens,
+			&turn.TotalCostUSD,
+			&turn.DurationMS,
+			&turn.DurationAPIMS,
+			&turn.NumTurns,
+			&turn.IsError,
+			&resultSubtype,
+			&snapshotBefore,
+			&snapshotAfter,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan turn: %w", err)
+		}
+
+		turn.ClaudeSessionID = claudeSessionID.String
+		turn.Model = model.String
+		turn.AppendSystemPrompt = appendSystemPrompt.String
+		turn.Error = errorMsg.String
+		turn.ResultSubtype = resultSubtype.String
+		turn.SnapshotBefore = snapshotBefore.String
+		turn.SnapshotAfter = snapshotAfter.String
+		turns = append(turns, turn)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating turns: %w", err)
+	}
+
+	return turns, nil
+}
+
+// UpdateClaudeSessionID records the Claude conversation a turn ran in
+func (r *TurnRepository) UpdateClaudeSessionID(id int, claudeSessionID string) error {
+	_, err := r.db.Exec("UPDATE turns SET claude_session_id = ? WHERE id = ?", claudeSessionID, id)
+	if err != nil {
+		return fmt.Errorf("failed to update turn claude session ID: %w", err)
+	}
+	return nil
+}
+
+// UpdateModel records the model a turn ran with
+func (r *TurnRepository) UpdateModel(id int, model string) error {
+	_, err := r.db.Exec("UPDATE turns SET model = ? WHERE id = ?", model, id)
+	if err != nil {
+		return fmt.Errorf("failed to update turn model: %w", err)
+	}
+	return nil
+}
+
+// UpdateSnapshots records the worktree snapshots taken around a turn; empty values are left unchanged
+func (r *TurnRepository) UpdateSnapshots(id int, before, after string) error {
+	_, err := r.db.Exec(`
+		UPDATE turns SET
+			snapshot_before = COALESCE(?, snapshot_before),
+			snapshot_after = COALESCE(?, snapshot_after)
+		WHERE id = ?`,
+		sql.NullString{String: before, Valid: before != ""},
+		sql.NullString{String: after, Valid: after != ""},
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update turn snapshots: %w", err)
+	}
+	return nil
+}
+
+// UpdateUsage stores the usage Claude reported for a turn
+func (r *TurnRepository) UpdateUsage(id int, usage *models.TurnUsage) error {
+	_, err := r.db.Exec(`
+		UPDATE turns SET
+			input_tokens = ?, output_tokens = ?, cache_creation_input_tokens = ?, cache_read_input_tokens = ?,
+			total_cost_usd = ?, duration_ms = ?, duration_api_ms = ?, num_turns = ?, is_error = ?, result_subtype = ?
+		WHERE id = ?`,
+		usage.InputTokens,
+		usage.OutputTokens,
+		usage.CacheCreationInputTokens,
+		usage.CacheReadInputTokens,
+		usage.TotalCostUSD,
+		usage.DurationMS,
+		usage.DurationAPIMS,
+		usage.NumTurns,
+		usage.IsError,
+		sql.NullString{String: usage.ResultSubtype, Valid: usage.ResultSubtype != ""},
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update turn usage: %w", err)
+	}
+	return nil
+}
+
+// Complete marks a turn as finished with the given status
+func (r *TurnRepository) Complete(id int, status models.TurnStatus, errorMsg string) error {
+	_, err := r.db.Exec(
+		"UPDATE turns SET status = ?, error = ?, completed_at = ? WHERE id = ?",
+		string(status),
+		sql.NullString{String: errorMsg, Valid: errorMsg != ""},
+		time.Now(),
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to complete turn: %w", err)
+	}
+	return nil
+}
+
+// SaveTranscript stores a turn's compressed agent output, replacing any earlier copy
+func (r *TurnRepository) SaveTranscript(transcript *models.TurnTranscript) error {
+	if transcript.CreatedAt.IsZero() {
+		transcript.CreatedAt = time.Now()
+	}
+
+	lineTimes, err := json.Marshal(transcript.LineTimes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal transcript line times: %w", err)
+	}
+
+	_, err = r.db.Exec(
+		`INSERT OR REPLACE INTO turn_transcripts (turn_id, backend, data, line_count, line_times, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		transcript.TurnID,
+		transcript.Backend,
+		transcript.Data,
+		transcript.LineCount,
+		string(lineTimes),
+		transcript.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save turn transcript: %w", err)
+	}
+	return nil
+}
+
+// GetTranscript retrieves a turn's compressed agent output; it returns nil if none was saved
+func (r *TurnRepository) GetTranscript(turnID int) (*models.TurnTranscript, error) {
+	transcript := &models.TurnTranscript{}
+	var lineTimes string
+
+	err := r.db.QueryRow(`
+		SELECT turn_id, backend, data, COALESCE(line_count, 0), COALESCE(line_times, ''), created_at
+		FROM turn_transcripts
+		WHERE turn_id = ?
+	`, turnID).Scan(
+		&transcript.TurnID,
+		&transcript.Backend,
+		&transcript.Data,
+		&transcript.LineCount,
+		&lineTimes,
+		&transcript.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get turn transcript: %w", err)
+	}
+	if lineTimes != "" {
+		if err := json.Unmarshal([]byte(lineTimes), &transcript.LineTimes); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal transcript line times: %w", err)
+		}
+	}
+	return transcript, nil
+}
+
+// GetConversations groups a session's turns by Claude conversation, most recently active first
+func (r *TurnRepository) GetConversations(sessionID int) ([]*models.ClaudeConversation, error) {
+	rows, err := r.db.Query(`
+		SELECT claude_session_id, COALESCE(backend, 'claude'), prompt, started_at
+		FROM turns
+		WHERE session_id = ? AND claude_session_id IS NOT NULL AND claude_session_id != ''
+		ORDER BY started_at ASC, id ASC
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversations: %w", err)
+	}
+	defer rows.Close()
+
+	byID := make(map[string]*models.ClaudeConversation)
+	var conversations []*models.ClaudeConversation
+	for rows.Next() {
+		var claudeSessionID, backend, prompt string
+		var startedAt time.Time
+
+		if err := rows.Scan(&claudeSessionID, &backend, &prompt, &startedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation turn: %w", err)
+		}
+
+		conversation, exists := byID[claudeSessionID]
+		if !exists {
+			conversation = &models.ClaudeConversation{
+				ClaudeSessionID: claudeSessionID,
+				Backend:         backend,
+				SessionID:       sessionID,
+				FirstPrompt:     prompt,
+				StartedAt:       startedAt,
+			}
+			byID[claudeSessionID] = conversation
+			conversations = append(conversations, conversation)
+		}
+		conversation.TurnCount++
+		conversation.LastActiveAt = startedAt
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating conversations: %w", err)
+	}
+
+	// Latest conversation first so it is easy to pick up again
+	sort.SliceStable(conversations, func(i, j int) bool {
+		return conversations[i].LastActiveAt.After(conversations[j].LastActiveAt)
+	})
+
+	return conversations, nil
+}
+
+// GetUsageSummary totals the usage of all turns in a session
+func (r *TurnRepository) GetUsageSummary(sessionID int) (*models.UsageSummary, error) {
+	return r.usageSummary("WHERE session_id = ?", sessionID)
+}
+
+// GetProjectUsageSummary totals the usage of all turns across a project's sessions
+func (r *TurnRepository) GetProjectUsageSummary(projectID int) (*models.UsageSummary, error) {
+	return r.usageSummary("WHERE session_id IN (SELECT id FROM sessions WHERE project_id = ?)", projectID)
+}
+
+// GetProjectUsageSince totals the usage of a project's turns started at or after since
+func (r *TurnRepository) GetProjectUsageSince(projectID int, since time.Time) (*models.UsageSummary, error) {
+	return r.usageSummary("WHERE session_id IN (SELECT id FROM sessions WHERE project_id = ?) AND started_at >= ?", projectID, since)
+}
+
+func (r *TurnRepository) usageSummary(where string, args ...interface{}) (*models.UsageSummary, error) {
+	summary := &models.UsageSummary{}
+
+	err := r.db.QueryRow(`
+		SELECT COUNT(*),
+		       COALESCE(SUM(CASE WHEN is_error THEN 1 ELSE 0 END), 0),
+		       COALESCE(SUM(input_tokens), 0),
+		       COALESCE(SUM(output_tokens), 0),
+		       COALESCE(SUM(cache_creation_input_tokens), 0),
+		       COALESCE(SUM(cache_read_input_tokens), 0),
+		       COALESCE(SUM(total_cost_usd), 0),
+		       COALESCE(SUM(duration_ms), 0)
+		FROM turns
+		`+where, args...).Scan(
+		&summary.TurnCount,
+		&summary.ErrorCount,
+		&summary.InputTokens,
+		&summary.OutputTokens,
+		&summary.CacheCreationInputTokens,
+		&summary.CacheReadInputTokens,
+		&summary.TotalCostUSD,
+		&summary.DurationMS,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage summary: %w", err)
+	}
+
+	return summary, nil
+}
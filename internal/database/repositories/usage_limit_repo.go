@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+
+	"habibi-go/internal/models"
+)
+
+// UsageLimitRepository handles database operations for prompts waiting for a usage limit
+// to reset
+type UsageLimitRepository struct {
+	db *sql.DB
+}
+
+// NewUsageLimitRepository creates a new usage limit repository
+func NewUsageLimitRepository(db *sql.DB) *UsageLimitRepository {
+	return &UsageLimitRepository{db: db}
+}
+
+// Save stores the prompt a session waits to retry, replacing the one it waited for before
+func (r *UsageLimitRepository) Save(wait *models.UsageLimitWait) error {
+	_, err := r.db.Exec(
+		`INSERT OR REPLACE INTO usage_limit_waits (session_id, turn_id, prompt, validation_iteration, message, reset_at, exact)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		wait.SessionID,
+		sql.NullInt64{Int64: int64(wait.TurnID), Valid: wait.TurnID != 0},
+		wait.Prompt,
+		wait.ValidationIteration,
+		wait.Message,
+		wait.ResetAt,
+		wait.Exact,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save usage limit wait: %w", err)
+	}
+	return nil
+}
+
+// GetAll retrieves the prompts every session waits to retry
+func (r *UsageLimitRepository) GetAll() ([]*models.UsageLimitWait, error) {
+	rows, err := r.db.Query(`
+		SELECT session_id, COALESCE(turn_id, 0), prompt, validation_iteration, message, reset_at, exact
+		FROM usage_limit_waits
+		ORDER BY session_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage limit waits: %w", err)
+	}
+	defer rows.Close()
+
+	var waits []*models.UsageLimitWait
+	for rows.Next() {
+		wait := &models.UsageLimitWait{}
+		err := rows.Scan(
+			&wait.SessionID,
+			&wait.TurnID,
+			&wait.Prompt,
+			&wait.ValidationIteration,
+			&wait.Message,
+			&wait.ResetAt,
+			&wait.Exact,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan usage limit wait: %w", err)
+		}
+		waits = append(waits, wait)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating usage limit waits: %w", err)
+	}
+	return waits, nil
+}
+
+// Delete forgets the prompt a session waits to retry
+func (r *UsageLimitRepository) Delete(sessionID int) error {
+	if _, err := r.db.Exec("DELETE FROM usage_limit_waits WHERE session_id = ?", sessionID); err != nil {
+		return fmt.Errorf("failed to delete usage limit wait: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"habibi-go/internal/models"
+)
+
+// ValidationRepository handles database operations for the checks run after turns
+type ValidationRepository struct {
+	db *sql.DB
+}
+
+// NewValidationRepository creates a new validation repository
+func NewValidationRepository(db *sql.DB) *ValidationRepository {
+	return &ValidationRepository{db: db}
+}
+
+// Create stores the outcome of a validation run
+func (r *ValidationRepository) Create(run *models.ValidationRun) error {
+	if run.CreatedAt.IsZero() {
+		run.CreatedAt = time.Now()
+	}
+	if run.Results == nil {
+		run.Results = []models.ValidationCheckResult{}
+	}
+
+	results, err := json.Marshal(run.Results)
+	if err != nil {
+		return fmt.Errorf("failed to marshal validation results: %w", err)
+	}
+
+	result, err := r.db.Exec(
+		`INSERT INTO validation_runs (session_id, turn_id, iteration, passed, results, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		run.SessionID,
+		run.TurnID,
+		run.Iteration,
+		run.Passed,
+		string(results),
+		run.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert validation run: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	run.ID = int(id)
+	return nil
+}
+
+// GetByTurnID retrieves the validation runs of a turn
+func (r *ValidationRepository) GetByTurnID(turnID int) ([]*models.ValidationRun, error) {
+	return r.query(`
+		SELECT id, session_id, turn_id, iteration, passed, results, created_at
+		FROM validation_runs
+		WHERE turn_id = ?
+		ORDER BY id ASC
+	`, turnID)
+}
+
+// GetBySessionID retrieves the most recent validation runs of a session in chronological order
+func (r *ValidationRepository) GetBySessionID(sessionID int, limit int) ([]*models.ValidationRun, error) {
+	runs, err := r.query(`
+		SELECT id, session_id, turn_id, iteration, passed, results, created_at
+		FROM validation_runs
+		WHERE session_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, sessionID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reverse to get chronological order
+	for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+		runs[i], runs[j] = runs[j], runs[i]
+	}
+
+	return runs, nil
+}
+
+func (r *ValidationRepository) query(query string, args ...interface{}) ([]*models.ValidationRun, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query validation runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*models.ValidationRun
+	for rows.Next() {
+		run := &models.ValidationRun{}
+		var results string
+
+		err := rows.Scan(
+			&run.ID,
+			&run.SessionID,
+			&run.TurnID,
+			&run.Iteration,
+			&run.Passed,
+			&results,
+			&run.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan validation run: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(results), &run.Results); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal validation results: %w", err)
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating validation runs: %w", err)
+	}
+
+	return runs, nil
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// AgentSettingsConfigKey is the project and session config key holding AgentSettings
+const AgentSettingsConfigKey = "agent"
+
+type PermissionMode string
+
+const (
+	PermissionModeDefault           PermissionMode = "default"
+	PermissionModeAcceptEdits       PermissionMode = "acceptEdits"
+	PermissionModePlan              PermissionMode = "plan"
+	PermissionModeBypassPermissions PermissionMode = "bypassPermissions"
+)
+
+// AgentSettings controls what the agent may do in a session's worktree and
+// which model runs it. Projects set defaults and sessions override them field by field;
+// Clear names fields to reset to the CLI default instead of inheriting them.
+type AgentSettings struct {
+	PermissionMode  string   `json:"permission_mode,omitempty"`
+	AllowedTools    []string `json:"allowed_tools,omitempty"`
+	DisallowedTools []string `json:"disallowed_tools,omitempty"`
+	AddDirs         []string `json:"add_dirs,omitempty"`
+
+	// Model, agentic turn limit and extra system prompt; empty means the CLI default
+	Model              string `json:"model,omitempty"`
+	MaxTurns           int    `json:"max_turns,omitempty"`
+	AppendSystemPrompt string `json:"append_system_prompt,omitempty"`
+
+	Clear []string `json:"clear,omitempty"`
+}
+
+// clearAgentSettings resets each field Clear can name, by its JSON name
+var clearAgentSettings = map[string]func(a *AgentSettings){
+	"permission_mode":      func(a *AgentSettings) { a.PermissionMode = "" },
+	"allowed_tools":        func(a *AgentSettings) { a.AllowedTools = nil },
+	"disallowed_tools":     func(a *AgentSettings) { a.DisallowedTools = nil },
+	"add_dirs":             func(a *AgentSettings) { a.AddDirs = nil },
+	"model":                func(a *AgentSettings) { a.Model = "" },
+	"max_turns":            func(a *AgentSettings) { a.MaxTurns = 0 },
+	"append_system_prompt": func(a *AgentSettings) { a.AppendSystemPrompt = "" },
+}
+
+// ParseAgentSettings reads and validates the agent settings stored in a config map.
+// A config without settings yields empty settings.
+func ParseAgentSettings(config map[string]interface{}) (*AgentSettings, error) {
+	settings := &AgentSettings{}
+
+	raw, exists := config[AgentSettingsConfigKey]
+	if !exists || raw == nil {
+		return settings, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal agent settings: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(settings); err != nil {
+		return nil, fmt.Errorf("invalid agent settings: %w", err)
+	}
+
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (a *AgentSettings) Validate() error {
+	if a.PermissionMode != "" && !IsValidPermissionMode(a.PermissionMode) {
+		return fmt.Errorf("invalid permission mode: %s", a.PermissionMode)
+	}
+
+	for _, tool := range append(append([]string{}, a.AllowedTools...), a.DisallowedTools...) {
+		if strings.TrimSpace(tool) == "" {
+			return fmt.Errorf("tool names must not be empty")
+		}
+	}
+
+	for _, dir := range a.AddDirs {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("additional directory must be an absolute path: %s", dir)
+		}
+	}
+
+	// A leading dash would make the CLI read the model as a flag
+	if strings.ContainsAny(a.Model, " \t\n") || strings.HasPrefix(a.Model, "-") {
+		return fmt.Errorf("invalid model: %q", a.Model)
+	}
+
+	if a.MaxTurns < 0 {
+		return fmt.Errorf("max turns must not be negative: %d", a.MaxTurns)
+	}
+
+	for _, field := range a.Clear {
+		reset, exists := clearAgentSettings[field]
+		if !exists {
+			return fmt.Errorf("unknown agent setting to clear: %s", field)
+		}
+		// A field both set and cleared is ambiguous
+		cleared := *a
+		reset(&cleared)
+		if !reflect.DeepEqual(cleared, *a) {
+			return fmt.Errorf("agent setting %s is both set and cleared", field)
+		}
+	}
+
+	return nil
+}
+
+// Merge returns a copy of the settings with every field the override clears reset and
+// every field it sets replaced
+func (a *AgentSettings) Merge(override *AgentSettings) *AgentSettings {
+	merged := *a
+	merged.Clear = nil
+	if override == nil {
+		return &merged
+	}
+
+	for _, field := range override.Clear {
+		if reset, exists := clearAgentSettings[field]; exists {
+			reset(&merged)
+		}
+	}
+	if override.PermissionMode != "" {
+		merged.PermissionMode = override.PermissionMode
+	}
+	if override.AllowedTools != nil {
+		merged.AllowedTools = override.AllowedTools
+	}
+	if override.DisallowedTools != nil {
+		merged.DisallowedTools = override.DisallowedTools
+	}
+	if override.AddDirs != nil {
+		merged.AddDirs = override.AddDirs
+	}
+	if override.Model != "" {
+		merged.Model = override.Model
+	}
+	if override.MaxTurns != 0 {
+		merged.MaxTurns = override.MaxTurns
+	}
+	if override.AppendSystemPrompt != "" {
+		merged.AppendSystemPrompt = override.AppendSystemPrompt
+	}
+	return &merged
+}
+
+// ResolveAgentSettings layers project and then session settings over the defaults
+func ResolveAgentSettings(defaults *AgentSettings, project *Project, session *Session) (*AgentSettings, error) {
+	if defaults == nil {
+		defaults = &AgentSettings{}
+	}
+
+	projectSettings, err := ParseAgentSettings(project.Config)
+	if err != nil {
+		return nil, fmt.Errorf("project %s: %w", project.Name, err)
+	}
+	sessionSettings, err := ParseAgentSettings(session.Config)
+	if err != nil {
+		return nil, fmt.Errorf("session %s: %w", session.Name, err)
+	}
+
+	settings := defaults.Merge(projectSettings).Merge(sessionSettings)
+	if settings.PermissionMode == "" {
+		settings.PermissionMode = string(PermissionModeDefault)
+	}
+	return settings, nil
+}
+
+func IsValidPermissionMode(mode string) bool {
+	switch PermissionMode(mode) {
+	case PermissionModeDefault, PermissionModeAcceptEdits, PermissionModePlan, PermissionModeBypassPermissions:
+		return true
+	default:
+		return false
+	}
+}
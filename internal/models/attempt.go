@@ -0,0 +1,105 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxAttempts caps how many sessions one best-of-N prompt may start
+const MaxAttempts = 8
+
+// AttemptGroup is one prompt sent to several new sessions started from the same base
+// branch, so the best result can be kept and the rest closed
+type AttemptGroup struct {
+	ID            int        `json:"id" db:"id"`
+	ProjectID     int        `json:"project_id" db:"project_id"`
+	Name          string     `json:"name" db:"name"`
+	Prompt        string     `json:"prompt" db:"prompt"`
+	BaseBranch    string     `json:"base_branch" db:"base_branch"`
+	Status        string     `json:"status" db:"status"`
+	KeptSessionID *int       `json:"kept_session_id" db:"kept_session_id"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	DecidedAt     *time.Time `json:"decided_at" db:"decided_at"`
+
+	Attempts []*Attempt `json:"attempts"`
+}
+
+// Attempt is one session of an attempt group. Its row outlives the session so a
+// decided group still shows what was tried.
+type Attempt struct {
+	ID          int    `json:"id" db:"id"`
+	GroupID     int    `json:"group_id" db:"group_id"`
+	Number      int    `json:"number" db:"number"`
+	SessionID   int    `json:"session_id" db:"session_id"`
+	SessionName string `json:"session_name" db:"session_name"`
+	BranchName  string `json:"branch_name" db:"branch_name"`
+	Status      string `json:"status" db:"status"`
+}
+
+type AttemptGroupStatus string
+
+const (
+	AttemptGroupStatusOpen    AttemptGroupStatus = "open"
+	AttemptGroupStatusDecided AttemptGroupStatus = "decided"
+)
+
+type AttemptStatus string
+
+const (
+	AttemptStatusOpen   AttemptStatus = "open"
+	AttemptStatusKept   AttemptStatus = "kept"
+	AttemptStatusClosed AttemptStatus = "closed"
+)
+
+type CreateAttemptGroupRequest struct {
+	ProjectID  int    `json:"project_id" binding:"required"`
+	Prompt     string `json:"prompt" binding:"required"`
+	Count      int    `json:"count" binding:"required"`
+	Name       string `json:"name"`        // Optional, prefix of the session and branch names
+	BaseBranch string `json:"base_branch"` // Optional, defaults to project's default branch
+}
+
+func (r *CreateAttemptGroupRequest) Validate() error {
+	if r.ProjectID == 0 {
+		return fmt.Errorf("project ID is required")
+	}
+
+	if strings.TrimSpace(r.Prompt) == "" {
+		return fmt.Errorf("prompt is required")
+	}
+
+	if r.Count < 2 || r.Count > MaxAttempts {
+		return fmt.Errorf("count must be between 2 and %d", MaxAttempts)
+	}
+
+	return nil
+}
+
+// AttemptName names the session and branch of an attempt
+func AttemptName(prefix string, number int) string {
+	return fmt.Sprintf("%s-%d", prefix, number)
+}
+
+// AttemptComparison puts the attempts of a group side by side
+type AttemptComparison struct {
+	Group    *AttemptGroup    `json:"group"`
+	Attempts []*AttemptResult `json:"attempts"`
+}
+
+// AttemptResult is where one attempt stands: its diff against the base branch, the
+// checks of its last validated turn and what it cost
+type AttemptResult struct {
+	Attempt *Attempt `json:"attempt"`
+	Running bool     `json:"running"`
+	Queued  int      `json:"queued"`
+	// Status of the attempt's most recent turn
+	TurnStatus   string `json:"turn_status,omitempty"`
+	FilesChanged int    `json:"files_changed"`
+	Additions    int    `json:"additions"`
+	Deletions    int    `json:"deletions"`
+	// Most recent validation run, if the project has checks
+	Validation *ValidationRun `json:"validation,omitempty"`
+	Usage      *UsageSummary  `json:"usage,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// BudgetConfigKey is the project and session config key holding BudgetSettings
+const BudgetConfigKey = "budget"
+
+// BudgetWarningRatio is the share of a budget at which viewers are warned
+const BudgetWarningRatio = 0.8
+
+// What happens to a prompt sent once a budget is used up
+const (
+	BudgetRefuse = "refuse"
+	BudgetQueue  = "queue"
+)
+
+// BudgetSettings caps what a project's sessions spend, in USD and in tokens (input plus
+// output). Daily and monthly budgets are set on projects and count every session of
+// the project. The session caps may be set on a project as the default for its
+// sessions; a session's own values replace the project's field by field.
+type BudgetSettings struct {
+	DailyUSD      *float64 `json:"daily_usd,omitempty"`
+	MonthlyUSD    *float64 `json:"monthly_usd,omitempty"`
+	DailyTokens   *int     `json:"daily_tokens,omitempty"`
+	MonthlyTokens *int     `json:"monthly_tokens,omitempty"`
+	SessionUSD    *float64 `json:"session_usd,omitempty"`
+	SessionTokens *int     `json:"session_tokens,omitempty"`
+	// OnExceeded is "refuse" (default) or "queue"
+	OnExceeded string `json:"on_exceeded,omitempty"`
+}
+
+// BudgetLimit is one budget and how much of it is used
+type BudgetLimit struct {
+	// Period is "daily", "monthly" or "session"
+	Period string `json:"period"`
+	// Unit is "usd" or "tokens"
+	Unit     string     `json:"unit"`
+	Limit    float64    `json:"limit"`
+	Used     float64    `json:"used"`
+	Percent  float64    `json:"percent"`
+	Exceeded bool       `json:"exceeded"`
+	ResetsAt *time.Time `json:"resets_at,omitempty"`
+}
+
+// BudgetStatus is the state of the budgets that apply to a project or one of its sessions
+type BudgetStatus struct {
+	ProjectID  int               `json:"project_id"`
+	SessionID  int               `json:"session_id,omitempty"`
+	OnExceeded string            `json:"on_exceeded"`
+	Limits     []*BudgetLimit    `json:"limits"`
+	Exceeded   bool              `json:"exceeded"`
+	Overrides  []*BudgetOverride `json:"overrides"`
+	// Blocked is set when a budget is used up and no override lifts it
+	Blocked bool `json:"blocked"`
+}
+
+// BudgetOverride lets a project's sessions, or one session, run past their budgets
+// until it expires
+type BudgetOverride struct {
+	ID        int       `json:"id" db:"id"`
+	ProjectID int       `json:"project_id" db:"project_id"`
+	SessionID *int      `json:"session_id,omitempty" db:"session_id"`
+	Reason    string    `json:"reason" db:"reason"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type BudgetOverrideRequest struct {
+	// Duration is how long the override lasts, e.g. "2h"
+	Duration string `json:"duration" binding:"required"`
+	Reason   string `json:"reason"`
+}
+
+func (r *BudgetOverrideRequest) Validate() (time.Duration, error) {
+	duration, err := time.ParseDuration(r.Duration)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid override duration: %s", r.Duration)
+	}
+	return duration, nil
+}
+
+// ParseBudgetSettings reads and validates the budget settings stored in a config map.
+// It returns nil if the config has none.
+func ParseBudgetSettings(config map[string]interface{}) (*BudgetSettings, error) {
+	raw, exists := config[BudgetConfigKey]
+	if !exists || raw == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal budget settings: %w", err)
+	}
+
+	settings := &BudgetSettings{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(settings); err != nil {
+		return nil, fmt.Errorf("invalid budget settings: %w", err)
+	}
+
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (b *BudgetSettings) Validate() error {
+	for name, value := range map[string]*float64{"daily_usd": b.DailyUSD, "monthly_usd": b.MonthlyUSD, "session_usd": b.SessionUSD} {
+		if value != nil && *value < 0 {
+			return fmt.Errorf("budget %s must not be negative", name)
+		}
+	}
+	for name, value := range map[string]*int{"daily_tokens": b.DailyTokens, "monthly_tokens": b.MonthlyTokens, "session_tokens": b.SessionTokens} {
+		if value != nil && *value < 0 {
+			return fmt.Errorf("budget %s must not be negative", name)
+		}
+	}
+
+	switch b.OnExceeded {
+	case "", BudgetRefuse, BudgetQueue:
+	default:
+		return fmt.Errorf("invalid budget on_exceeded %q (use refuse or queue)", b.OnExceeded)
+	}
+	return nil
+}
+
+// ResolveBudgetSettings merges a session's budget settings over its project's. The
+// session's daily and monthly values are ignored; those budgets belong to the project.
+func ResolveBudgetSettings(project *Project, session *Session) (*BudgetSettings, error) {
+	resolved := &BudgetSettings{}
+
+	if project != nil {
+		settings, err := ParseBudgetSettings(project.Config)
+		if err != nil {
+			return nil, fmt.Errorf("project %s: %w", project.Name, err)
+		}
+		if settings != nil {
+			*resolved = *settings
+		}
+	}
+
+	if session != nil {
+		settings, err := ParseBudgetSettings(session.Config)
+		if err != nil {
+			return nil, fmt.Errorf("session %s: %w", session.Name, err)
+		}
+		if settings != nil {
+			if settings.SessionUSD != nil {
+				resolved.SessionUSD = settings.SessionUSD
+			}
+			if settings.SessionTokens != nil {
+				resolved.SessionTokens = settings.SessionTokens
+			}
+			if settings.OnExceeded != "" {
+				resolved.OnExceeded = settings.OnExceeded
+			}
+		}
+	}
+
+	if resolved.OnExceeded == "" {
+		resolved.OnExceeded = BudgetRefuse
+	}
+	return resolved, nil
+}
+
+// NewBudgetLimit reports how much of a budget is used
+func NewBudgetLimit(period, unit string, limit, used float64, resetsAt *time.Time) *BudgetLimit {
+	budget := &BudgetLimit{
+		Period:   period,
+		Unit:     unit,
+		Limit:    limit,
+		Used:     used,
+		Exceeded: used >= limit,
+		ResetsAt: resetsAt,
+	}
+	if limit > 0 {
+		budget.Percent = used / limit * 100
+	}
+	return budget
+}
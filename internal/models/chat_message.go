@@ -8,6 +8,7 @@ type ChatMessage struct {
 	ID          int         `json:"id" db:"id"`
 	AgentID     int         `json:"agent_id" db:"agent_id"`     // Deprecated - will be removed
 	SessionID   int         `json:"session_id" db:"session_id"` // New field
+	TurnID      int         `json:"turn_id,omitempty" db:"turn_id"`
 	Role        string      `json:"role" db:"role"`
 	Content     string      `json:"content" db:"content"`
 	CreatedAt   time.Time   `json:"created_at" db:"created_at"`
@@ -15,6 +16,44 @@ type ChatMessage struct {
 	ToolInput   interface{} `json:"tool_input,omitempty" db:"tool_input"`
 	ToolUseID   string      `json:"tool_use_id,omitempty" db:"tool_use_id"`
 	ToolContent interface{} `json:"tool_content,omitempty" db:"tool_content"`
+
+	// ParentToolUseID is the tool call of the sub-agent that produced the message, if any
+	ParentToolUseID string `json:"parent_tool_use_id,omitempty" db:"parent_tool_use_id"`
+	// ContentType marks assistant messages that are not plain text: "thinking" or "image"
+	ContentType string      `json:"content_type,omitempty" db:"content_type"`
+	ContentData interface{} `json:"content_data,omitempty" db:"content_data"`
+}
+
+const (
+	ContentTypeThinking = "thinking"
+	ContentTypeImage    = "image"
+)
+
+// ChatMessageNode is a message with the sub-agent messages nested under its tool call
+type ChatMessageNode struct {
+	*ChatMessage
+	Children []*ChatMessageNode `json:"children,omitempty"`
+}
+
+// BuildMessageTree nests messages under the tool_use message whose ID they name as parent.
+// Messages whose parent is not among them stay on the top level, in order.
+func BuildMessageTree(messages []*ChatMessage) []*ChatMessageNode {
+	toolUses := make(map[string]*ChatMessageNode)
+	var roots []*ChatMessageNode
+
+	for _, msg := range messages {
+		node := &ChatMessageNode{ChatMessage: msg}
+		if parent, ok := toolUses[msg.ParentToolUseID]; ok && msg.ParentToolUseID != "" {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+		if msg.Role == "tool_use" && msg.ToolUseID != "" {
+			toolUses[msg.ToolUseID] = node
+		}
+	}
+
+	return roots
 }
 
 type CreateChatMessageRequest struct {
@@ -30,6 +30,9 @@ const (
 	EventTypeSessionActivated EventType = "session_activated"
 	EventTypeSessionPaused    EventType = "session_paused"
 	EventTypeSessionStopped   EventType = "session_stopped"
+	EventTypePermissionDecision EventType = "permission_decision"
+	EventTypeSessionInterrupted EventType = "session_interrupted"
+	EventTypeWorktreeRestored   EventType = "worktree_restored"
 	
 	// Agent events
 	EventTypeAgentCreated     EventType = "agent_created"
@@ -110,6 +113,7 @@ func (e *Event) IsValidEventType() bool {
 	case EventTypeProjectCreated, EventTypeProjectUpdated, EventTypeProjectDeleted,
 		 EventTypeSessionCreated, EventTypeSessionUpdated, EventTypeSessionDeleted,
 		 EventTypeSessionActivated, EventTypeSessionPaused, EventTypeSessionStopped,
+		 EventTypePermissionDecision, EventTypeSessionInterrupted, EventTypeWorktreeRestored,
 		 EventTypeAgentCreated, EventTypeAgentStarted, EventTypeAgentStopped,
 		 EventTypeAgentFailed, EventTypeAgentHeartbeat, EventTypeAgentCommand,
 		 EventTypeAgentResponse, EventTypeAgentFileUpload, EventTypeAgentFileDownload:
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MCP server transports Claude can connect to
+const (
+	MCPServerTypeStdio = "stdio"
+	MCPServerTypeHTTP  = "http"
+	MCPServerTypeSSE   = "sse"
+)
+
+// ReservedMCPServerName is the server habibi adds for its permission prompt tool
+const ReservedMCPServerName = "habibi"
+
+// Claude builds tool names as mcp__<server>__<tool>, so server names stay simple
+var mcpServerNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// MCPServer is an MCP server definition in a project's registry. Enabled is the default
+// for the project's sessions; each session can turn a server on or off for itself.
+type MCPServer struct {
+	ID        int               `json:"id" db:"id"`
+	ProjectID int               `json:"project_id" db:"project_id"`
+	Name      string            `json:"name" db:"name"`
+	Type      string            `json:"type" db:"type"`
+	Command   string            `json:"command,omitempty" db:"command"`
+	Args      []string          `json:"args,omitempty" db:"args"`
+	Env       map[string]string `json:"env,omitempty" db:"env"`
+	URL       string            `json:"url,omitempty" db:"url"`
+	Headers   map[string]string `json:"headers,omitempty" db:"headers"`
+	Enabled   bool              `json:"enabled" db:"enabled"`
+	CreatedAt time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+// SessionMCPServer is a project's MCP server as one session sees it
+type SessionMCPServer struct {
+	Server  *MCPServer `json:"server"`
+	Enabled bool       `json:"enabled"`
+	// Override is the session's own choice; nil means the project's default applies
+	Override *bool `json:"override"`
+}
+
+type MCPServerRequest struct {
+	Name    string            `json:"name" binding:"required"`
+	Type    string            `json:"type"` // Optional, defaults to stdio
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Env     map[string]string `json:"env"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Enabled *bool             `json:"enabled"` // Optional, defaults to true
+}
+
+func (r *MCPServerRequest) Validate() error {
+	if !mcpServerNamePattern.MatchString(r.Name) {
+		return fmt.Errorf("MCP server name may only contain letters, digits, '-' and '_'")
+	}
+	if r.Name == ReservedMCPServerName {
+		return fmt.Errorf("MCP server name %q is reserved", ReservedMCPServerName)
+	}
+
+	switch r.Type {
+	case "", MCPServerTypeStdio:
+		if strings.TrimSpace(r.Command) == "" {
+			return fmt.Errorf("stdio MCP server needs a command")
+		}
+	case MCPServerTypeHTTP, MCPServerTypeSSE:
+		if !strings.HasPrefix(r.URL, "http://") && !strings.HasPrefix(r.URL, "https://") {
+			return fmt.Errorf("%s MCP server needs an http or https URL", r.Type)
+		}
+	default:
+		return fmt.Errorf("unsupported MCP server type %q (use stdio, http or sse)", r.Type)
+	}
+
+	return nil
+}
+
+// Apply copies the request onto a server definition
+func (r *MCPServerRequest) Apply(server *MCPServer) {
+	server.Name = r.Name
+	server.Type = r.Type
+	if server.Type == "" {
+		server.Type = MCPServerTypeStdio
+	}
+
+	server.Command, server.Args, server.Env = "", nil, nil
+	server.URL, server.Headers = "", nil
+	if server.Type == MCPServerTypeStdio {
+		server.Command = r.Command
+		server.Args = r.Args
+		server.Env = r.Env
+	} else {
+		server.URL = r.URL
+		server.Headers = r.Headers
+	}
+
+	server.Enabled = r.Enabled == nil || *r.Enabled
+}
+
+// ClaudeConfig is the server's entry under "mcpServers" in a Claude MCP config file
+func (s *MCPServer) ClaudeConfig() map[string]interface{} {
+	entry := map[string]interface{}{"type": s.Type}
+	if s.Type == MCPServerTypeStdio {
+		args := s.Args
+		if args == nil {
+			args = []string{}
+		}
+		entry["command"] = s.Command
+		entry["args"] = args
+		if len(s.Env) > 0 {
+			entry["env"] = s.Env
+		}
+		return entry
+	}
+
+	entry["url"] = s.URL
+	if len(s.Headers) > 0 {
+		entry["headers"] = s.Headers
+	}
+	return entry
+}
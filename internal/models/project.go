@@ -88,6 +88,18 @@ func (p *Project) Validate() error {
 		p.DefaultBranch = "main"
 	}
 	
+	if _, err := ParseAgentSettings(p.Config); err != nil {
+		return err
+	}
+	
+	if _, err := ParseValidationSettings(p.Config); err != nil {
+		return err
+	}
+	
+	if _, err := ParseBudgetSettings(p.Config); err != nil {
+		return err
+	}
+	
 	return nil
 }
 
@@ -20,6 +20,12 @@ type Session struct {
 	LastActivityAt   *time.Time             `json:"last_activity_at" db:"last_activity_at"`
 	ActivityStatus   string                 `json:"activity_status" db:"activity_status"`
 	LastViewedAt     *time.Time             `json:"last_viewed_at" db:"last_viewed_at"`
+	ClaudeSessionID  string                 `json:"claude_session_id" db:"claude_session_id"`
+	// Agent backend that ClaudeSessionID belongs to
+	ConversationBackend string `json:"conversation_backend,omitempty" db:"conversation_backend"`
+	
+	// Effective agent settings after project and session config are applied
+	AgentSettings *AgentSettings `json:"agent_settings,omitempty" db:"-"`
 	
 	// Relationships
 	Project *Project `json:"project,omitempty"`
@@ -40,6 +46,7 @@ const (
 	ActivityStatusStreaming  SessionActivityStatus = "streaming"  // Currently receiving Claude response  
 	ActivityStatusNewResponse SessionActivityStatus = "new"       // New response since last view
 	ActivityStatusViewed     SessionActivityStatus = "viewed"     // Response has been viewed
+	ActivityStatusWaitingLimit SessionActivityStatus = "waiting_limit" // Waiting for a usage limit to reset
 )
 
 type CreateSessionRequest struct {
@@ -100,6 +107,18 @@ func (s *Session) Validate() error {
 		return fmt.Errorf("invalid session status: %s", s.Status)
 	}
 	
+	if _, err := ParseAgentSettings(s.Config); err != nil {
+		return err
+	}
+	
+	if _, err := ParseValidationSettings(s.Config); err != nil {
+		return err
+	}
+	
+	if _, err := ParseBudgetSettings(s.Config); err != nil {
+		return err
+	}
+	
 	return nil
 }
 
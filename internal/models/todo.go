@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// Todo is one item of the task list an agent keeps with its TodoWrite tool
+type Todo struct {
+	ID         string `json:"id,omitempty"`
+	Content    string `json:"content"`
+	ActiveForm string `json:"activeForm,omitempty"`
+	Status     string `json:"status"`
+	Priority   string `json:"priority,omitempty"`
+}
+
+const (
+	TodoStatusPending    = "pending"
+	TodoStatusInProgress = "in_progress"
+	TodoStatusCompleted  = "completed"
+)
+
+// TodoList is the whole task list as of one TodoWrite call; a session's latest one is its current list
+type TodoList struct {
+	ID        int       `json:"id" db:"id"`
+	SessionID int       `json:"session_id" db:"session_id"`
+	TurnID    int       `json:"turn_id,omitempty" db:"turn_id"`
+	ToolUseID string    `json:"tool_use_id,omitempty" db:"tool_use_id"`
+	Todos     []Todo    `json:"todos" db:"todos"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// InProgress returns the item being worked on, if any
+func (l *TodoList) InProgress() *Todo {
+	for i := range l.Todos {
+		if l.Todos[i].Status == TodoStatusInProgress {
+			return &l.Todos[i]
+		}
+	}
+	return nil
+}
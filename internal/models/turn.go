@@ -0,0 +1,151 @@
+package models
+
+import (
+	"time"
+)
+
+// Turn is a single Claude run triggered by one user prompt in a session
+type Turn struct {
+	ID              int        `json:"id" db:"id"`
+	SessionID       int        `json:"session_id" db:"session_id"`
+	ClaudeSessionID string     `json:"claude_session_id" db:"claude_session_id"`
+	Prompt          string     `json:"prompt" db:"prompt"`
+	Backend         string     `json:"backend" db:"backend"`
+	Status          string     `json:"status" db:"status"`
+	Error           string     `json:"error,omitempty" db:"error"`
+	StartedAt       time.Time  `json:"started_at" db:"started_at"`
+	CompletedAt     *time.Time `json:"completed_at" db:"completed_at"`
+
+	// Model settings the turn ran with; Model falls back to what the agent reported
+	Model              string `json:"model,omitempty" db:"model"`
+	MaxTurns           int    `json:"max_turns,omitempty" db:"max_turns"`
+	AppendSystemPrompt string `json:"append_system_prompt,omitempty" db:"append_system_prompt"`
+
+	// Commits holding the worktree as it was before and after the turn
+	SnapshotBefore string `json:"snapshot_before,omitempty" db:"snapshot_before"`
+	SnapshotAfter  string `json:"snapshot_after,omitempty" db:"snapshot_after"`
+
+	TurnUsage
+}
+
+// TurnUsage is the token, cost and timing data Claude reports in its result message
+type TurnUsage struct {
+	InputTokens              int     `json:"input_tokens" db:"input_tokens"`
+	OutputTokens             int     `json:"output_tokens" db:"output_tokens"`
+	CacheCreationInputTokens int     `json:"cache_creation_input_tokens" db:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int     `json:"cache_read_input_tokens" db:"cache_read_input_tokens"`
+	TotalCostUSD             float64 `json:"total_cost_usd" db:"total_cost_usd"`
+	DurationMS               int     `json:"duration_ms" db:"duration_ms"`
+	DurationAPIMS            int     `json:"duration_api_ms" db:"duration_api_ms"`
+	NumTurns                 int     `json:"num_turns" db:"num_turns"`
+	IsError                  bool    `json:"is_error" db:"is_error"`
+	ResultSubtype            string  `json:"result_subtype,omitempty" db:"result_subtype"`
+}
+
+// Add counts the usage of another result of the same turn; the status is the later one's
+func (u *TurnUsage) Add(other *TurnUsage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheCreationInputTokens += other.CacheCreationInputTokens
+	u.CacheReadInputTokens += other.CacheReadInputTokens
+	u.TotalCostUSD += other.TotalCostUSD
+	u.DurationMS += other.DurationMS
+	u.DurationAPIMS += other.DurationAPIMS
+	u.NumTurns += other.NumTurns
+	u.IsError = other.IsError
+	u.ResultSubtype = other.ResultSubtype
+}
+
+// UsageSummary aggregates turn usage for a session or project
+type UsageSummary struct {
+	TurnCount                int     `json:"turn_count"`
+	ErrorCount               int     `json:"error_count"`
+	InputTokens              int     `json:"input_tokens"`
+	OutputTokens             int     `json:"output_tokens"`
+	CacheCreationInputTokens int     `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int     `json:"cache_read_input_tokens"`
+	TotalCostUSD             float64 `json:"total_cost_usd"`
+	DurationMS               int     `json:"duration_ms"`
+}
+
+// TurnTranscript is the raw output a turn's agent wrote to stdout, gzip compressed.
+// LineTimes holds when each line arrived in Unix milliseconds; older transcripts have none.
+type TurnTranscript struct {
+	TurnID    int       `json:"turn_id" db:"turn_id"`
+	Backend   string    `json:"backend" db:"backend"`
+	Data      []byte    `json:"-" db:"data"`
+	LineCount int       `json:"line_count" db:"line_count"`
+	LineTimes []int64   `json:"-" db:"line_times"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type TurnStatus string
+
+const (
+	TurnStatusRunning   TurnStatus = "running"
+	TurnStatusCompleted TurnStatus = "completed"
+	TurnStatusFailed    TurnStatus = "failed"
+	TurnStatusStopped   TurnStatus = "stopped"
+	// Interrupted turns were running when the server went down
+	TurnStatusInterrupted TurnStatus = "interrupted"
+)
+
+// ClaudeConversation summarizes the turns that share one Claude conversation
+type ClaudeConversation struct {
+	ClaudeSessionID string    `json:"claude_session_id"`
+	Backend         string    `json:"backend"`
+	SessionID       int       `json:"session_id"`
+	TurnCount       int       `json:"turn_count"`
+	FirstPrompt     string    `json:"first_prompt"`
+	StartedAt       time.Time `json:"started_at"`
+	LastActiveAt    time.Time `json:"last_active_at"`
+	IsCurrent       bool      `json:"is_current"`
+}
+
+func NewTurn(sessionID int, claudeSessionID, prompt string) *Turn {
+	return &Turn{
+		SessionID:       sessionID,
+		ClaudeSessionID: claudeSessionID,
+		Prompt:          prompt,
+		Status:          string(TurnStatusRunning),
+		StartedAt:       time.Now(),
+	}
+}
+
+func (t *Turn) IsFinished() bool {
+	return t.Status != string(TurnStatusRunning)
+}
+
+// QueuedPrompt is a prompt waiting for the session's running turn to finish
+type QueuedPrompt struct {
+	ID        int       `json:"id"`
+	SessionID int       `json:"session_id"`
+	Prompt    string    `json:"prompt"`
+	Position  int       `json:"position"`
+	QueuedAt  time.Time `json:"queued_at"`
+
+	// ValidationIteration is set on fix-up prompts sent after failing checks, counting from 1
+	ValidationIteration int `json:"validation_iteration,omitempty"`
+}
+
+// UsageLimit is an account usage or rate limit a session's agent ran into. The turn that
+// hit it is retried once the limit resets.
+type UsageLimit struct {
+	SessionID int       `json:"session_id"`
+	TurnID    int       `json:"turn_id"`
+	Message   string    `json:"message"`
+	ResetAt   time.Time `json:"reset_at"`
+	// Exact is set when the agent said when the limit resets; otherwise ResetAt is a
+	// retry delay picked by habibi
+	Exact bool `json:"exact"`
+	// PromptID is the queued prompt that is retried once the limit resets
+	PromptID int `json:"prompt_id,omitempty"`
+}
+
+// UsageLimitWait is the prompt a session keeps for retry until its usage limit resets.
+// It is stored so a restarted server retries it too.
+type UsageLimitWait struct {
+	UsageLimit
+	Prompt              string `json:"prompt"`
+	ValidationIteration int    `json:"validation_iteration"`
+}
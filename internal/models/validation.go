@@ -0,0 +1,143 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ValidationConfigKey is the project and session config key holding ValidationSettings
+const ValidationConfigKey = "validation"
+
+const (
+	// DefaultValidationIterations is how many fix-up prompts are sent when max_iterations is not set
+	DefaultValidationIterations = 3
+	// DefaultValidationTimeout bounds a check that sets no timeout
+	DefaultValidationTimeout = 10 * time.Minute
+)
+
+// ValidationSettings lists the checks run in a session's worktree after each turn.
+// A session's settings replace its project's as a whole.
+type ValidationSettings struct {
+	Checks []ValidationCheck `json:"checks"`
+	// MaxIterations caps the fix-up prompts sent back to the agent while checks fail
+	MaxIterations *int `json:"max_iterations,omitempty"`
+}
+
+// ValidationCheck is one command that must exit with status 0, e.g. a build, test or lint
+type ValidationCheck struct {
+	Name    string `json:"name,omitempty"`
+	Command string `json:"command"`
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// ValidationRun records the outcome of the checks run after one turn
+type ValidationRun struct {
+	ID        int                     `json:"id" db:"id"`
+	SessionID int                     `json:"session_id" db:"session_id"`
+	TurnID    int                     `json:"turn_id" db:"turn_id"`
+	Iteration int                     `json:"iteration" db:"iteration"`
+	Passed    bool                    `json:"passed" db:"passed"`
+	Results   []ValidationCheckResult `json:"results" db:"results"`
+	CreatedAt time.Time               `json:"created_at" db:"created_at"`
+}
+
+// ValidationCheckResult is the outcome of one check
+type ValidationCheckResult struct {
+	Name       string `json:"name"`
+	Command    string `json:"command"`
+	Passed     bool   `json:"passed"`
+	ExitCode   int    `json:"exit_code"`
+	TimedOut   bool   `json:"timed_out,omitempty"`
+	Output     string `json:"output"`
+	DurationMS int    `json:"duration_ms"`
+}
+
+// ParseValidationSettings reads and validates the validation settings stored in a
+// config map. It returns nil if the config has none.
+func ParseValidationSettings(config map[string]interface{}) (*ValidationSettings, error) {
+	raw, exists := config[ValidationConfigKey]
+	if !exists || raw == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal validation settings: %w", err)
+	}
+
+	settings := &ValidationSettings{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(settings); err != nil {
+		return nil, fmt.Errorf("invalid validation settings: %w", err)
+	}
+
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (v *ValidationSettings) Validate() error {
+	for i, check := range v.Checks {
+		if strings.TrimSpace(check.Command) == "" {
+			return fmt.Errorf("validation check %d has no command", i+1)
+		}
+		if check.Timeout != "" {
+			if timeout, err := time.ParseDuration(check.Timeout); err != nil || timeout <= 0 {
+				return fmt.Errorf("invalid timeout for validation check %q: %s", check.DisplayName(), check.Timeout)
+			}
+		}
+	}
+
+	if v.MaxIterations != nil && *v.MaxIterations < 0 {
+		return fmt.Errorf("max iterations must not be negative: %d", *v.MaxIterations)
+	}
+
+	return nil
+}
+
+// Iterations returns how many fix-up prompts may be sent in a row
+func (v *ValidationSettings) Iterations() int {
+	if v.MaxIterations == nil {
+		return DefaultValidationIterations
+	}
+	return *v.MaxIterations
+}
+
+// DisplayName names the check in results and prompts, falling back to its command
+func (c ValidationCheck) DisplayName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Command
+}
+
+// TimeoutDuration returns how long the check may run
+func (c ValidationCheck) TimeoutDuration() time.Duration {
+	if timeout, err := time.ParseDuration(c.Timeout); err == nil && timeout > 0 {
+		return timeout
+	}
+	return DefaultValidationTimeout
+}
+
+// ResolveValidationSettings picks the session's validation settings, then the project's.
+// It returns nil when neither configures any.
+func ResolveValidationSettings(project *Project, session *Session) (*ValidationSettings, error) {
+	settings, err := ParseValidationSettings(session.Config)
+	if err != nil {
+		return nil, fmt.Errorf("session %s: %w", session.Name, err)
+	}
+	if settings != nil {
+		return settings, nil
+	}
+
+	settings, err = ParseValidationSettings(project.Config)
+	if err != nil {
+		return nil, fmt.Errorf("project %s: %w", project.Name, err)
+	}
+	return settings, nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"habibi-go/internal/util"
+)
+
+// agentProcess is a running agent CLI invocation, either local or on an SSH host
+type agentProcess interface {
+	// Stdin is nil unless the process was started to read prompts from it
+	Stdin() io.WriteCloser
+	Stdout() io.Reader
+	Stderr() io.Reader
+	Wait() error
+	// Interrupt sends SIGINT to the process and its children, then kills whatever is
+	// left once exited is closed or the grace period passes
+	Interrupt(exited <-chan struct{}, grace time.Duration) error
+	// Kill stops the process and its children immediately
+	Kill() error
+}
+
+// localAgentProcess runs an agent on this machine in its own process group
+type localAgentProcess struct {
+	cmd            *exec.Cmd
+	stdin          io.WriteCloser
+	stdout         io.Reader
+	stderr         io.Reader
+	processManager *util.ProcessManager
+}
+
+// startLocalAgentProcess starts command in dir with the given arguments. With
+// withStdin set the process gets a stdin pipe; otherwise it reads nothing.
+func startLocalAgentProcess(processManager *util.ProcessManager, command, dir string, args []string, withStdin bool) (*localAgentProcess, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Dir = dir
+	// Own process group so stopping the turn also stops the tools it started
+	processManager.SetProcessGroup(cmd)
+
+	var stdin io.WriteCloser
+	if withStdin {
+		var err error
+		if stdin, err = cmd.StdinPipe(); err != nil {
+			return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
+		}
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", command, err)
+	}
+
+	return &localAgentProcess{
+		cmd:            cmd,
+		stdin:          stdin,
+		stdout:         stdout,
+		stderr:         stderr,
+		processManager: processManager,
+	}, nil
+}
+
+func (p *localAgentProcess) Stdin() io.WriteCloser {
+	return p.stdin
+}
+
+func (p *localAgentProcess) Stdout() io.Reader {
+	return p.stdout
+}
+
+func (p *localAgentProcess) Stderr() io.Reader {
+	return p.stderr
+}
+
+func (p *localAgentProcess) Wait() error {
+	return p.cmd.Wait()
+}
+
+func (p *localAgentProcess) Interrupt(exited <-chan struct{}, grace time.Duration) error {
+	return p.processManager.InterruptProcessGroup(p.cmd.Process.Pid, exited, grace)
+}
+
+func (p *localAgentProcess) Kill() error {
+	return p.processManager.SignalProcessGroup(p.cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,598 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"habibi-go/internal/models"
+	"habibi-go/internal/streamjson"
+)
+
+// DefaultAgentBackend is the backend used when neither the session nor the project picks one
+const DefaultAgentBackend = "claude"
+
+// validateAgentBackend checks that the agent_backend a project or session config picks is
+// one of the registered backends. Nothing is checked while no backends are known.
+func validateAgentBackend(config map[string]interface{}, backends []string) error {
+	raw, exists := config["agent_backend"]
+	if !exists || raw == nil || len(backends) == 0 {
+		return nil
+	}
+
+	name, ok := raw.(string)
+	if !ok {
+		return fmt.Errorf("agent_backend must be a string")
+	}
+	if name == "" {
+		return nil
+	}
+	for _, backend := range backends {
+		if backend == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown agent backend %q (available: %s)", name, strings.Join(backends, ", "))
+}
+
+// AgentEventType identifies what an agent reported in its output
+type AgentEventType string
+
+const (
+	// AgentEventText is a complete assistant message
+	AgentEventText AgentEventType = "text"
+	// AgentEventTextDelta is streamed text that is shown live but not saved on its own
+	AgentEventTextDelta AgentEventType = "text_delta"
+	// AgentEventThinking is the model's visible reasoning before it answers
+	AgentEventThinking AgentEventType = "thinking"
+	// AgentEventImage is an image the agent produced; Data holds its source
+	AgentEventImage   AgentEventType = "image"
+	AgentEventToolUse AgentEventType = "tool_use"
+	// AgentEventToolResult carries the output of an earlier tool use
+	AgentEventToolResult AgentEventType = "tool_result"
+	// AgentEventSession reports the agent's own conversation ID so it can be resumed,
+	// and the model it runs if known
+	AgentEventSession AgentEventType = "session"
+	// AgentEventResult ends a turn with usage and error status
+	AgentEventResult AgentEventType = "result"
+	// AgentEventUnknown is output the parser does not understand; Data holds it as received
+	AgentEventUnknown AgentEventType = "unknown"
+)
+
+// AgentEvent is one unit of agent output, independent of the backend's wire format.
+// The JSON form is also the line format of the jsonl output parser.
+type AgentEvent struct {
+	Type        AgentEventType `json:"type"`
+	Text        string         `json:"text,omitempty"`
+	ToolName    string         `json:"tool_name,omitempty"`
+	ToolUseID   string         `json:"tool_use_id,omitempty"`
+	ToolInput   interface{}    `json:"tool_input,omitempty"`
+	ToolContent interface{}    `json:"tool_content,omitempty"`
+	SessionID   string         `json:"session_id,omitempty"`
+	Model       string         `json:"model,omitempty"`
+	StreamID    string         `json:"stream_id,omitempty"` // ties text deltas to the text event that completes them
+	// ParentToolUseID nests sub-agent output under the tool call that started the sub-agent
+	ParentToolUseID string            `json:"parent_tool_use_id,omitempty"`
+	Data            interface{}       `json:"data,omitempty"`
+	Usage           *models.TurnUsage `json:"usage,omitempty"`
+	Error           string            `json:"error,omitempty"`
+}
+
+// AgentRunRequest describes one turn for a runner
+type AgentRunRequest struct {
+	Prompt       string
+	ResumeID     string
+	WorktreePath string
+	// Remote is set when the command runs on the project's SSH host
+	Remote bool
+	// Settings are the resolved permission, tool and model settings for the session
+	Settings *models.AgentSettings
+	// PermissionMCPConfig is the MCP config for habibi's permission prompt tool, if enabled
+	PermissionMCPConfig string
+	// MCPConfigPath is the MCP config file of the project servers the session loads, if any
+	MCPConfigPath string
+	// StreamInput starts a process that stays up and reads prompts from stdin instead of Prompt
+	StreamInput bool
+}
+
+// AgentRunner adapts a coding agent CLI to the session chat workflow
+type AgentRunner interface {
+	// Name is the backend name used in project and session config
+	Name() string
+	// Command returns the binary and arguments that run one turn
+	Command(req *AgentRunRequest) (string, []string, error)
+	// NewParser returns a parser for the output of one turn
+	NewParser() AgentOutputParser
+}
+
+// StreamingAgentRunner is a backend whose process can serve many turns, reading each prompt from stdin
+type StreamingAgentRunner interface {
+	AgentRunner
+	// EncodeInput formats a prompt as input for a process started with StreamInput
+	EncodeInput(prompt string) ([]byte, error)
+}
+
+// AgentOutputParser turns an agent's stdout into events, one line at a time
+type AgentOutputParser interface {
+	ParseLine(line string) []AgentEvent
+	// Flush returns any events still buffered when output ends
+	Flush() []AgentEvent
+}
+
+// AgentRegistry holds the agent backends available to sessions
+type AgentRegistry struct {
+	runners map[string]AgentRunner
+	mutex   sync.RWMutex
+}
+
+// NewAgentRegistry creates an empty registry
+func NewAgentRegistry() *AgentRegistry {
+	return &AgentRegistry{
+		runners: make(map[string]AgentRunner),
+	}
+}
+
+// Register adds a backend, replacing any backend with the same name
+func (r *AgentRegistry) Register(runner AgentRunner) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.runners[runner.Name()] = runner
+}
+
+// Get returns the backend with the given name
+func (r *AgentRegistry) Get(name string) (AgentRunner, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	runner, exists := r.runners[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown agent backend %q", name)
+	}
+	return runner, nil
+}
+
+// Names lists the registered backends in alphabetical order
+func (r *AgentRegistry) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.runners))
+	for name := range r.runners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// claudeRunner runs the Claude CLI with stream-json output
+type claudeRunner struct {
+	binaryPath      string
+	partialMessages bool
+}
+
+func newClaudeRunner(binaryPath string) *claudeRunner {
+	if binaryPath == "" {
+		binaryPath = "claude"
+	}
+	return &claudeRunner{binaryPath: binaryPath, partialMessages: true}
+}
+
+// NewClaudeRunner creates the Claude backend. With partialMessages set, assistant
+// text streams token by token instead of arriving one message at a time.
+func NewClaudeRunner(binaryPath string, partialMessages bool) AgentRunner {
+	runner := newClaudeRunner(binaryPath)
+	runner.partialMessages = partialMessages
+	return runner
+}
+
+func (r *claudeRunner) Name() string {
+	return DefaultAgentBackend
+}
+
+func (r *claudeRunner) Command(req *AgentRunRequest) (string, []string, error) {
+	// Permission flags go first: the list flags take several values and must not swallow the prompt
+	args := claudePermissionArgs(req.Settings)
+	args = append(args, claudeModelArgs(req.Settings)...)
+
+	// --mcp-config takes several values; the flags after it end the list
+	var mcpConfigs []string
+	if req.MCPConfigPath != "" {
+		mcpConfigs = append(mcpConfigs, req.MCPConfigPath)
+	}
+	if req.PermissionMCPConfig != "" {
+		mcpConfigs = append(mcpConfigs, req.PermissionMCPConfig)
+	}
+	if len(mcpConfigs) > 0 {
+		args = append(args, "--mcp-config")
+		args = append(args, mcpConfigs...)
+	}
+	if req.PermissionMCPConfig != "" {
+		args = append(args, "--permission-prompt-tool", PermissionPromptTool)
+	}
+
+	// Resume the exact conversation tracked for this session; without one a new conversation is started
+	// Note: message should come last, and --verbose is required for proper output
+	args = append(args, "--verbose", "--output-format", "stream-json")
+	if r.partialMessages {
+		args = append(args, "--include-partial-messages")
+	}
+	if req.ResumeID != "" {
+		args = append(args, "--resume", req.ResumeID)
+	}
+	if req.StreamInput {
+		args = append(args, "--print", "--input-format", "stream-json")
+	} else {
+		args = append(args, req.Prompt)
+	}
+
+	// The configured binary path is local; remote hosts resolve claude from PATH
+	if req.Remote {
+		return "claude", args, nil
+	}
+	return r.binaryPath, args, nil
+}
+
+// EncodeInput wraps a prompt in the user message line Claude's stream-json input expects
+func (r *claudeRunner) EncodeInput(prompt string) ([]byte, error) {
+	line, err := json.Marshal(map[string]interface{}{
+		"type": "user",
+		"message": map[string]interface{}{
+			"role": "user",
+			"content": []map[string]interface{}{
+				{"type": "text", "text": prompt},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode prompt: %w", err)
+	}
+	return append(line, '\n'), nil
+}
+
+// claudePermissionArgs converts agent settings to Claude CLI flags
+func claudePermissionArgs(settings *models.AgentSettings) []string {
+	if settings == nil {
+		return nil
+	}
+
+	var args []string
+	switch settings.PermissionMode {
+	case "", string(models.PermissionModeDefault):
+	case string(models.PermissionModeBypassPermissions):
+		args = append(args, "--dangerously-skip-permissions")
+	default:
+		args = append(args, "--permission-mode", settings.PermissionMode)
+	}
+	if len(settings.AllowedTools) > 0 {
+		args = append(args, "--allowedTools", strings.Join(settings.AllowedTools, ","))
+	}
+	if len(settings.DisallowedTools) > 0 {
+		args = append(args, "--disallowedTools", strings.Join(settings.DisallowedTools, ","))
+	}
+	for _, dir := range settings.AddDirs {
+		args = append(args, "--add-dir", dir)
+	}
+	return args
+}
+
+// claudeModelArgs converts the model settings to Claude CLI flags
+func claudeModelArgs(settings *models.AgentSettings) []string {
+	if settings == nil {
+		return nil
+	}
+
+	var args []string
+	if settings.Model != "" {
+		args = append(args, "--model", settings.Model)
+	}
+	if settings.MaxTurns > 0 {
+		args = append(args, "--max-turns", strconv.Itoa(settings.MaxTurns))
+	}
+	if settings.AppendSystemPrompt != "" {
+		args = append(args, "--append-system-prompt", settings.AppendSystemPrompt)
+	}
+	return args
+}
+
+func (r *claudeRunner) NewParser() AgentOutputParser {
+	return &claudeStreamParser{
+		blocks:  make(map[string]*strings.Builder),
+		pending: make(map[string][]string),
+	}
+}
+
+// claudeStreamParser reads Claude's stream-json output. Partial text is streamed
+// as deltas; the complete assistant message that follows is what gets saved.
+type claudeStreamParser struct {
+	messageID string
+	// Text streamed so far per content block, keyed by stream ID
+	blocks map[string]*strings.Builder
+	// Stream IDs per message whose complete text has not arrived yet, in order
+	pending map[string][]string
+	order   []string
+}
+
+func (p *claudeStreamParser) ParseLine(line string) []AgentEvent {
+	msg, err := streamjson.Decode([]byte(line))
+	if err != nil {
+		fmt.Printf("Failed to parse as JSON (error: %v), treating as plain text: %s\n", err, line)
+		return []AgentEvent{{Type: AgentEventTextDelta, Text: line + "\n"}}
+	}
+
+	switch m := msg.(type) {
+	case *streamjson.StreamEvent:
+		return p.streamEvents(m)
+	case *streamjson.AssistantMessage:
+		// Each assistant message is complete, not a delta
+		return p.contentEvents(&m.Envelope, &m.Message)
+	case *streamjson.UserMessage:
+		// Tool results come back as user messages
+		return p.contentEvents(&m.Envelope, &m.Message)
+	case *streamjson.SystemMessage:
+		fmt.Printf("System message: subtype=%s session=%s\n", m.Subtype, m.SessionID)
+		if m.SessionID == "" {
+			return nil
+		}
+		return []AgentEvent{{Type: AgentEventSession, SessionID: m.SessionID, Model: m.Model}}
+	case *streamjson.ResultMessage:
+		fmt.Printf("Result message: subtype=%s is_error=%v\n", m.Subtype, m.IsError)
+		var events []AgentEvent
+		if m.SessionID != "" {
+			events = append(events, AgentEvent{Type: AgentEventSession, SessionID: m.SessionID})
+		}
+		usage := parseTurnUsage(m)
+		event := AgentEvent{Type: AgentEventResult, Usage: &usage}
+		if usage.IsError {
+			event.Error = m.Result
+			if event.Error == "" {
+				event.Error = usage.ResultSubtype
+			}
+		}
+		return append(events, event)
+	case *streamjson.BlockMessage:
+		// Older CLI versions sent tool blocks on their own lines
+		return p.blockEvents(&m.Envelope, "assistant", "", &m.Block)
+	case *streamjson.UnknownMessage:
+		fmt.Printf("Unknown stream message type=%s\n", m.Type)
+		return []AgentEvent{{Type: AgentEventUnknown, ParentToolUseID: m.ParentToolUseID, Data: json.RawMessage(line)}}
+	}
+
+	return nil
+}
+
+// streamEvents handles the partial message events of --include-partial-messages
+func (p *claudeStreamParser) streamEvents(msg *streamjson.StreamEvent) []AgentEvent {
+	event := msg.Event
+	streamID := fmt.Sprintf("%s:%d", p.messageID, event.Index)
+
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			p.messageID = event.Message.ID
+		}
+	case "content_block_start":
+		block := event.ContentBlock
+		if block == nil || block.Type != streamjson.BlockText {
+			return nil
+		}
+		p.startBlock(streamID)
+		if block.Text != "" {
+			p.blocks[streamID].WriteString(block.Text)
+			return []AgentEvent{{Type: AgentEventTextDelta, Text: block.Text, StreamID: streamID, ParentToolUseID: msg.ParentToolUseID}}
+		}
+	case "content_block_delta":
+		delta := event.Delta
+		if delta == nil || delta.Text == "" {
+			return nil
+		}
+		if delta.Type != "text_delta" {
+			return nil
+		}
+		if _, exists := p.blocks[streamID]; !exists {
+			p.startBlock(streamID)
+		}
+		p.blocks[streamID].WriteString(delta.Text)
+		return []AgentEvent{{Type: AgentEventTextDelta, Text: delta.Text, StreamID: streamID, ParentToolUseID: msg.ParentToolUseID}}
+	}
+
+	return nil
+}
+
+func (p *claudeStreamParser) startBlock(streamID string) {
+	p.blocks[streamID] = &strings.Builder{}
+	p.pending[p.messageID] = append(p.pending[p.messageID], streamID)
+	p.order = append(p.order, streamID)
+}
+
+// finishBlock takes the oldest streamed text block of a message, now that its complete text arrived
+func (p *claudeStreamParser) finishBlock(messageID string) string {
+	pending := p.pending[messageID]
+	if len(pending) == 0 {
+		return ""
+	}
+	streamID := pending[0]
+	p.pending[messageID] = pending[1:]
+	delete(p.blocks, streamID)
+	return streamID
+}
+
+// Flush saves text that streamed in but never arrived as a complete message, e.g. after a stop
+func (p *claudeStreamParser) Flush() []AgentEvent {
+	var events []AgentEvent
+	for _, streamID := range p.order {
+		block, exists := p.blocks[streamID]
+		if !exists || block.Len() == 0 {
+			continue
+		}
+		events = append(events, AgentEvent{Type: AgentEventText, Text: block.String(), StreamID: streamID})
+	}
+	p.blocks = make(map[string]*strings.Builder)
+	p.pending = make(map[string][]string)
+	p.order = nil
+	return events
+}
+
+// contentEvents converts the content blocks of an assistant or user message
+func (p *claudeStreamParser) contentEvents(envelope *streamjson.Envelope, message *streamjson.APIMessage) []AgentEvent {
+	var events []AgentEvent
+	for i := range message.Content {
+		events = append(events, p.blockEvents(envelope, message.Role, message.ID, &message.Content[i])...)
+	}
+	return events
+}
+
+// blockEvents converts one content block. Text and images in user messages are prompts,
+// which habibi saved itself or which repeat a sub-agent's Task input, so they are skipped.
+func (p *claudeStreamParser) blockEvents(envelope *streamjson.Envelope, role, messageID string, block *streamjson.ContentBlock) []AgentEvent {
+	parent := envelope.ParentToolUseID
+
+	switch block.Type {
+	case streamjson.BlockText:
+		if block.Text == "" || role == "user" {
+			return nil
+		}
+		return []AgentEvent{{Type: AgentEventText, Text: block.Text, StreamID: p.finishBlock(messageID), ParentToolUseID: parent}}
+	case streamjson.BlockThinking:
+		if block.Thinking == "" {
+			return nil
+		}
+		return []AgentEvent{{Type: AgentEventThinking, Text: block.Thinking, ParentToolUseID: parent}}
+	case streamjson.BlockRedactedThinking:
+		// Encrypted reasoning has nothing to show
+		return nil
+	case streamjson.BlockImage:
+		if role == "user" || block.Source == nil {
+			return nil
+		}
+		return []AgentEvent{{Type: AgentEventImage, Data: block.Source, ParentToolUseID: parent}}
+	case streamjson.BlockToolUse:
+		return []AgentEvent{{Type: AgentEventToolUse, ToolName: block.Name, ToolUseID: block.ID, ToolInput: block.Input, ParentToolUseID: parent}}
+	case streamjson.BlockToolResult:
+		return []AgentEvent{{Type: AgentEventToolResult, ToolUseID: block.ToolUseID, ToolContent: block.Content, ParentToolUseID: parent}}
+	default:
+		fmt.Printf("Unknown content block type=%s\n", block.Type)
+		return []AgentEvent{{Type: AgentEventUnknown, ParentToolUseID: parent, Data: block}}
+	}
+}
+
+// parseTurnUsage extracts usage fields from a stream-json result message
+func parseTurnUsage(msg *streamjson.ResultMessage) models.TurnUsage {
+	return models.TurnUsage{
+		InputTokens:              msg.Usage.InputTokens,
+		OutputTokens:             msg.Usage.OutputTokens,
+		CacheCreationInputTokens: msg.Usage.CacheCreationInputTokens,
+		CacheReadInputTokens:     msg.Usage.CacheReadInputTokens,
+		TotalCostUSD:             msg.TotalCostUSD,
+		DurationMS:               msg.DurationMS,
+		DurationAPIMS:            msg.DurationAPIMS,
+		NumTurns:                 msg.NumTurns,
+		IsError:                  msg.IsError,
+		ResultSubtype:            msg.Subtype,
+	}
+}
+
+// Output formats understood by command runners
+const (
+	AgentOutputText  = "text"
+	AgentOutputJSONL = "jsonl"
+)
+
+// commandRunner runs any CLI described by a command and argument templates.
+// Arguments are Go templates over AgentRunRequest, e.g. "{{.Prompt}}" or
+// "{{.Settings.PermissionMode}}";
+// arguments that render empty are dropped so flags can be optional.
+type commandRunner struct {
+	name    string
+	command string
+	args    []*template.Template
+	output  string
+}
+
+// NewCommandRunner creates a generic backend from a command template and output format
+func NewCommandRunner(name, command string, args []string, output string) (AgentRunner, error) {
+	if name == "" || command == "" {
+		return nil, fmt.Errorf("agent backend needs a name and a command")
+	}
+	if output == "" {
+		output = AgentOutputText
+	}
+	if output != AgentOutputText && output != AgentOutputJSONL {
+		return nil, fmt.Errorf("agent backend %s: unsupported output format %q", name, output)
+	}
+
+	runner := &commandRunner{name: name, command: command, output: output}
+	for i, arg := range args {
+		tmpl, err := template.New(fmt.Sprintf("%s-arg-%d", name, i)).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("agent backend %s: invalid argument template %q: %w", name, arg, err)
+		}
+		runner.args = append(runner.args, tmpl)
+	}
+
+	return runner, nil
+}
+
+func (r *commandRunner) Name() string {
+	return r.name
+}
+
+func (r *commandRunner) Command(req *AgentRunRequest) (string, []string, error) {
+	args := make([]string, 0, len(r.args))
+	for _, tmpl := range r.args {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, req); err != nil {
+			return "", nil, fmt.Errorf("failed to render arguments for %s: %w", r.name, err)
+		}
+		if buf.Len() > 0 {
+			args = append(args, buf.String())
+		}
+	}
+	return r.command, args, nil
+}
+
+func (r *commandRunner) NewParser() AgentOutputParser {
+	if r.output == AgentOutputJSONL {
+		return &jsonlOutputParser{}
+	}
+	return &textOutputParser{}
+}
+
+// textOutputParser streams plain output and saves it as one assistant message at the end
+type textOutputParser struct {
+	text strings.Builder
+}
+
+func (p *textOutputParser) ParseLine(line string) []AgentEvent {
+	p.text.WriteString(line)
+	p.text.WriteString("\n")
+	return []AgentEvent{{Type: AgentEventTextDelta, Text: line + "\n"}}
+}
+
+func (p *textOutputParser) Flush() []AgentEvent {
+	text := strings.TrimSpace(p.text.String())
+	p.text.Reset()
+	if text == "" {
+		return nil
+	}
+	return []AgentEvent{{Type: AgentEventText, Text: text}}
+}
+
+// jsonlOutputParser reads one AgentEvent JSON object per line; other lines are shown as text
+type jsonlOutputParser struct{}
+
+func (p *jsonlOutputParser) ParseLine(line string) []AgentEvent {
+	var event AgentEvent
+	if err := json.Unmarshal([]byte(line), &event); err != nil || event.Type == "" {
+		return []AgentEvent{{Type: AgentEventTextDelta, Text: line + "\n"}}
+	}
+	return []AgentEvent{event}
+}
+
+func (p *jsonlOutputParser) Flush() []AgentEvent {
+	return nil
+}
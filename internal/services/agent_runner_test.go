@@ -0,0 +1,96 @@
+package services
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// parseFixture runs the Claude parser over a stream-json fixture
+func parseFixture(t *testing.T, name string) []AgentEvent {
+	t.Helper()
+
+	file, err := os.Open(filepath.Join("..", "streamjson", "testdata", name))
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	defer file.Close()
+
+	parser := newClaudeRunner("").NewParser()
+	var events []AgentEvent
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		events = append(events, parser.ParseLine(scanner.Text())...)
+	}
+	return append(events, parser.Flush()...)
+}
+
+func TestClaudeParserNestsSubAgentOutput(t *testing.T) {
+	events := parseFixture(t, "subagent.jsonl")
+
+	want := []struct {
+		eventType AgentEventType
+		parent    string
+	}{
+		{AgentEventToolUse, ""},
+		// The sub-agent's prompt repeats the Task input and is skipped
+		{AgentEventToolUse, "toolu_task"},
+		{AgentEventToolResult, "toolu_task"},
+		{AgentEventText, "toolu_task"},
+		{AgentEventToolResult, ""},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		if events[i].Type != w.eventType || events[i].ParentToolUseID != w.parent {
+			t.Errorf("event %d: got %s under %q, want %s under %q", i, events[i].Type, events[i].ParentToolUseID, w.eventType, w.parent)
+		}
+	}
+}
+
+func TestClaudeParserKeepsThinkingImagesAndUnknown(t *testing.T) {
+	counts := make(map[AgentEventType]int)
+	for _, name := range []string{"thinking_and_images.jsonl", "unknown.jsonl"} {
+		for _, event := range parseFixture(t, name) {
+			counts[event.Type]++
+		}
+	}
+
+	if counts[AgentEventThinking] != 1 {
+		t.Errorf("got %d thinking events, want 1", counts[AgentEventThinking])
+	}
+	if counts[AgentEventImage] != 1 {
+		t.Errorf("got %d image events, want 1", counts[AgentEventImage])
+	}
+	// The rate limit notice and the server tool use block
+	if counts[AgentEventUnknown] != 2 {
+		t.Errorf("got %d unknown events, want 2", counts[AgentEventUnknown])
+	}
+}
+
+func TestClaudeParserStreamsAndSavesText(t *testing.T) {
+	events := parseFixture(t, "simple_turn.jsonl")
+
+	var texts []string
+	var result *AgentEvent
+	for i, event := range events {
+		switch event.Type {
+		case AgentEventText:
+			texts = append(texts, event.Text)
+		case AgentEventResult:
+			result = &events[i]
+		}
+	}
+
+	if len(texts) != 2 || texts[1] != "All tests pass." {
+		t.Errorf("unexpected text events: %q", texts)
+	}
+	if result == nil || result.Usage.NumTurns != 3 || result.Usage.OutputTokens != 57 {
+		t.Fatalf("unexpected result event: %+v", result)
+	}
+}
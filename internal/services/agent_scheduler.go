@@ -0,0 +1,229 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RunPriority orders runs waiting for a free agent slot; lower values run first
+type RunPriority int
+
+const (
+	// PriorityInteractive is used for prompts a user is waiting on
+	PriorityInteractive RunPriority = iota
+	// PriorityScheduled is used for runs started automatically in the background
+	PriorityScheduled
+)
+
+func (p RunPriority) String() string {
+	if p == PriorityScheduled {
+		return "scheduled"
+	}
+	return "interactive"
+}
+
+// SchedulerTicket is one run's claim on an agent slot
+type SchedulerTicket struct {
+	SessionID  int
+	ProjectID  int
+	Priority   RunPriority
+	EnqueuedAt time.Time
+
+	seq       uint64
+	waited    bool
+	acquired  bool
+	granted   chan struct{}
+	cancelled chan struct{}
+}
+
+// SchedulerStatus is a snapshot of slot usage
+type SchedulerStatus struct {
+	MaxConcurrent           int         `json:"max_concurrent"`
+	MaxConcurrentPerProject int         `json:"max_concurrent_per_project"`
+	Running                 int         `json:"running"`
+	RunningByProject        map[int]int `json:"running_by_project"`
+	Waiting                 int         `json:"waiting"`
+}
+
+// AgentScheduler caps how many Claude runs execute at once, globally and per project.
+// Runs over the cap wait in priority order, then first come first served.
+type AgentScheduler struct {
+	maxConcurrent    int
+	maxPerProject    int
+	running          int
+	runningByProject map[int]int
+	waiting          []*SchedulerTicket
+	nextSeq          uint64
+	eventBroadcaster EventBroadcaster
+	mutex            sync.Mutex
+}
+
+// NewAgentScheduler creates a scheduler; a limit of 0 or less means unlimited
+func NewAgentScheduler(maxConcurrent, maxPerProject int) *AgentScheduler {
+	return &AgentScheduler{
+		maxConcurrent:    maxConcurrent,
+		maxPerProject:    maxPerProject,
+		runningByProject: make(map[int]int),
+		eventBroadcaster: &NoOpBroadcaster{},
+	}
+}
+
+// SetEventBroadcaster sets the event broadcaster used to report queue positions
+func (s *AgentScheduler) SetEventBroadcaster(broadcaster EventBroadcaster) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.eventBroadcaster = broadcaster
+}
+
+// NewTicket creates a ticket for a run that has not yet asked for a slot
+func (s *AgentScheduler) NewTicket(sessionID, projectID int, priority RunPriority) *SchedulerTicket {
+	return &SchedulerTicket{
+		SessionID: sessionID,
+		ProjectID: projectID,
+		Priority:  priority,
+		granted:   make(chan struct{}),
+		cancelled: make(chan struct{}),
+	}
+}
+
+// Acquire blocks until the ticket gets a slot or is cancelled
+func (s *AgentScheduler) Acquire(ticket *SchedulerTicket) error {
+	s.mutex.Lock()
+	s.nextSeq++
+	ticket.seq = s.nextSeq
+	ticket.EnqueuedAt = time.Now()
+	s.waiting = append(s.waiting, ticket)
+	sort.SliceStable(s.waiting, func(i, j int) bool {
+		if s.waiting[i].Priority != s.waiting[j].Priority {
+			return s.waiting[i].Priority < s.waiting[j].Priority
+		}
+		return s.waiting[i].seq < s.waiting[j].seq
+	})
+	events := s.dispatch()
+	s.mutex.Unlock()
+	s.broadcast(events)
+
+	select {
+	case <-ticket.granted:
+		return nil
+	case <-ticket.cancelled:
+		return fmt.Errorf("run for session %d was cancelled while waiting for a slot", ticket.SessionID)
+	}
+}
+
+// Release frees the ticket's slot so waiting runs can start
+func (s *AgentScheduler) Release(ticket *SchedulerTicket) {
+	s.mutex.Lock()
+	if !ticket.acquired {
+		s.mutex.Unlock()
+		return
+	}
+	ticket.acquired = false
+	s.running--
+	s.runningByProject[ticket.ProjectID]--
+	if s.runningByProject[ticket.ProjectID] <= 0 {
+		delete(s.runningByProject, ticket.ProjectID)
+	}
+	events := s.dispatch()
+	s.mutex.Unlock()
+	s.broadcast(events)
+}
+
+// Cancel withdraws a waiting ticket; it returns false if the ticket was not waiting
+func (s *AgentScheduler) Cancel(ticket *SchedulerTicket) bool {
+	s.mutex.Lock()
+	for i, waiting := range s.waiting {
+		if waiting == ticket {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			close(ticket.cancelled)
+			events := s.positionEvents()
+			s.mutex.Unlock()
+			s.broadcast(events)
+			return true
+		}
+	}
+	s.mutex.Unlock()
+	return false
+}
+
+// Status returns the current slot usage
+func (s *AgentScheduler) Status() SchedulerStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	byProject := make(map[int]int, len(s.runningByProject))
+	for projectID, count := range s.runningByProject {
+		byProject[projectID] = count
+	}
+
+	return SchedulerStatus{
+		MaxConcurrent:           s.maxConcurrent,
+		MaxConcurrentPerProject: s.maxPerProject,
+		Running:                 s.running,
+		RunningByProject:        byProject,
+		Waiting:                 len(s.waiting),
+	}
+}
+
+// dispatch grants slots to waiting tickets in order and returns the events to broadcast.
+// A ticket blocked only by its project's limit does not hold up other projects.
+// Callers must hold the mutex.
+func (s *AgentScheduler) dispatch() []map[string]interface{} {
+	var events []map[string]interface{}
+
+	remaining := s.waiting[:0]
+	for _, ticket := range s.waiting {
+		globalFull := s.maxConcurrent > 0 && s.running >= s.maxConcurrent
+		projectFull := s.maxPerProject > 0 && s.runningByProject[ticket.ProjectID] >= s.maxPerProject
+		if globalFull || projectFull {
+			ticket.waited = true
+			remaining = append(remaining, ticket)
+			continue
+		}
+
+		ticket.acquired = true
+		s.running++
+		s.runningByProject[ticket.ProjectID]++
+		close(ticket.granted)
+
+		// Only report a start for runs that were reported as waiting
+		if ticket.waited {
+			events = append(events, map[string]interface{}{
+				"session_id": ticket.SessionID,
+				"status":     "started",
+				"position":   0,
+				"priority":   ticket.Priority.String(),
+			})
+		}
+	}
+	s.waiting = remaining
+
+	return append(events, s.positionEvents()...)
+}
+
+// positionEvents reports each waiting ticket's place in line; callers must hold the mutex
+func (s *AgentScheduler) positionEvents() []map[string]interface{} {
+	events := make([]map[string]interface{}, 0, len(s.waiting))
+	for i, ticket := range s.waiting {
+		events = append(events, map[string]interface{}{
+			"session_id":   ticket.SessionID,
+			"status":       "waiting",
+			"position":     i + 1,
+			"queue_length": len(s.waiting),
+			"priority":     ticket.Priority.String(),
+		})
+	}
+	return events
+}
+
+func (s *AgentScheduler) broadcast(events []map[string]interface{}) {
+	s.mutex.Lock()
+	broadcaster := s.eventBroadcaster
+	s.mutex.Unlock()
+
+	for _, event := range events {
+		broadcaster.BroadcastEvent("agent_queue_position", 0, event)
+	}
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"habibi-go/internal/database/repositories"
+	"habibi-go/internal/models"
+)
+
+// AttemptService sends one prompt to several new sessions at once so their results
+// can be compared and the best one kept
+type AttemptService struct {
+	attemptRepo      *repositories.AttemptRepository
+	projectRepo      *repositories.ProjectRepository
+	sessionService   *SessionService
+	claudeService    *ClaudeSessionService
+	gitService       *GitService
+	sshService       *SSHService
+	eventBroadcaster EventBroadcaster
+}
+
+func NewAttemptService(
+	attemptRepo *repositories.AttemptRepository,
+	projectRepo *repositories.ProjectRepository,
+	sessionService *SessionService,
+	claudeService *ClaudeSessionService,
+	gitService *GitService,
+	sshService *SSHService,
+) *AttemptService {
+	return &AttemptService{
+		attemptRepo:      attemptRepo,
+		projectRepo:      projectRepo,
+		sessionService:   sessionService,
+		claudeService:    claudeService,
+		gitService:       gitService,
+		sshService:       sshService,
+		eventBroadcaster: &NoOpBroadcaster{},
+	}
+}
+
+// SetEventBroadcaster sets the event broadcaster
+func (s *AttemptService) SetEventBroadcaster(broadcaster EventBroadcaster) {
+	s.eventBroadcaster = broadcaster
+}
+
+// CreateAttemptGroup creates one session per attempt from the same base branch and
+// sends each the prompt. The runs go through the scheduler like any other.
+func (s *AttemptService) CreateAttemptGroup(req *models.CreateAttemptGroupRequest) (*models.AttemptGroup, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	project, err := s.projectRepo.GetByID(req.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+
+	// Diffs and checks are compared in local worktrees
+	if s.sshService != nil && s.sshService.IsSSHProject(project) {
+		return nil, fmt.Errorf("best-of-N runs are only supported for local projects")
+	}
+
+	baseBranch := req.BaseBranch
+	if baseBranch == "" {
+		baseBranch = project.DefaultBranch
+		if baseBranch == "" {
+			baseBranch = "main"
+		}
+	}
+
+	name := req.Name
+	if name == "" {
+		name = fmt.Sprintf("best-of-%d-%s", req.Count, time.Now().Format("20060102-150405"))
+	}
+
+	group := &models.AttemptGroup{
+		ProjectID:  project.ID,
+		Name:       name,
+		Prompt:     req.Prompt,
+		BaseBranch: baseBranch,
+	}
+	if err := s.attemptRepo.CreateGroup(group); err != nil {
+		return nil, err
+	}
+
+	// Worktrees are created one after another; git locks the repository while adding one
+	var sessions []*models.Session
+	for number := 1; number <= req.Count; number++ {
+		sessionName := models.AttemptName(name, number)
+		session, err := s.sessionService.CreateSession(&models.CreateSessionRequest{
+			ProjectID:  project.ID,
+			Name:       sessionName,
+			BranchName: sessionName,
+			BaseBranch: baseBranch,
+		})
+		if err != nil {
+			s.abandonGroup(group, sessions)
+			return nil, fmt.Errorf("failed to create attempt %d: %w", number, err)
+		}
+		sessions = append(sessions, session)
+
+		attempt := &models.Attempt{
+			GroupID:     group.ID,
+			Number:      number,
+			SessionID:   session.ID,
+			SessionName: session.Name,
+			BranchName:  session.BranchName,
+		}
+		if err := s.attemptRepo.CreateAttempt(attempt); err != nil {
+			s.abandonGroup(group, sessions)
+			return nil, err
+		}
+		group.Attempts = append(group.Attempts, attempt)
+	}
+
+	for _, session := range sessions {
+		if _, err := s.claudeService.SendScheduledMessage(session.ID, req.Prompt); err != nil {
+			fmt.Printf("Failed to start attempt session %d: %v\n", session.ID, err)
+		}
+	}
+
+	s.eventBroadcaster.BroadcastEvent("attempts_started", 0, map[string]interface{}{
+		"project_id": project.ID,
+		"group":      group,
+		"sessions":   sessions,
+	})
+
+	return group, nil
+}
+
+// abandonGroup closes the sessions of a group that could not be created in full
+func (s *AttemptService) abandonGroup(group *models.AttemptGroup, sessions []*models.Session) {
+	for _, session := range sessions {
+		if err := s.sessionService.CloseSession(session.ID); err != nil {
+			fmt.Printf("Failed to close attempt session %d: %v\n", session.ID, err)
+		}
+	}
+	if err := s.attemptRepo.DeleteGroup(group.ID); err != nil {
+		fmt.Printf("Failed to delete attempt group %d: %v\n", group.ID, err)
+	}
+}
+
+// GetAttemptGroup returns an attempt group with its attempts
+func (s *AttemptService) GetAttemptGroup(id int) (*models.AttemptGroup, error) {
+	return s.attemptRepo.GetGroup(id)
+}
+
+// GetProjectAttemptGroups returns a project's attempt groups, newest first
+func (s *AttemptService) GetProjectAttemptGroups(projectID int) ([]*models.AttemptGroup, error) {
+	if _, err := s.projectRepo.GetByID(projectID); err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	return s.attemptRepo.GetGroupsByProject(projectID)
+}
+
+// CompareAttempts gathers the diff stats, latest checks and cost of each attempt whose
+// session is still open
+func (s *AttemptService) CompareAttempts(id int) (*models.AttemptComparison, error) {
+	group, err := s.attemptRepo.GetGroup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &models.AttemptComparison{Group: group}
+	for _, attempt := range group.Attempts {
+		result := &models.AttemptResult{Attempt: attempt}
+		comparison.Attempts = append(comparison.Attempts, result)
+		if attempt.Status == string(models.AttemptStatusClosed) {
+			continue
+		}
+
+		session, err := s.sessionService.GetSession(attempt.SessionID)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+
+		result.Running = s.claudeService.IsRunning(session.ID)
+		result.Queued = len(s.claudeService.GetQueue(session.ID))
+
+		if turns, err := s.claudeService.GetTurns(session.ID, 1); err == nil && len(turns) > 0 {
+			result.TurnStatus = turns[0].Status
+		}
+
+		if diffs, err := s.gitService.GetWorkingTreeDiff(session.WorktreePath, group.BaseBranch); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.FilesChanged = len(diffs)
+			for _, diff := range diffs {
+				result.Additions += diff.Additions
+				result.Deletions += diff.Deletions
+			}
+		}
+
+		if runs, err := s.claudeService.GetSessionValidation(session.ID, 1); err == nil && len(runs) > 0 {
+			result.Validation = runs[0]
+		}
+
+		if usage, err := s.claudeService.GetSessionUsage(session.ID); err == nil {
+			result.Usage = usage
+		}
+	}
+
+	return comparison, nil
+}
+
+// KeepAttempt keeps one attempt's session and closes the others, stopping their runs
+// and removing their worktrees
+func (s *AttemptService) KeepAttempt(id int, sessionID int) (*models.AttemptGroup, error) {
+	group, err := s.attemptRepo.GetGroup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if group.Status == string(models.AttemptGroupStatusDecided) {
+		return nil, fmt.Errorf("attempt group %d is already decided", id)
+	}
+
+	var kept *models.Attempt
+	for _, attempt := range group.Attempts {
+		if attempt.SessionID == sessionID {
+			kept = attempt
+		}
+	}
+	if kept == nil {
+		return nil, fmt.Errorf("session %d is not an attempt of group %d", sessionID, id)
+	}
+	if kept.Status == string(models.AttemptStatusClosed) {
+		return nil, fmt.Errorf("attempt %d was already closed", kept.Number)
+	}
+
+	var closeErrors []error
+	for _, attempt := range group.Attempts {
+		if attempt == kept || attempt.Status == string(models.AttemptStatusClosed) {
+			continue
+		}
+
+		s.claudeService.ReleaseSession(attempt.SessionID)
+		if err := s.sessionService.CloseSession(attempt.SessionID); err != nil {
+			closeErrors = append(closeErrors, fmt.Errorf("attempt %d: %w", attempt.Number, err))
+			continue
+		}
+		if err := s.attemptRepo.UpdateAttemptStatus(attempt.ID, models.AttemptStatusClosed); err != nil {
+			closeErrors = append(closeErrors, err)
+		}
+	}
+
+	// The group stays open so keeping again retries the attempts left open
+	if len(closeErrors) > 0 {
+		return nil, fmt.Errorf("failed to close some attempts: %v", closeErrors)
+	}
+
+	if err := s.attemptRepo.UpdateAttemptStatus(kept.ID, models.AttemptStatusKept); err != nil {
+		return nil, err
+	}
+	if err := s.attemptRepo.Decide(id, sessionID); err != nil {
+		return nil, err
+	}
+
+	group, err = s.attemptRepo.GetGroup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.eventBroadcaster.BroadcastEvent("attempts_decided", 0, map[string]interface{}{
+		"project_id":      group.ProjectID,
+		"group":           group,
+		"kept_session_id": sessionID,
+	})
+
+	return group, nil
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"habibi-go/internal/database/repositories"
+	"habibi-go/internal/models"
+)
+
+// BudgetService tracks what projects and sessions spend against their budgets, using
+// the cost and token usage recorded for each turn
+type BudgetService struct {
+	budgetRepo       *repositories.BudgetRepository
+	turnRepo         *repositories.TurnRepository
+	projectRepo      *repositories.ProjectRepository
+	sessionRepo      *repositories.SessionRepository
+	eventBroadcaster EventBroadcaster
+
+	mutex     sync.Mutex
+	onRelease []func()
+}
+
+func NewBudgetService(
+	budgetRepo *repositories.BudgetRepository,
+	turnRepo *repositories.TurnRepository,
+	projectRepo *repositories.ProjectRepository,
+	sessionRepo *repositories.SessionRepository,
+) *BudgetService {
+	return &BudgetService{
+		budgetRepo:       budgetRepo,
+		turnRepo:         turnRepo,
+		projectRepo:      projectRepo,
+		sessionRepo:      sessionRepo,
+		eventBroadcaster: &NoOpBroadcaster{},
+	}
+}
+
+// SetEventBroadcaster sets the event broadcaster
+func (s *BudgetService) SetEventBroadcaster(broadcaster EventBroadcaster) {
+	s.eventBroadcaster = broadcaster
+}
+
+// OnRelease registers a function called when an override may let held prompts run
+func (s *BudgetService) OnRelease(fn func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onRelease = append(s.onRelease, fn)
+}
+
+// GetProjectStatus reports a project's daily and monthly budgets
+func (s *BudgetService) GetProjectStatus(projectID int) (*models.BudgetStatus, error) {
+	project, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	return s.status(project, nil)
+}
+
+// GetSessionStatus reports the budgets that apply to a session: its project's and its own cap
+func (s *BudgetService) GetSessionStatus(sessionID int) (*models.BudgetStatus, error) {
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return s.SessionStatus(session)
+}
+
+// SessionStatus reports the budgets that apply to a session
+func (s *BudgetService) SessionStatus(session *models.Session) (*models.BudgetStatus, error) {
+	project, err := s.projectRepo.GetByID(session.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	return s.status(project, session)
+}
+
+func (s *BudgetService) status(project *models.Project, session *models.Session) (*models.BudgetStatus, error) {
+	settings, err := models.ResolveBudgetSettings(project, session)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &models.BudgetStatus{
+		ProjectID:  project.ID,
+		OnExceeded: settings.OnExceeded,
+		Limits:     []*models.BudgetLimit{},
+	}
+
+	now := time.Now()
+	if settings.DailyUSD != nil || settings.DailyTokens != nil {
+		start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		resetsAt := start.AddDate(0, 0, 1)
+		usage, err := s.turnRepo.GetProjectUsageSince(project.ID, start)
+		if err != nil {
+			return nil, err
+		}
+		status.Limits = append(status.Limits, budgetLimits("daily", settings.DailyUSD, settings.DailyTokens, usage, &resetsAt)...)
+	}
+
+	if settings.MonthlyUSD != nil || settings.MonthlyTokens != nil {
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		resetsAt := start.AddDate(0, 1, 0)
+		usage, err := s.turnRepo.GetProjectUsageSince(project.ID, start)
+		if err != nil {
+			return nil, err
+		}
+		status.Limits = append(status.Limits, budgetLimits("monthly", settings.MonthlyUSD, settings.MonthlyTokens, usage, &resetsAt)...)
+	}
+
+	sessionID := 0
+	if session != nil {
+		sessionID = session.ID
+		status.SessionID = session.ID
+		if settings.SessionUSD != nil || settings.SessionTokens != nil {
+			usage, err := s.turnRepo.GetUsageSummary(session.ID)
+			if err != nil {
+				return nil, err
+			}
+			status.Limits = append(status.Limits, budgetLimits("session", settings.SessionUSD, settings.SessionTokens, usage, nil)...)
+		}
+	}
+
+	for _, limit := range status.Limits {
+		if limit.Exceeded {
+			status.Exceeded = true
+		}
+	}
+
+	if status.Overrides, err = s.budgetRepo.GetActiveOverrides(project.ID, sessionID, now); err != nil {
+		return nil, err
+	}
+	status.Blocked = status.Exceeded && len(status.Overrides) == 0
+
+	return status, nil
+}
+
+// budgetLimits reports the USD and token budgets of one period that are set
+func budgetLimits(period string, usd *float64, tokens *int, usage *models.UsageSummary, resetsAt *time.Time) []*models.BudgetLimit {
+	var limits []*models.BudgetLimit
+	if usd != nil {
+		limits = append(limits, models.NewBudgetLimit(period, "usd", *usd, usage.TotalCostUSD, resetsAt))
+	}
+	if tokens != nil {
+		used := float64(usage.InputTokens + usage.OutputTokens)
+		limits = append(limits, models.NewBudgetLimit(period, "tokens", float64(*tokens), used, resetsAt))
+	}
+	return limits
+}
+
+// RecordTurn warns the session's viewers when the usage a turn just added takes a budget
+// past BudgetWarningRatio of its limit or uses it up
+func (s *BudgetService) RecordTurn(turn *models.Turn, usage *models.TurnUsage) {
+	session, err := s.sessionRepo.GetByID(turn.SessionID)
+	if err != nil {
+		fmt.Printf("Failed to check budgets of session %d: %v\n", turn.SessionID, err)
+		return
+	}
+
+	status, err := s.SessionStatus(session)
+	if err != nil {
+		fmt.Printf("Failed to check budgets of session %d: %v\n", turn.SessionID, err)
+		return
+	}
+
+	for _, limit := range status.Limits {
+		spent := usage.TotalCostUSD
+		if limit.Unit == "tokens" {
+			spent = float64(usage.InputTokens + usage.OutputTokens)
+		}
+		before := limit.Used - spent
+
+		event := ""
+		switch {
+		case limit.Used >= limit.Limit && before < limit.Limit:
+			event = "budget_exceeded"
+		case limit.Used >= limit.Limit*models.BudgetWarningRatio && before < limit.Limit*models.BudgetWarningRatio:
+			event = "budget_warning"
+		default:
+			continue
+		}
+
+		fmt.Printf("Session %d is at %.0f%% of its %s %s budget\n", session.ID, limit.Percent, limit.Period, limit.Unit)
+		s.eventBroadcaster.BroadcastEvent(event, 0, map[string]interface{}{
+			"session_id": session.ID,
+			"project_id": session.ProjectID,
+			"limit":      limit,
+			"status":     status,
+		})
+	}
+}
+
+// GrantProjectOverride lets all of a project's sessions run past their budgets for a while
+func (s *BudgetService) GrantProjectOverride(projectID int, req *models.BudgetOverrideRequest) (*models.BudgetOverride, error) {
+	duration, err := req.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	project, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+
+	override := &models.BudgetOverride{
+		ProjectID: project.ID,
+		Reason:    req.Reason,
+		ExpiresAt: time.Now().Add(duration),
+	}
+	return override, s.grant(override)
+}
+
+// GrantSessionOverride lets one session run past its budgets for a while
+func (s *BudgetService) GrantSessionOverride(sessionID int, req *models.BudgetOverrideRequest) (*models.BudgetOverride, error) {
+	duration, err := req.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	override := &models.BudgetOverride{
+		ProjectID: session.ProjectID,
+		SessionID: &session.ID,
+		Reason:    req.Reason,
+		ExpiresAt: time.Now().Add(duration),
+	}
+	return override, s.grant(override)
+}
+
+func (s *BudgetService) grant(override *models.BudgetOverride) error {
+	if err := s.budgetRepo.CreateOverride(override); err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		"project_id": override.ProjectID,
+		"override":   override,
+	}
+	if override.SessionID != nil {
+		data["session_id"] = *override.SessionID
+	}
+	s.eventBroadcaster.BroadcastEvent("budget_override", 0, data)
+
+	s.mutex.Lock()
+	release := append([]func(){}, s.onRelease...)
+	s.mutex.Unlock()
+	for _, fn := range release {
+		fn()
+	}
+	return nil
+}
+
+// RevokeProjectOverrides ends the overrides granted to a project as a whole
+func (s *BudgetService) RevokeProjectOverrides(projectID int) error {
+	return s.budgetRepo.DeleteProjectOverrides(projectID)
+}
+
+// RevokeSessionOverrides ends the overrides granted to one session
+func (s *BudgetService) RevokeSessionOverrides(sessionID int) error {
+	return s.budgetRepo.DeleteSessionOverrides(sessionID)
+}
+
+// BudgetExceededError describes the budgets that stop a session from starting a turn
+func BudgetExceededError(status *models.BudgetStatus) error {
+	var exceeded []string
+	for _, limit := range status.Limits {
+		if !limit.Exceeded {
+			continue
+		}
+		if limit.Unit == "usd" {
+			exceeded = append(exceeded, fmt.Sprintf("%s $%.2f of $%.2f", limit.Period, limit.Used, limit.Limit))
+		} else {
+			exceeded = append(exceeded, fmt.Sprintf("%s %.0f of %.0f tokens", limit.Period, limit.Used, limit.Limit))
+		}
+	}
+	return fmt.Errorf("budget exceeded: %s", strings.Join(exceeded, ", "))
+}
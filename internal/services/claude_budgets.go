@@ -0,0 +1,104 @@
+package services
+
+import (
+	"fmt"
+
+	"habibi-go/internal/models"
+)
+
+// SetBudgetService enforces project and session spend budgets on new turns
+func (s *ClaudeSessionService) SetBudgetService(budgets *BudgetService) {
+	s.budgets = budgets
+	budgets.OnRelease(s.ResumeHeldQueues)
+}
+
+// budgetBlock returns the session's budget status if a used-up budget keeps it from
+// starting a turn, and nil otherwise
+func (s *ClaudeSessionService) budgetBlock(session *models.Session) (*models.BudgetStatus, error) {
+	if s.budgets == nil {
+		return nil, nil
+	}
+
+	status, err := s.budgets.SessionStatus(session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check budgets: %w", err)
+	}
+	if !status.Blocked {
+		return nil, nil
+	}
+	return status, nil
+}
+
+// queueHeld reports whether a session's queued prompts must wait for its budget, or for
+// a usage limit to reset
+func (s *ClaudeSessionService) queueHeld(sessionID int) bool {
+	if s.activeUsageLimit(sessionID) != nil {
+		return true
+	}
+
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil {
+		fmt.Printf("Failed to get session %d: %v\n", sessionID, err)
+		return false
+	}
+
+	status, err := s.budgetBlock(session)
+	if err != nil {
+		// A broken budget config holds the queue rather than spending without limits
+		fmt.Printf("Holding queue of session %d: %v\n", sessionID, err)
+		return true
+	}
+	if status != nil {
+		s.holdQueue(sessionID, status)
+		return true
+	}
+
+	s.processMutex.Lock()
+	delete(s.heldQueues, sessionID)
+	s.processMutex.Unlock()
+	return false
+}
+
+// holdQueue tells the session's viewers once that its queued prompts wait for its budget
+func (s *ClaudeSessionService) holdQueue(sessionID int, status *models.BudgetStatus) {
+	s.processMutex.Lock()
+	alreadyHeld := s.heldQueues[sessionID]
+	s.heldQueues[sessionID] = true
+	s.processMutex.Unlock()
+	if alreadyHeld {
+		return
+	}
+
+	fmt.Printf("Holding queued prompts of session %d: %v\n", sessionID, BudgetExceededError(status))
+	s.eventBroadcaster.BroadcastEvent("prompt_queue_held", 0, map[string]interface{}{
+		"session_id": sessionID,
+		"reason":     BudgetExceededError(status).Error(),
+		"budget":     status,
+		"queue":      s.promptQueue.List(sessionID),
+	})
+}
+
+// ResumeHeldQueues starts the queued prompts of idle sessions whose budgets allow it
+// again, after an override, when a daily or monthly budget resets or when a usage limit
+// the session waited out resets
+func (s *ClaudeSessionService) ResumeHeldQueues() {
+	s.releaseUsageLimits()
+
+	// Queues emptied by hand are no longer held
+	s.processMutex.Lock()
+	for sessionID := range s.heldQueues {
+		if s.promptQueue.Len(sessionID) == 0 {
+			delete(s.heldQueues, sessionID)
+		}
+	}
+	s.processMutex.Unlock()
+
+	for _, sessionID := range s.promptQueue.Sessions() {
+		s.processMutex.Lock()
+		_, busy := s.runningProcesses[sessionID]
+		s.processMutex.Unlock()
+		if !busy {
+			go s.finishRun(sessionID)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"habibi-go/internal/models"
+	"habibi-go/internal/streamjson"
+)
+
+// persistentAgent is a long-lived agent process that serves every turn of a session,
+// reading prompts from stdin. A process that dies is replaced on the session's next
+// turn, resuming its conversation; one left idle too long is closed.
+type persistentAgent struct {
+	sessionID int
+	proc      agentProcess
+	runner    StreamingAgentRunner
+	// Backend and settings the process was started with; a change restarts it
+	key             string
+	permissionToken string
+	exited          chan struct{}
+	inputMutex      sync.Mutex
+
+	// Guarded by ClaudeSessionService.processMutex
+	current        *runningTurn
+	turnDone       chan error
+	pendingResults int
+	idleTimer      *time.Timer
+
+	// Cost the process reported last; it reports a running total for its whole life.
+	// Only readPersistentAgent uses it.
+	reportedCostUSD float64
+}
+
+// resultCost turns the running total cost of a result into the cost of that result alone
+func (a *persistentAgent) resultCost(usage *models.TurnUsage) {
+	total := usage.TotalCostUSD
+	if total >= a.reportedCostUSD {
+		usage.TotalCostUSD = total - a.reportedCostUSD
+	}
+	a.reportedCostUSD = total
+}
+
+// writeInput sends one encoded prompt to the process
+func (a *persistentAgent) writeInput(input []byte) error {
+	a.inputMutex.Lock()
+	defer a.inputMutex.Unlock()
+
+	if _, err := a.proc.Stdin().Write(input); err != nil {
+		return fmt.Errorf("failed to write prompt to %s: %w", a.runner.Name(), err)
+	}
+	return nil
+}
+
+// SetPersistentProcesses makes sessions keep one agent process across turns unless their
+// project or session config says otherwise. Idle processes are closed after idleTimeout.
+func (s *ClaudeSessionService) SetPersistentProcesses(enabled bool, idleTimeout time.Duration) {
+	s.processMutex.Lock()
+	defer s.processMutex.Unlock()
+
+	s.persistentByDefault = enabled
+	if idleTimeout > 0 {
+		s.persistentIdleTimeout = idleTimeout
+	}
+}
+
+// persistentRunner returns the session's backend if its turns should share a long-lived
+// process: the session's "persistent_process" setting, then its project's, then the default
+func (s *ClaudeSessionService) persistentRunner(session *models.Session, runner AgentRunner) StreamingAgentRunner {
+	streaming, ok := runner.(StreamingAgentRunner)
+	if !ok {
+		return nil
+	}
+
+	s.processMutex.Lock()
+	enabled := s.persistentByDefault
+	s.processMutex.Unlock()
+	if project, err := s.projectRepo.GetByID(session.ProjectID); err == nil {
+		if value, ok := project.Config["persistent_process"].(bool); ok {
+			enabled = value
+		}
+	}
+	if value, ok := session.Config["persistent_process"].(bool); ok {
+		enabled = value
+	}
+
+	if !enabled {
+		return nil
+	}
+	return streaming
+}
+
+// runPersistentTurn sends a turn's prompt to the session's long-lived process and waits for its result
+func (s *ClaudeSessionService) runPersistentTurn(session *models.Session, running *runningTurn, runner StreamingAgentRunner) {
+	turn := running.turn
+
+	input, err := runner.EncodeInput(turn.Prompt)
+	if err != nil {
+		s.failTurn(turn, err)
+		return
+	}
+
+	// Attach the turn to a live process; one that exits or idles out in between is replaced
+	done := make(chan error, 1)
+	var agent *persistentAgent
+	for attempt := 0; agent == nil; attempt++ {
+		if attempt == 2 {
+			s.failTurn(turn, fmt.Errorf("%s process exited before the turn started", runner.Name()))
+			return
+		}
+
+		candidate, err := s.persistentAgentFor(session, running, runner)
+		if err != nil {
+			s.failTurn(turn, err)
+			return
+		}
+
+		s.processMutex.Lock()
+		if running.stopped {
+			s.processMutex.Unlock()
+			s.completeStoppedTurn(turn)
+			return
+		}
+		if s.persistentAgents[session.ID] == candidate {
+			agent = candidate
+			if agent.idleTimer != nil {
+				agent.idleTimer.Stop()
+			}
+			agent.current = running
+			agent.turnDone = done
+			agent.pendingResults = 1
+			running.agent = agent
+			running.proc = agent.proc
+			running.exited = agent.exited
+			running.startedAt = time.Now()
+			running.lastOutputAt.Store(running.startedAt.UnixNano())
+		}
+		s.processMutex.Unlock()
+	}
+
+	if agent.permissionToken != "" {
+		s.permissions.SetRunTurn(agent.permissionToken, turn.ID)
+	}
+
+	fmt.Printf("Sending turn %d to the running %s process of session %d\n", turn.ID, runner.Name(), session.ID)
+	if err := agent.writeInput(input); err != nil {
+		// The reader reports the failure once the process is gone
+		fmt.Printf("%v\n", err)
+		agent.proc.Kill()
+	}
+
+	err = <-done
+	s.processMutex.Lock()
+	stopped := running.stopped || running.failReason != ""
+	s.processMutex.Unlock()
+	if stopped {
+		// StopGeneration or the watchdog already reported the outcome
+		return
+	}
+	if limit := s.turnUsageLimit(running, err != nil); limit != nil {
+		s.waitForUsageLimit(running, limit)
+		return
+	}
+	if err != nil {
+		s.failTurn(turn, err)
+		return
+	}
+
+	s.completeTurn(turn, runner)
+}
+
+// persistentAgentFor returns the session's long-lived process, starting one if there is
+// none or the one running was started with other settings
+func (s *ClaudeSessionService) persistentAgentFor(session *models.Session, running *runningTurn, runner StreamingAgentRunner) (*persistentAgent, error) {
+	key, err := persistentKey(session, running.settings, running.mcpConfig, runner)
+	if err != nil {
+		return nil, err
+	}
+
+	s.processMutex.Lock()
+	agent := s.persistentAgents[session.ID]
+	s.processMutex.Unlock()
+	if agent != nil {
+		if agent.key == key {
+			return agent, nil
+		}
+		fmt.Printf("Agent settings of session %d changed; restarting its %s process\n", session.ID, agent.runner.Name())
+		s.closeSessionAgent(session.ID)
+	}
+
+	proc, err := s.startAgentProcess(session, running, true)
+	if err != nil {
+		if running.permissionToken != "" {
+			s.permissions.UnregisterRun(running.permissionToken)
+			running.permissionToken = ""
+		}
+		return nil, err
+	}
+
+	// The permission token belongs to the process now, not to this turn
+	agent = &persistentAgent{
+		sessionID:       session.ID,
+		proc:            proc,
+		runner:          runner,
+		key:             key,
+		permissionToken: running.permissionToken,
+		exited:          make(chan struct{}),
+	}
+	running.permissionToken = ""
+
+	s.processMutex.Lock()
+	s.persistentAgents[session.ID] = agent
+	s.processMutex.Unlock()
+	fmt.Printf("%s process started for session %d\n", runner.Name(), session.ID)
+
+	go s.readPersistentStderr(agent)
+	go s.readPersistentAgent(agent)
+
+	return agent, nil
+}
+
+// persistentKey identifies the backend, settings and MCP servers a session's process runs with
+func persistentKey(session *models.Session, settings *models.AgentSettings, mcpConfig []byte, runner AgentRunner) (string, error) {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode agent settings: %w", err)
+	}
+
+	return fmt.Sprintf("%s %s %s %s", runner.Name(), session.WorktreePath, data, mcpConfig), nil
+}
+
+// readPersistentAgent hands a long-lived process's output to whichever turn it is serving
+func (s *ClaudeSessionService) readPersistentAgent(agent *persistentAgent) {
+	name := agent.runner.Name()
+	scanner := streamjson.NewLineScanner(agent.proc.Stdout())
+	parser := agent.runner.NewParser()
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		s.processMutex.Lock()
+		running := agent.current
+		s.processMutex.Unlock()
+		if running == nil {
+			fmt.Printf("%s stdout line outside a turn for session %d: %s\n", name, agent.sessionID, line)
+			continue
+		}
+
+		running.lastOutputAt.Store(time.Now().UnixNano())
+		fmt.Printf("%s stdout line: %s\n", name, line)
+		running.transcript.Add(line)
+
+		for _, event := range parser.ParseLine(line) {
+			if event.Type == AgentEventResult && event.Usage != nil {
+				agent.resultCost(event.Usage)
+			}
+			s.handleAgentEvent(running.turn, event)
+			if event.Type == AgentEventResult {
+				s.finishPersistentResult(agent, running, parser)
+			}
+		}
+	}
+
+	readErr := scanner.Err()
+	if readErr != nil {
+		// The rest of the output is lost, so the process cannot serve turns any more
+		fmt.Printf("Failed to read %s output for session %d: %v\n", name, agent.sessionID, readErr)
+		agent.proc.Kill()
+	}
+
+	s.processMutex.Lock()
+	running := agent.current
+	s.processMutex.Unlock()
+	if running != nil {
+		for _, event := range parser.Flush() {
+			s.handleAgentEvent(running.turn, event)
+		}
+	}
+
+	waitErr := agent.proc.Wait()
+
+	s.processMutex.Lock()
+	if s.persistentAgents[agent.sessionID] == agent {
+		delete(s.persistentAgents, agent.sessionID)
+	}
+	if agent.idleTimer != nil {
+		agent.idleTimer.Stop()
+	}
+	done := agent.turnDone
+	agent.current, agent.turnDone = nil, nil
+	s.processMutex.Unlock()
+
+	close(agent.exited)
+	if agent.permissionToken != "" {
+		s.permissions.UnregisterRun(agent.permissionToken)
+	}
+
+	if done == nil {
+		fmt.Printf("%s process for session %d exited: %v\n", name, agent.sessionID, waitErr)
+		return
+	}
+	if readErr != nil {
+		done <- fmt.Errorf("failed to read %s output: %w", name, readErr)
+		return
+	}
+	if waitErr == nil {
+		done <- fmt.Errorf("%s process exited before finishing the turn", name)
+		return
+	}
+	done <- fmt.Errorf("%s command failed: %w", name, waitErr)
+}
+
+// finishPersistentResult ends the current turn once every prompt sent during it has a result
+func (s *ClaudeSessionService) finishPersistentResult(agent *persistentAgent, running *runningTurn, parser AgentOutputParser) {
+	s.processMutex.Lock()
+	agent.pendingResults--
+	if agent.pendingResults > 0 || agent.current != running {
+		s.processMutex.Unlock()
+		return
+	}
+	done := agent.turnDone
+	agent.current, agent.turnDone = nil, nil
+	agent.idleTimer = time.AfterFunc(s.persistentIdleTimeout, func() {
+		s.closeIdleAgent(agent)
+	})
+	s.processMutex.Unlock()
+
+	// Text still streaming belongs to the turn that just ended
+	for _, event := range parser.Flush() {
+		s.handleAgentEvent(running.turn, event)
+	}
+	done <- nil
+}
+
+// readPersistentStderr logs a long-lived process's stderr and notes usage limits it reports
+func (s *ClaudeSessionService) readPersistentStderr(agent *persistentAgent) {
+	scanner := streamjson.NewLineScanner(agent.proc.Stderr())
+	for scanner.Scan() {
+		line := scanner.Text()
+		s.processMutex.Lock()
+		running := agent.current
+		s.processMutex.Unlock()
+		if running != nil {
+			running.lastOutputAt.Store(time.Now().UnixNano())
+			s.noteUsageLimit(running, line)
+		}
+		fmt.Printf("%s stderr: %s\n", agent.runner.Name(), line)
+	}
+	if err := scanner.Err(); err != nil {
+		// Keep draining so the process does not block on a full pipe
+		fmt.Printf("Failed to read %s stderr for session %d: %v\n", agent.runner.Name(), agent.sessionID, err)
+		io.Copy(io.Discard, agent.proc.Stderr())
+	}
+}
+
+// acceptFollowUp reports whether a message can go straight to the process serving a
+// running turn, and encodes it if so. The caller holds processMutex.
+func (s *ClaudeSessionService) acceptFollowUp(running *runningTurn, message string) ([]byte, bool) {
+	agent := running.agent
+	if agent == nil || agent.current != running || running.stopped || running.failReason != "" {
+		return nil, false
+	}
+
+	input, err := agent.runner.EncodeInput(message)
+	if err != nil {
+		fmt.Printf("Failed to encode follow-up for session %d: %v\n", agent.sessionID, err)
+		return nil, false
+	}
+
+	// The turn now ends at the result for this message
+	agent.pendingResults++
+	return input, true
+}
+
+// sendFollowUp saves a message sent during a running turn and writes it to the agent
+func (s *ClaudeSessionService) sendFollowUp(running *runningTurn, message string, input []byte) error {
+	turn := running.turn
+
+	userMsg := &models.ChatMessage{
+		SessionID: turn.SessionID,
+		TurnID:    turn.ID,
+		Role:      "user",
+		Content:   message,
+	}
+	if err := s.chatRepo.Create(userMsg); err != nil {
+		fmt.Printf("Failed to save follow-up message: %v\n", err)
+	}
+
+	s.eventBroadcaster.BroadcastEvent("new_chat_message", 0, map[string]interface{}{
+		"session_id": turn.SessionID,
+		"message":    userMsg,
+	})
+
+	fmt.Printf("Sending follow-up to turn %d of session %d\n", turn.ID, turn.SessionID)
+	if err := running.agent.writeInput(input); err != nil {
+		// The reader fails the turn once the process is gone
+		running.agent.proc.Kill()
+		return err
+	}
+	return nil
+}
+
+// closeIdleAgent closes a process that has had no turn for the idle timeout
+func (s *ClaudeSessionService) closeIdleAgent(agent *persistentAgent) {
+	s.processMutex.Lock()
+	if agent.current != nil || s.persistentAgents[agent.sessionID] != agent {
+		s.processMutex.Unlock()
+		return
+	}
+	delete(s.persistentAgents, agent.sessionID)
+	s.processMutex.Unlock()
+
+	fmt.Printf("Closing idle %s process of session %d\n", agent.runner.Name(), agent.sessionID)
+	s.closePersistentAgent(agent)
+}
+
+// closeSessionAgent closes a session's long-lived process, if it has one
+func (s *ClaudeSessionService) closeSessionAgent(sessionID int) {
+	s.processMutex.Lock()
+	agent := s.persistentAgents[sessionID]
+	delete(s.persistentAgents, sessionID)
+	s.processMutex.Unlock()
+
+	if agent != nil {
+		s.closePersistentAgent(agent)
+	}
+}
+
+// ClosePersistentAgents closes every long-lived agent process, e.g. at shutdown
+func (s *ClaudeSessionService) ClosePersistentAgents() {
+	s.processMutex.Lock()
+	agents := make([]*persistentAgent, 0, len(s.persistentAgents))
+	for sessionID, agent := range s.persistentAgents {
+		agents = append(agents, agent)
+		delete(s.persistentAgents, sessionID)
+	}
+	s.processMutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, agent := range agents {
+		wg.Add(1)
+		go func(agent *persistentAgent) {
+			defer wg.Done()
+			s.closePersistentAgent(agent)
+		}(agent)
+	}
+	wg.Wait()
+}
+
+// closePersistentAgent ends a process's input so it exits on its own, killing it after the grace period
+func (s *ClaudeSessionService) closePersistentAgent(agent *persistentAgent) {
+	agent.inputMutex.Lock()
+	if err := agent.proc.Stdin().Close(); err != nil {
+		fmt.Printf("Failed to close %s input for session %d: %v\n", agent.runner.Name(), agent.sessionID, err)
+	}
+	agent.inputMutex.Unlock()
+
+	select {
+	case <-agent.exited:
+	case <-time.After(s.stopGracePeriod):
+		if err := agent.proc.Kill(); err != nil {
+			fmt.Printf("Failed to kill %s process of session %d: %v\n", agent.runner.Name(), agent.sessionID, err)
+		}
+		<-agent.exited
+	}
+}
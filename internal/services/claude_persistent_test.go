@@ -0,0 +1,107 @@
+package services
+
+import (
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"habibi-go/internal/database"
+	"habibi-go/internal/database/repositories"
+	"habibi-go/internal/models"
+)
+
+// fakeAgentProcess replays fixed output and exits once it is read
+type fakeAgentProcess struct {
+	stdout io.Reader
+}
+
+func (p *fakeAgentProcess) Stdin() io.WriteCloser { return nil }
+func (p *fakeAgentProcess) Stdout() io.Reader     { return p.stdout }
+func (p *fakeAgentProcess) Stderr() io.Reader     { return strings.NewReader("") }
+func (p *fakeAgentProcess) Wait() error           { return nil }
+func (p *fakeAgentProcess) Kill() error           { return nil }
+func (p *fakeAgentProcess) Interrupt(exited <-chan struct{}, grace time.Duration) error {
+	return nil
+}
+
+func TestPersistentAgentCountsEachResultOnce(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "habibi.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err := db.RunMigrations(); err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
+	}
+
+	projectRepo := repositories.NewProjectRepository(db.DB)
+	sessionRepo := repositories.NewSessionRepository(db.DB)
+	turnRepo := repositories.NewTurnRepository(db.DB)
+	s := NewClaudeSessionService(
+		sessionRepo,
+		projectRepo,
+		repositories.NewChatMessageV2Repository(db.DB),
+		repositories.NewEventRepository(db.DB),
+		turnRepo,
+		repositories.NewTodoRepository(db.DB),
+		repositories.NewValidationRepository(db.DB),
+		repositories.NewUsageLimitRepository(db.DB),
+		"",
+	)
+	s.SetEventBroadcaster(&NoOpBroadcaster{})
+
+	project := &models.Project{Name: "p", Path: t.TempDir(), DefaultBranch: "main"}
+	if err := projectRepo.Create(project); err != nil {
+		t.Fatalf("failed to create project: %v", err)
+	}
+	session := &models.Session{ProjectID: project.ID, Name: "s", BranchName: "s", WorktreePath: t.TempDir()}
+	if err := sessionRepo.Create(session); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	turn := &models.Turn{SessionID: session.ID, Prompt: "first", Backend: "claude", Status: string(models.TurnStatusRunning)}
+	if err := turnRepo.Create(turn); err != nil {
+		t.Fatalf("failed to create turn: %v", err)
+	}
+
+	// An earlier turn of the process already cost 0.50; the turn's prompt and its
+	// follow-up then cost 0.25 and 0.10, reported as running totals
+	output := strings.Join([]string{
+		`{"type":"result","subtype":"success","is_error":false,"result":"one","session_id":"abc","total_cost_usd":0.75,"num_turns":1,"usage":{"input_tokens":10,"output_tokens":5}}`,
+		`{"type":"result","subtype":"success","is_error":false,"result":"two","session_id":"abc","total_cost_usd":0.85,"num_turns":2,"usage":{"input_tokens":20,"output_tokens":7}}`,
+	}, "\n") + "\n"
+
+	runner := newClaudeRunner("")
+	running := &runningTurn{runner: runner, turn: turn, transcript: newTurnTranscript()}
+	done := make(chan error, 1)
+	agent := &persistentAgent{
+		sessionID:       session.ID,
+		proc:            &fakeAgentProcess{stdout: strings.NewReader(output)},
+		runner:          runner,
+		exited:          make(chan struct{}),
+		current:         running,
+		turnDone:        done,
+		pendingResults:  2,
+		reportedCostUSD: 0.50,
+	}
+	running.agent = agent
+
+	s.readPersistentAgent(agent)
+	if err := <-done; err != nil {
+		t.Fatalf("turn failed: %v", err)
+	}
+
+	stored, err := turnRepo.GetByID(turn.ID)
+	if err != nil {
+		t.Fatalf("failed to get turn: %v", err)
+	}
+	if math.Abs(stored.TotalCostUSD-0.35) > 1e-9 {
+		t.Errorf("cost = %v, want 0.35", stored.TotalCostUSD)
+	}
+	if stored.InputTokens != 30 || stored.OutputTokens != 12 || stored.NumTurns != 3 {
+		t.Errorf("tokens = %d in, %d out over %d turns; want 30 in, 12 out over 3 turns",
+			stored.InputTokens, stored.OutputTokens, stored.NumTurns)
+	}
+}
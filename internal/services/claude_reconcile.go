@@ -0,0 +1,156 @@
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"habibi-go/internal/models"
+)
+
+// interruptedReason explains turns that were running when the server stopped
+const interruptedReason = "the server stopped before the agent finished"
+
+// ReconcileInterruptedSessions cleans up after a server that died mid-turn. Turns still
+// marked running are interrupted and streaming sessions with no live run go back to idle.
+// Prompts that waited for a usage limit are queued again until the limit resets.
+// With killOrphans set, leftover agent processes running in session worktrees are killed.
+// Call it at startup, before any turn is started.
+func (s *ClaudeSessionService) ReconcileInterruptedSessions(killOrphans bool) error {
+	turns, err := s.turnRepo.GetByStatus(models.TurnStatusRunning)
+	if err != nil {
+		return fmt.Errorf("failed to get running turns: %w", err)
+	}
+
+	s.processMutex.Lock()
+	live := make(map[int]bool, len(s.runningProcesses))
+	for sessionID := range s.runningProcesses {
+		live[sessionID] = true
+	}
+	s.processMutex.Unlock()
+
+	// Latest interrupted turn per session, for the chat note
+	interruptedTurns := make(map[int]int)
+	for _, turn := range turns {
+		if live[turn.SessionID] {
+			continue
+		}
+		if err := s.turnRepo.Complete(turn.ID, models.TurnStatusInterrupted, interruptedReason); err != nil {
+			fmt.Printf("Failed to mark turn %d interrupted: %v\n", turn.ID, err)
+			continue
+		}
+		interruptedTurns[turn.SessionID] = turn.ID
+	}
+
+	sessions, err := s.sessionRepo.GetByActivityStatus(string(models.ActivityStatusStreaming))
+	if err != nil {
+		return fmt.Errorf("failed to get streaming sessions: %w", err)
+	}
+
+	for _, session := range sessions {
+		if live[session.ID] {
+			continue
+		}
+		turnID := interruptedTurns[session.ID]
+		fmt.Printf("Session %d was streaming when the server stopped; marking it idle\n", session.ID)
+
+		if err := s.sessionRepo.UpdateActivityStatus(session.ID, string(models.ActivityStatusIdle)); err != nil {
+			fmt.Printf("Failed to update session activity status: %v\n", err)
+			continue
+		}
+
+		s.addSystemMessage(session.ID, turnID, fmt.Sprintf("Turn interrupted: %s.", interruptedReason))
+
+		event := models.NewSessionEvent(models.EventTypeSessionInterrupted, session.ID, map[string]interface{}{
+			"turn_id": turnID,
+			"reason":  interruptedReason,
+		})
+		if err := s.eventRepo.Create(event); err != nil {
+			fmt.Printf("Failed to create session interrupted event: %v\n", err)
+		}
+	}
+
+	// Prompts waiting for a usage limit to reset are queued again and retried on time
+	waits, err := s.usageLimitRepo.GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to get prompts waiting for a usage limit: %w", err)
+	}
+	rearmed := make(map[int]bool, len(waits))
+	for _, wait := range waits {
+		if _, err := s.sessionRepo.GetByID(wait.SessionID); err != nil {
+			s.deleteUsageLimitWait(wait.SessionID)
+			continue
+		}
+		s.rearmUsageLimit(wait)
+		rearmed[wait.SessionID] = true
+	}
+
+	waiting, err := s.sessionRepo.GetByActivityStatus(string(models.ActivityStatusWaitingLimit))
+	if err != nil {
+		return fmt.Errorf("failed to get sessions waiting for a usage limit: %w", err)
+	}
+	for _, session := range waiting {
+		if rearmed[session.ID] {
+			continue
+		}
+		fmt.Printf("Session %d was waiting for a usage limit but no prompt was kept; marking it idle\n", session.ID)
+		if err := s.sessionRepo.UpdateActivityStatus(session.ID, string(models.ActivityStatusIdle)); err != nil {
+			fmt.Printf("Failed to update session activity status: %v\n", err)
+			continue
+		}
+		s.addSystemMessage(session.ID, 0, "The prompt waiting for the usage limit to reset was lost when the server stopped; send it again.")
+	}
+
+	if killOrphans {
+		if err := s.killOrphanedAgents(); err != nil {
+			fmt.Printf("Failed to clean up orphaned agent processes: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// killOrphanedAgents kills agent processes left running in session worktrees by a previous server
+func (s *ClaudeSessionService) killOrphanedAgents() error {
+	sessions, err := s.sessionRepo.GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	var worktrees []string
+	for _, session := range sessions {
+		worktrees = append(worktrees, session.WorktreePath)
+	}
+
+	processes, err := s.processManager.FindProcesses(s.agentCommandNames(), worktrees)
+	if err != nil {
+		return err
+	}
+
+	for _, proc := range processes {
+		fmt.Printf("Killing orphaned agent process %d (%s) in %s\n", proc.PID, proc.Command, proc.WorkingDir)
+		// Agents were started as process group leaders; fall back to the process alone
+		if err := s.processManager.KillProcessGroup(proc.PID); err != nil {
+			if err := s.processManager.KillProcess(proc.PID); err != nil {
+				fmt.Printf("Failed to kill orphaned agent process %d: %v\n", proc.PID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// agentCommandNames lists the program names of the registered agent backends
+func (s *ClaudeSessionService) agentCommandNames() []string {
+	var names []string
+	for _, name := range s.agents.Names() {
+		runner, err := s.agents.Get(name)
+		if err != nil {
+			continue
+		}
+		command, _, err := runner.Command(&AgentRunRequest{Settings: &models.AgentSettings{}})
+		if err == nil && command != "" {
+			names = append(names, filepath.Base(command))
+		}
+	}
+	return names
+}
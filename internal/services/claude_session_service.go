@@ -1,15 +1,16 @@
 package services
 
 import (
-	"bufio"
-	"encoding/json"
 	"fmt"
-	"os/exec"
-	"strings"
+	"io"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"habibi-go/internal/database/repositories"
 	"habibi-go/internal/models"
+	"habibi-go/internal/streamjson"
+	"habibi-go/internal/util"
 )
 
 // ClaudeSessionService handles Claude operations directly on sessions
@@ -18,10 +19,71 @@ type ClaudeSessionService struct {
 	projectRepo      *repositories.ProjectRepository
 	chatRepo         *repositories.ChatMessageV2Repository
 	eventRepo        *repositories.EventRepository
-	claudeBinaryPath string
+	turnRepo         *repositories.TurnRepository
+	todoRepo         *repositories.TodoRepository
+	validationRepo   *repositories.ValidationRepository
+	agents           *AgentRegistry
 	eventBroadcaster EventBroadcaster
-	runningProcesses map[int]*exec.Cmd
+	runningProcesses map[int]*runningTurn
 	processMutex     sync.Mutex
+	promptQueue      *PromptQueue
+	scheduler        *AgentScheduler
+	turnTimeout      time.Duration
+	noOutputTimeout  time.Duration
+	watchdogStop     chan struct{}
+	stopGracePeriod  time.Duration
+	processManager   *util.ProcessManager
+	sshService       *SSHService
+	gitService       *GitService
+
+	defaultAgentSettings *models.AgentSettings
+	permissions          *PermissionService
+	mcpServers           *MCPServerService
+	budgets              *BudgetService
+	// Sessions whose queue is held because a budget is used up; guarded by processMutex
+	heldQueues map[int]bool
+	// Usage limits sessions wait out before retrying, and how many inexact ones came in a
+	// row, keyed by session ID; guarded by processMutex
+	usageLimits          map[int]*models.UsageLimit
+	usageLimitRetries    map[int]int
+	usageLimitRepo       *repositories.UsageLimitRepository
+	usageLimitRetryDelay time.Duration
+
+	// Long-lived agent processes, keyed by session ID; guarded by processMutex
+	persistentAgents      map[int]*persistentAgent
+	persistentByDefault   bool
+	persistentIdleTimeout time.Duration
+}
+
+// runningTurn tracks the Claude process serving the current turn of a session.
+// It is registered before the process starts so the session counts as busy immediately.
+type runningTurn struct {
+	proc     agentProcess
+	runner   AgentRunner
+	turn     *models.Turn
+	settings *models.AgentSettings
+	priority RunPriority
+	ticket   *SchedulerTicket
+	stopped  bool
+
+	// Token the agent uses to reach the permission prompt tool, if any
+	permissionToken string
+	// MCP config of the project servers the session loads, nil if none
+	mcpConfig []byte
+	// Set when the turn is served by the session's long-lived process
+	agent *persistentAgent
+	// Raw stdout of the turn, saved when it ends
+	transcript *turnTranscript
+	// Fix-up prompts for failing checks sent in a row before this turn
+	validationIteration int
+	// Usage limit the agent reported on stderr; guarded by processMutex
+	usageLimit *models.UsageLimit
+
+	// Set once the process starts; read by the watchdog
+	exited       chan struct{}
+	startedAt    time.Time
+	lastOutputAt atomic.Int64
+	failReason   string
 }
 
 // NewClaudeSessionService creates a new Claude session service
@@ -30,39 +92,192 @@ func NewClaudeSessionService(
 	projectRepo *repositories.ProjectRepository,
 	chatRepo *repositories.ChatMessageV2Repository,
 	eventRepo *repositories.EventRepository,
+	turnRepo *repositories.TurnRepository,
+	todoRepo *repositories.TodoRepository,
+	validationRepo *repositories.ValidationRepository,
+	usageLimitRepo *repositories.UsageLimitRepository,
 	claudeBinaryPath string,
 ) *ClaudeSessionService {
+	agents := NewAgentRegistry()
+	agents.Register(newClaudeRunner(claudeBinaryPath))
+
 	return &ClaudeSessionService{
 		sessionRepo:      sessionRepo,
 		projectRepo:      projectRepo,
 		chatRepo:         chatRepo,
 		eventRepo:        eventRepo,
-		claudeBinaryPath: claudeBinaryPath,
+		turnRepo:         turnRepo,
+		todoRepo:         todoRepo,
+		validationRepo:   validationRepo,
+		agents:           agents,
 		eventBroadcaster: &NoOpBroadcaster{},
-		runningProcesses: make(map[int]*exec.Cmd),
+		runningProcesses: make(map[int]*runningTurn),
+		promptQueue:      NewPromptQueue(),
+		scheduler:        NewAgentScheduler(0, 0),
+		stopGracePeriod:  5 * time.Second,
+		processManager:   util.NewProcessManager(),
+		heldQueues:       make(map[int]bool),
+
+		usageLimits:          make(map[int]*models.UsageLimit),
+		usageLimitRetries:    make(map[int]int),
+		usageLimitRepo:       usageLimitRepo,
+		usageLimitRetryDelay: 5 * time.Minute,
+
+		persistentAgents:      make(map[int]*persistentAgent),
+		persistentIdleTimeout: 15 * time.Minute,
 	}
 }
 
 // SetEventBroadcaster sets the event broadcaster
 func (s *ClaudeSessionService) SetEventBroadcaster(broadcaster EventBroadcaster) {
 	s.eventBroadcaster = broadcaster
+	s.scheduler.SetEventBroadcaster(broadcaster)
+}
+
+// SetSSHService enables running Claude on the remote host of SSH projects
+func (s *ClaudeSessionService) SetSSHService(sshService *SSHService) {
+	s.sshService = sshService
+}
+
+// SetDefaultAgentSettings sets the agent settings used where projects and sessions set none
+func (s *ClaudeSessionService) SetDefaultAgentSettings(settings *models.AgentSettings) {
+	s.defaultAgentSettings = settings
+}
+
+// SetPermissionService routes tool permission prompts of restricted sessions to habibi
+func (s *ClaudeSessionService) SetPermissionService(permissions *PermissionService) {
+	s.permissions = permissions
+}
+
+// SetMCPServerService makes sessions load the MCP servers registered for their project
+func (s *ClaudeSessionService) SetMCPServerService(mcpServers *MCPServerService) {
+	s.mcpServers = mcpServers
+}
+
+// SetScheduler sets the scheduler that limits how many Claude runs execute at once
+func (s *ClaudeSessionService) SetScheduler(scheduler *AgentScheduler) {
+	scheduler.SetEventBroadcaster(s.eventBroadcaster)
+	s.scheduler = scheduler
+}
+
+// SendMessage sends a message to Claude for a session. If a turn is already running
+// the message is queued and returned; it starts automatically when the session is free.
+func (s *ClaudeSessionService) SendMessage(sessionID int, message string) (*models.QueuedPrompt, error) {
+	return s.sendMessage(sessionID, message, PriorityInteractive)
+}
+
+// SendScheduledMessage sends a message no user is waiting on, such as the prompt of a
+// best-of-N attempt. It waits behind interactive prompts for a free agent slot.
+func (s *ClaudeSessionService) SendScheduledMessage(sessionID int, message string) (*models.QueuedPrompt, error) {
+	return s.sendMessage(sessionID, message, PriorityScheduled)
+}
+
+func (s *ClaudeSessionService) sendMessage(sessionID int, message string, priority RunPriority) (*models.QueuedPrompt, error) {
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	// A used-up budget refuses the prompt or holds it in the queue
+	budget, err := s.budgetBlock(session)
+	if err != nil {
+		return nil, err
+	}
+	if budget != nil && budget.OnExceeded != models.BudgetQueue {
+		return nil, BudgetExceededError(budget)
+	}
+
+	// So does a usage limit the session is waiting out
+	held := budget != nil || s.activeUsageLimit(sessionID) != nil
+
+	s.processMutex.Lock()
+	if running, busy := s.runningProcesses[sessionID]; busy || held {
+		// A long-lived process takes follow-ups mid-turn; anything else waits its turn
+		if busy && !held {
+			if input, ok := s.acceptFollowUp(running, message); ok {
+				s.processMutex.Unlock()
+				return nil, s.sendFollowUp(running, message, input)
+			}
+		}
+
+		queued := s.promptQueue.Enqueue(sessionID, message)
+		s.processMutex.Unlock()
+
+		fmt.Printf("Queued prompt %d for session %d at position %d\n", queued.ID, sessionID, queued.Position)
+		s.eventBroadcaster.BroadcastEvent("prompt_queued", 0, map[string]interface{}{
+			"session_id": sessionID,
+			"prompt":     queued,
+			"queue":      s.promptQueue.List(sessionID),
+		})
+		if !busy && budget != nil {
+			s.holdQueue(sessionID, budget)
+		}
+		return queued, nil
+	}
+	running := &runningTurn{priority: priority}
+	s.runningProcesses[sessionID] = running
+	s.processMutex.Unlock()
+
+	if err := s.startTurn(sessionID, message, running); err != nil {
+		s.finishRun(sessionID)
+		return nil, err
+	}
+
+	return nil, nil
 }
 
-// SendMessage sends a message to Claude for a session
-func (s *ClaudeSessionService) SendMessage(sessionID int, message string) error {
-	// Get session
+// startTurn records a turn and its user message, then runs Claude for it in the background
+func (s *ClaudeSessionService) startTurn(sessionID int, message string, running *runningTurn) error {
+	// Reload so the turn resumes the conversation left by the previous one
 	session, err := s.sessionRepo.GetByID(sessionID)
 	if err != nil {
 		return fmt.Errorf("failed to get session: %w", err)
 	}
 
+	runner, err := s.runnerFor(session)
+	if err != nil {
+		return err
+	}
+
+	settings, err := s.agentSettingsFor(session)
+	if err != nil {
+		return err
+	}
+
+	var mcpConfig []byte
+	if s.mcpServers != nil {
+		if mcpConfig, err = s.mcpServers.SessionConfig(session); err != nil {
+			return err
+		}
+	}
+
+	// Record the turn before starting so failures are tracked too
+	turn := models.NewTurn(sessionID, conversationFor(session, runner), message)
+	turn.Backend = runner.Name()
+	turn.Model = settings.Model
+	turn.MaxTurns = settings.MaxTurns
+	turn.AppendSystemPrompt = settings.AppendSystemPrompt
+	if err := s.turnRepo.Create(turn); err != nil {
+		return fmt.Errorf("failed to create turn: %w", err)
+	}
+	s.processMutex.Lock()
+	running.turn = turn
+	running.runner = runner
+	running.settings = settings
+	running.mcpConfig = mcpConfig
+	s.processMutex.Unlock()
+
 	// Save user message
 	userMsg := &models.ChatMessage{
 		SessionID: sessionID,
+		TurnID:    turn.ID,
 		Role:      "user",
 		Content:   message,
 	}
 	if err := s.chatRepo.Create(userMsg); err != nil {
+		if completeErr := s.turnRepo.Complete(turn.ID, models.TurnStatusFailed, err.Error()); completeErr != nil {
+			fmt.Printf("Failed to complete turn record: %v\n", completeErr)
+		}
 		return fmt.Errorf("failed to save user message: %w", err)
 	}
 	fmt.Printf("Saved user message with ID: %d for session: %d\n", userMsg.ID, sessionID)
@@ -79,125 +294,225 @@ func (s *ClaudeSessionService) SendMessage(sessionID int, message string) error
 	}
 
 	// Execute Claude command
-	go s.executeClaudeCommand(session.ID, session.WorktreePath, message)
+	go s.executeClaudeCommand(session, running)
 
 	return nil
 }
 
-// executeClaudeCommand runs Claude in the session's worktree
-func (s *ClaudeSessionService) executeClaudeCommand(sessionID int, worktreePath string, message string) {
-	// Prepare Claude command
-	claudePath := s.claudeBinaryPath
-	if claudePath == "" {
-		claudePath = "claude"
-	}
+// finishRun frees the session and starts the next queued prompt, if any, at scheduled
+// priority. Queued prompts are held while the session's budget is used up or it waits
+// out a usage limit.
+func (s *ClaudeSessionService) finishRun(sessionID int) {
+	for {
+		s.processMutex.Lock()
+		delete(s.runningProcesses, sessionID)
+		waiting := s.promptQueue.Len(sessionID) > 0
+		if !waiting {
+			delete(s.heldQueues, sessionID)
+		}
+		s.processMutex.Unlock()
+		if !waiting || s.queueHeld(sessionID) {
+			return
+		}
 
-	// Build command with -c flag to continue conversation in this directory
-	// Note: message should come after -c flag, and --verbose is required for proper output
-	args := []string{"--verbose", "--output-format", "stream-json", "--dangerously-skip-permissions", "-c", message}
-	cmd := exec.Command(claudePath, args...)
-	cmd.Dir = worktreePath
+		s.processMutex.Lock()
+		if _, busy := s.runningProcesses[sessionID]; busy {
+			// A prompt sent meanwhile started a turn; its end picks up the queue
+			s.processMutex.Unlock()
+			return
+		}
+		next, ok := s.promptQueue.Dequeue(sessionID)
+		if !ok {
+			s.processMutex.Unlock()
+			return
+		}
+		// Queued prompts, validation fix-ups and usage limit retries have no user waiting on them
+		running := &runningTurn{priority: PriorityScheduled, validationIteration: next.ValidationIteration}
+		s.runningProcesses[sessionID] = running
+		s.processMutex.Unlock()
 
-	// Get stdout pipe
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		s.handleError(sessionID, fmt.Errorf("failed to get stdout pipe: %w", err))
-		return
-	}
+		fmt.Printf("Starting queued prompt %d for session %d\n", next.ID, sessionID)
+		s.broadcastQueue(sessionID)
 
-	// Get stderr pipe for debugging
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		s.handleError(sessionID, fmt.Errorf("failed to get stderr pipe: %w", err))
-		return
+		err := s.startTurn(sessionID, next.Prompt, running)
+		if err == nil {
+			return
+		}
+		s.handleError(sessionID, fmt.Errorf("failed to start queued prompt: %w", err))
 	}
+}
 
-	// Start command
-	fmt.Printf("Starting Claude command: %s %v in directory: %s\n", claudePath, args, worktreePath)
-	if err := cmd.Start(); err != nil {
-		s.handleError(sessionID, fmt.Errorf("failed to start Claude: %w", err))
-		return
+// executeClaudeCommand runs the session's agent backend in its worktree
+func (s *ClaudeSessionService) executeClaudeCommand(session *models.Session, running *runningTurn) {
+	sessionID := session.ID
+	turn := running.turn
+	runner := running.runner
+
+	// Free the session and move on to the next queued prompt when done
+	defer s.finishRun(sessionID)
+
+	// Keep the raw output so the chat can be rebuilt from it later
+	running.transcript = newTurnTranscript()
+	defer s.saveTranscript(running)
+
+	// Run the project's checks once the turn is done and its snapshot taken
+	defer s.validateTurn(session, running)
+
+	// Wait for a free agent slot
+	ticket := s.scheduler.NewTicket(sessionID, session.ProjectID, running.priority)
+	s.processMutex.Lock()
+	stoppedEarly := running.stopped
+	running.ticket = ticket
+	s.processMutex.Unlock()
+	if !stoppedEarly {
+		if err := s.scheduler.Acquire(ticket); err != nil {
+			fmt.Printf("Agent run for session %d did not start: %v\n", sessionID, err)
+		}
+		defer s.scheduler.Release(ticket)
 	}
-	fmt.Printf("Claude command started successfully for session %d\n", sessionID)
 
-	// Track the running process
+	// Start command unless the turn was stopped before it got going
+	var proc agentProcess
 	s.processMutex.Lock()
-	s.runningProcesses[sessionID] = cmd
+	stoppedEarly = running.stopped
 	s.processMutex.Unlock()
+	if !stoppedEarly {
+		// Record the worktree so what the turn changed can be shown and undone
+		if s.snapshotsEnabled(session) {
+			s.snapshotTurn(session, turn, SnapshotBefore)
+			defer s.snapshotTurn(session, turn, SnapshotAfter)
+		}
 
-	// Ensure we clean up the process tracking when done
-	defer func() {
-		s.processMutex.Lock()
-		delete(s.runningProcesses, sessionID)
+		if streaming := s.persistentRunner(session, runner); streaming != nil {
+			s.runPersistentTurn(session, running, streaming)
+			return
+		}
+
+		var err error
+		proc, err = s.startAgentProcess(session, running, false)
+		if running.permissionToken != "" {
+			// Deny whatever is still waiting for a decision once the run is over
+			defer s.permissions.UnregisterRun(running.permissionToken)
+		}
+		if err != nil {
+			s.failTurn(turn, err)
+			return
+		}
+	}
+
+	s.processMutex.Lock()
+	if running.stopped {
 		s.processMutex.Unlock()
-	}()
+		if proc != nil {
+			// Stopped while the process was starting
+			proc.Kill()
+			proc.Wait()
+		}
+		s.completeStoppedTurn(turn)
+		return
+	}
+	running.proc = proc
+	running.exited = make(chan struct{})
+	running.startedAt = time.Now()
+	running.lastOutputAt.Store(running.startedAt.UnixNano())
+	s.processMutex.Unlock()
+	fmt.Printf("%s command started successfully for session %d\n", runner.Name(), sessionID)
+	stdout, stderr := proc.Stdout(), proc.Stderr()
 
-	// Read stderr in background for debugging
+	// Read stderr in background for debugging and for usage limits the agent reports
+	stderrDone := make(chan struct{})
 	go func() {
-		scanner := bufio.NewScanner(stderr)
+		defer close(stderrDone)
+		scanner := streamjson.NewLineScanner(stderr)
 		for scanner.Scan() {
 			line := scanner.Text()
-			fmt.Printf("Claude stderr: %s\n", line)
+			running.lastOutputAt.Store(time.Now().UnixNano())
+			fmt.Printf("%s stderr: %s\n", runner.Name(), line)
+			s.noteUsageLimit(running, line)
+		}
+		if err := scanner.Err(); err != nil {
+			// Keep draining so the agent does not block on a full pipe
+			fmt.Printf("Failed to read %s stderr for session %d: %v\n", runner.Name(), sessionID, err)
+			io.Copy(io.Discard, stderr)
 		}
 	}()
 
 	// Process stdout
-	scanner := bufio.NewScanner(stdout)
-	var assistantMessage strings.Builder
-	assistantMessageID := 0
+	scanner := streamjson.NewLineScanner(stdout)
+	parser := runner.NewParser()
 
-	fmt.Printf("Starting to read Claude output for session %d\n", sessionID)
+	fmt.Printf("Starting to read %s output for session %d\n", runner.Name(), sessionID)
 	for scanner.Scan() {
 		line := scanner.Text()
-		fmt.Printf("Claude stdout line: %s\n", line)
-
-		// Try to parse as JSON (stream-json format)
-		var streamMsg map[string]interface{}
-		if err := json.Unmarshal([]byte(line), &streamMsg); err == nil {
-			msgType, _ := streamMsg["type"].(string)
-			fmt.Printf("Parsed JSON stream message type=%v\n", msgType)
-
-			switch msgType {
-			case "assistant":
-				// Handle assistant messages - each message is independent
-				messageID := 0
-				s.handleAssistantMessage(sessionID, streamMsg, &messageID)
-			case "user":
-				// Handle tool results
-				s.handleToolResultMessage(sessionID, streamMsg)
-			case "system", "result":
-				// Log but don't process
-				fmt.Printf("System/Result message: %+v\n", streamMsg)
-			default:
-				// Try old format handler as fallback
-				s.handleStreamMessage(sessionID, streamMsg, &assistantMessage, &assistantMessageID)
-			}
-		} else {
-			fmt.Printf("Failed to parse as JSON (error: %v), treating as plain text: %s\n", err, line)
-			// If not JSON, treat as plain text output
-			assistantMessage.WriteString(line)
-			assistantMessage.WriteString("\n")
+		running.lastOutputAt.Store(time.Now().UnixNano())
+		fmt.Printf("%s stdout line: %s\n", runner.Name(), line)
+		running.transcript.Add(line)
 
-			// Broadcast the chunk
-			s.eventBroadcaster.BroadcastEvent("claude_output", 0, map[string]interface{}{
-				"session_id":   sessionID,
-				"content_type": "text",
-				"output":       line + "\n",
-				"is_chunk":     true,
-			})
+		for _, event := range parser.ParseLine(line) {
+			s.handleAgentEvent(turn, event)
 		}
 	}
-	fmt.Printf("Finished reading Claude output for session %d\n", sessionID)
+	readErr := scanner.Err()
+	if readErr != nil {
+		// The rest of the output is lost, so the turn cannot finish
+		proc.Kill()
+	}
+	for _, event := range parser.Flush() {
+		s.handleAgentEvent(turn, event)
+	}
+	fmt.Printf("Finished reading %s output for session %d\n", runner.Name(), sessionID)
+	<-stderrDone
 
 	// Wait for command to complete
-	if err := cmd.Wait(); err != nil {
-		s.handleError(sessionID, fmt.Errorf("Claude command failed: %w", err))
+	waitErr := proc.Wait()
+	close(running.exited)
+	s.processMutex.Lock()
+	stopped := running.stopped || running.failReason != ""
+	s.processMutex.Unlock()
+	if stopped {
+		// StopGeneration or the watchdog already reported the outcome
+		return
+	}
+	if readErr != nil {
+		s.failTurn(turn, fmt.Errorf("failed to read %s output: %w", runner.Name(), readErr))
+		return
+	}
+	if limit := s.turnUsageLimit(running, waitErr != nil); limit != nil {
+		s.waitForUsageLimit(running, limit)
+		return
+	}
+	if waitErr != nil {
+		s.failTurn(turn, fmt.Errorf("%s command failed: %w", runner.Name(), waitErr))
 		return
 	}
 
-	// Since messages are now saved as they arrive, we don't need to do final saving
-	// Just log the completion
-	fmt.Printf("Claude command completed. Assistant message ID: %d\n", assistantMessageID)
+	s.completeTurn(turn, runner)
+}
+
+// completeStoppedTurn records a turn that was stopped before its process got going
+func (s *ClaudeSessionService) completeStoppedTurn(turn *models.Turn) {
+	if err := s.turnRepo.Complete(turn.ID, models.TurnStatusStopped, ""); err != nil {
+		fmt.Printf("Failed to complete turn record: %v\n", err)
+	}
+	if err := s.sessionRepo.UpdateActivityStatus(turn.SessionID, string(models.ActivityStatusIdle)); err != nil {
+		fmt.Printf("Failed to update session activity status: %v\n", err)
+	}
+}
+
+// completeTurn records a turn the agent finished and announces the response
+func (s *ClaudeSessionService) completeTurn(turn *models.Turn, runner AgentRunner) {
+	sessionID := turn.SessionID
+
+	status, errorMsg := models.TurnStatusCompleted, ""
+	if turn.IsError {
+		status, errorMsg = models.TurnStatusFailed, turn.Error
+	}
+	if err := s.turnRepo.Complete(turn.ID, status, errorMsg); err != nil {
+		fmt.Printf("Failed to complete turn record: %v\n", err)
+	}
+
+	// Messages are saved as they arrive, so there is nothing left to persist
+	fmt.Printf("%s command completed for turn %d\n", runner.Name(), turn.ID)
 
 	// Update session activity
 	if err := s.sessionRepo.UpdateActivityStatus(sessionID, string(models.ActivityStatusNewResponse)); err != nil {
@@ -206,248 +521,338 @@ func (s *ClaudeSessionService) executeClaudeCommand(sessionID int, worktreePath
 
 	// Broadcast completion
 	s.eventBroadcaster.BroadcastEvent("claude_response_complete", 0, map[string]interface{}{
-		"session_id": sessionID,
+		"session_id":        sessionID,
+		"turn_id":           turn.ID,
+		"backend":           turn.Backend,
+		"claude_session_id": turn.ClaudeSessionID,
+		"usage":             turn.TurnUsage,
 	})
 }
 
-// handleStreamMessage processes a JSON message from Claude's stream
-func (s *ClaudeSessionService) handleStreamMessage(sessionID int, msg map[string]interface{}, assistantMessage *strings.Builder, assistantMessageID *int) {
-	msgType, _ := msg["type"].(string)
-
-	switch msgType {
-	case "message_start":
-		// New message started
-		fmt.Printf("message_start: creating new assistant message for session %d\n", sessionID)
-		if message, ok := msg["message"].(map[string]interface{}); ok {
-			if _, ok := message["id"].(string); ok {
-				// Create new assistant message
-				newMsg := &models.ChatMessage{
-					SessionID: sessionID,
-					Role:      "assistant",
-					Content:   "",
-				}
-				if err := s.chatRepo.Create(newMsg); err == nil {
-					*assistantMessageID = newMsg.ID
-					fmt.Printf("Created assistant message with ID: %d\n", newMsg.ID)
-				} else {
-					fmt.Printf("Failed to create assistant message: %v\n", err)
-				}
-			}
+// handleAgentEvent saves and broadcasts one event from the agent's output
+func (s *ClaudeSessionService) handleAgentEvent(turn *models.Turn, event AgentEvent) {
+	sessionID := turn.SessionID
+
+	switch event.Type {
+	case AgentEventTextDelta:
+		// Streamed text is shown live; the complete text event with the same stream ID replaces it
+		s.eventBroadcaster.BroadcastEvent("claude_output", 0, map[string]interface{}{
+			"session_id":         sessionID,
+			"content_type":       "text",
+			"output":             event.Text,
+			"is_chunk":           true,
+			"stream_id":          event.StreamID,
+			"parent_tool_use_id": event.ParentToolUseID,
+		})
+
+	case AgentEventText:
+		newMsg := chatMessageForEvent(turn, event)
+		if err := s.chatRepo.Create(newMsg); err != nil {
+			fmt.Printf("Failed to create assistant message: %v\n", err)
+			return
 		}
+		fmt.Printf("Created assistant message with ID: %d, content: %s\n", newMsg.ID, event.Text)
 
-	case "content_block_delta":
-		// Text content
-		if delta, ok := msg["delta"].(map[string]interface{}); ok {
-			if text, ok := delta["text"].(string); ok {
-				assistantMessage.WriteString(text)
-
-				// Broadcast the chunk
-				s.eventBroadcaster.BroadcastEvent("claude_output", 0, map[string]interface{}{
-					"session_id":    sessionID,
-					"content_type":  "text",
-					"output":        text,
-					"is_chunk":      true,
-					"db_message_id": *assistantMessageID,
-				})
-			}
+		s.eventBroadcaster.BroadcastEvent("claude_output", 0, map[string]interface{}{
+			"session_id":         sessionID,
+			"content_type":       "text",
+			"output":             event.Text,
+			"is_chunk":           false,
+			"db_message_id":      newMsg.ID,
+			"stream_id":          event.StreamID,
+			"parent_tool_use_id": event.ParentToolUseID,
+		})
+
+	case AgentEventThinking, AgentEventImage:
+		newMsg := chatMessageForEvent(turn, event)
+		contentType := newMsg.ContentType
+		if err := s.chatRepo.Create(newMsg); err != nil {
+			fmt.Printf("Failed to create %s message: %v\n", contentType, err)
+			return
 		}
 
-	case "tool_use":
-		// Tool use message
-		if toolName, ok := msg["name"].(string); ok {
-			toolUseID, _ := msg["id"].(string)
-			toolInput := msg["input"]
-
-			// Save tool use message
-			toolMsg := &models.ChatMessage{
-				SessionID: sessionID,
-				Role:      "tool_use",
-				Content:   "",
-				ToolName:  toolName,
-				ToolInput: toolInput,
-				ToolUseID: toolUseID,
-			}
-			if err := s.chatRepo.Create(toolMsg); err == nil {
-				// Broadcast tool use
-				s.eventBroadcaster.BroadcastEvent("claude_output", 0, map[string]interface{}{
-					"session_id":    sessionID,
-					"content_type":  "tool_use",
-					"tool_name":     toolName,
-					"tool_input":    toolInput,
-					"tool_use_id":   toolUseID,
-					"db_message_id": toolMsg.ID,
-				})
-			}
+		s.eventBroadcaster.BroadcastEvent("claude_output", 0, map[string]interface{}{
+			"session_id":         sessionID,
+			"content_type":       contentType,
+			"output":             event.Text,
+			"content_data":       event.Data,
+			"is_chunk":           false,
+			"db_message_id":      newMsg.ID,
+			"parent_tool_use_id": event.ParentToolUseID,
+		})
+
+	case AgentEventUnknown:
+		// Not saved, but shown so nothing the agent sends goes missing silently
+		s.eventBroadcaster.BroadcastEvent("claude_output", 0, map[string]interface{}{
+			"session_id":         sessionID,
+			"content_type":       "unknown",
+			"content_data":       event.Data,
+			"parent_tool_use_id": event.ParentToolUseID,
+		})
+
+	case AgentEventToolUse:
+		toolMsg := chatMessageForEvent(turn, event)
+		if err := s.chatRepo.Create(toolMsg); err != nil {
+			fmt.Printf("Failed to create tool_use message: %v\n", err)
+			return
 		}
+		fmt.Printf("Created tool_use message: %s with input: %+v\n", event.ToolName, event.ToolInput)
 
-	case "tool_result":
-		// Tool result message
-		if toolUseID, ok := msg["tool_use_id"].(string); ok {
-			content := msg["content"]
+		s.eventBroadcaster.BroadcastEvent("claude_output", 0, map[string]interface{}{
+			"session_id":         sessionID,
+			"content_type":       "tool_use",
+			"tool_name":          event.ToolName,
+			"tool_input":         event.ToolInput,
+			"tool_use_id":        event.ToolUseID,
+			"db_message_id":      toolMsg.ID,
+			"parent_tool_use_id": event.ParentToolUseID,
+		})
 
-			// Save tool result message
-			toolMsg := &models.ChatMessage{
-				SessionID:   sessionID,
-				Role:        "tool_result",
-				Content:     "",
-				ToolUseID:   toolUseID,
-				ToolContent: content,
-			}
-			if err := s.chatRepo.Create(toolMsg); err == nil {
-				// Broadcast tool result
-				s.eventBroadcaster.BroadcastEvent("claude_output", 0, map[string]interface{}{
-					"session_id":    sessionID,
-					"content_type":  "tool_result",
-					"tool_use_id":   toolUseID,
-					"tool_content":  content,
-					"db_message_id": toolMsg.ID,
-				})
-			}
+		// Sub-agents keep task lists of their own; the session's list is the main agent's
+		if event.ToolName == todoWriteTool && event.ParentToolUseID == "" {
+			s.recordTodos(turn, event)
 		}
+
+	case AgentEventToolResult:
+		toolMsg := chatMessageForEvent(turn, event)
+		if err := s.chatRepo.Create(toolMsg); err != nil {
+			fmt.Printf("Failed to create tool_result message: %v\n", err)
+			return
+		}
+
+		s.eventBroadcaster.BroadcastEvent("claude_output", 0, map[string]interface{}{
+			"session_id":         sessionID,
+			"content_type":       "tool_result",
+			"tool_use_id":        event.ToolUseID,
+			"tool_content":       event.ToolContent,
+			"db_message_id":      toolMsg.ID,
+			"parent_tool_use_id": event.ParentToolUseID,
+		})
+
+	case AgentEventSession:
+		// Remember which agent conversation this turn belongs to
+		s.recordClaudeSessionID(turn, event.SessionID)
+		s.recordTurnModel(turn, event.Model)
+
+	case AgentEventResult:
+		s.recordTurnUsage(turn, event)
 	}
 }
 
-// handleError handles errors during Claude execution
-func (s *ClaudeSessionService) handleError(sessionID int, err error) {
-	fmt.Printf("Claude error for session %d: %v\n", sessionID, err)
+// chatMessageForEvent builds the chat message an agent event is saved as, or nil
+// for events that are not saved
+func chatMessageForEvent(turn *models.Turn, event AgentEvent) *models.ChatMessage {
+	msg := &models.ChatMessage{
+		SessionID:       turn.SessionID,
+		TurnID:          turn.ID,
+		ParentToolUseID: event.ParentToolUseID,
+	}
 
-	// Update session status
-	if err := s.sessionRepo.UpdateActivityStatus(sessionID, string(models.ActivityStatusIdle)); err != nil {
-		fmt.Printf("Failed to update session status: %v\n", err)
+	switch event.Type {
+	case AgentEventText:
+		msg.Role = "assistant"
+		msg.Content = event.Text
+	case AgentEventThinking, AgentEventImage:
+		msg.Role = "assistant"
+		msg.Content = event.Text
+		msg.ContentType = models.ContentTypeThinking
+		if event.Type == AgentEventImage {
+			msg.ContentType = models.ContentTypeImage
+		}
+		msg.ContentData = event.Data
+	case AgentEventToolUse:
+		msg.Role = "tool_use"
+		msg.ToolName = event.ToolName
+		msg.ToolInput = event.ToolInput
+		msg.ToolUseID = event.ToolUseID
+	case AgentEventToolResult:
+		msg.Role = "tool_result"
+		msg.ToolUseID = event.ToolUseID
+		msg.ToolContent = event.ToolContent
+	default:
+		return nil
 	}
+	return msg
+}
 
-	// Broadcast error
-	s.eventBroadcaster.BroadcastEvent("claude_error", 0, map[string]interface{}{
-		"session_id": sessionID,
-		"error":      err.Error(),
-	})
+// recordTurnUsage stores the token, cost and timing data from the agent's result. A turn
+// that got follow-ups has a result for each, and counts them all.
+func (s *ClaudeSessionService) recordTurnUsage(turn *models.Turn, event AgentEvent) {
+	if event.Usage != nil {
+		turn.TurnUsage.Add(event.Usage)
+	}
+	if event.Error != "" {
+		turn.IsError = true
+		turn.Error = event.Error
+	}
+
+	if err := s.turnRepo.UpdateUsage(turn.ID, &turn.TurnUsage); err != nil {
+		fmt.Printf("Failed to update turn usage: %v\n", err)
+	}
+
+	if s.budgets != nil && event.Usage != nil {
+		s.budgets.RecordTurn(turn, event.Usage)
+	}
 }
 
-// handleAssistantMessage handles assistant messages in the new format
-func (s *ClaudeSessionService) handleAssistantMessage(sessionID int, msg map[string]interface{}, assistantMessageID *int) {
-	message, ok := msg["message"].(map[string]interface{})
-	if !ok {
-		fmt.Printf("No message field in assistant message\n")
-		return
+// startAgentProcess runs a turn's command, over SSH when the project lives on a remote host
+// With streamInput set the process stays up and reads prompts from stdin.
+func (s *ClaudeSessionService) startAgentProcess(session *models.Session, running *runningTurn, streamInput bool) (agentProcess, error) {
+	runner, settings := running.runner, running.settings
+	project, err := s.projectRepo.GetByID(session.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
 	}
 
-	content, ok := message["content"].([]interface{})
-	if !ok {
-		fmt.Printf("No content field in assistant message\n")
-		return
+	req := &AgentRunRequest{
+		Prompt:       running.turn.Prompt,
+		ResumeID:     conversationFor(session, runner),
+		WorktreePath: session.WorktreePath,
+		Remote:       s.sshService != nil && s.sshService.IsSSHProject(project),
+		Settings:     settings,
+		StreamInput:  streamInput,
 	}
 
-	// Process each content block
-	for _, block := range content {
-		blockMap, ok := block.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		blockType, _ := blockMap["type"].(string)
-
-		switch blockType {
-		case "text":
-			text, _ := blockMap["text"].(string)
-			if text != "" {
-				// Always create new assistant message for each message event
-				// (Claude sends complete messages, not deltas)
-				newMsg := &models.ChatMessage{
-					SessionID: sessionID,
-					Role:      "assistant",
-					Content:   text,
-				}
-				if err := s.chatRepo.Create(newMsg); err == nil {
-					*assistantMessageID = newMsg.ID
-					fmt.Printf("Created assistant message with ID: %d, content: %s\n", newMsg.ID, text)
-					
-					// Broadcast the text
-					s.eventBroadcaster.BroadcastEvent("claude_output", 0, map[string]interface{}{
-						"session_id":    sessionID,
-						"content_type":  "text",
-						"output":        text,
-						"is_chunk":      false,
-						"db_message_id": newMsg.ID,
-					})
-				} else {
-					fmt.Printf("Failed to create assistant message: %v\n", err)
-				}
-			}
+	if running.mcpConfig != nil {
+		if req.MCPConfigPath, err = s.mcpServers.WriteConfig(project, session, running.mcpConfig, req.Remote); err != nil {
+			return nil, err
+		}
+	}
 
-		case "tool_use":
-			toolName, _ := blockMap["name"].(string)
-			toolUseID, _ := blockMap["id"].(string)
-			toolInput := blockMap["input"]
-
-			// Save tool use message
-			toolMsg := &models.ChatMessage{
-				SessionID: sessionID,
-				Role:      "tool_use",
-				Content:   "",
-				ToolName:  toolName,
-				ToolInput: toolInput,
-				ToolUseID: toolUseID,
-			}
-			if err := s.chatRepo.Create(toolMsg); err == nil {
-				fmt.Printf("Created tool_use message: %s with input: %+v\n", toolName, toolInput)
-				// Broadcast tool use
-				s.eventBroadcaster.BroadcastEvent("claude_output", 0, map[string]interface{}{
-					"session_id":    sessionID,
-					"content_type":  "tool_use",
-					"tool_name":     toolName,
-					"tool_input":    toolInput,
-					"tool_use_id":   toolUseID,
-					"db_message_id": toolMsg.ID,
-				})
-				fmt.Printf("Broadcasted tool_use event for %s\n", toolName)
-			}
+	// Restricted sessions ask habibi's viewers before running tools that are not allowed up front.
+	// Agents on SSH hosts can only ask when habibi's URL is configured to be reachable from there.
+	askPermissions := s.permissions != nil && settings.PermissionMode != string(models.PermissionModeBypassPermissions)
+	if askPermissions && req.Remote && !s.permissions.RemoteReachable() {
+		fmt.Printf("Session %d runs remotely without agents.permission_prompt_url; only tools allowed up front will run\n", session.ID)
+		askPermissions = false
+	}
+	if askPermissions {
+		token, err := s.permissions.RegisterRun(session.ID, running.turn.ID)
+		if err != nil {
+			return nil, err
+		}
+		running.permissionToken = token
+		if req.PermissionMCPConfig, err = s.permissions.MCPConfig(token); err != nil {
+			return nil, err
 		}
 	}
+
+	command, args, err := runner.Command(req)
+	if err != nil {
+		return nil, err
+	}
+	// Arguments are left out: they hold the prompt and the permission tool's token
+	fmt.Printf("Starting %s command: %s in directory: %s\n", runner.Name(), command, session.WorktreePath)
+
+	if req.Remote {
+		return s.sshService.StartAgentProcess(project, session.WorktreePath, command, args, streamInput)
+	}
+	return startLocalAgentProcess(s.processManager, command, session.WorktreePath, args, streamInput)
+}
+
+// agentSettingsFor resolves the permission and model settings a session's next turn runs with
+func (s *ClaudeSessionService) agentSettingsFor(session *models.Session) (*models.AgentSettings, error) {
+	project, err := s.projectRepo.GetByID(session.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+
+	settings, err := models.ResolveAgentSettings(s.defaultAgentSettings, project, session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve agent settings: %w", err)
+	}
+	return settings, nil
+}
+
+// runnerFor picks the agent backend for a session: the session's own choice,
+// then its project's, then Claude
+func (s *ClaudeSessionService) runnerFor(session *models.Session) (AgentRunner, error) {
+	if name, ok := session.Config["agent_backend"].(string); ok && name != "" {
+		return s.agents.Get(name)
+	}
+
+	project, err := s.projectRepo.GetByID(session.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	if name, ok := project.Config["agent_backend"].(string); ok && name != "" {
+		return s.agents.Get(name)
+	}
+
+	return s.agents.Get(DefaultAgentBackend)
+}
+
+// RegisterAgentBackend makes an agent backend available to projects and sessions
+func (s *ClaudeSessionService) RegisterAgentBackend(runner AgentRunner) {
+	s.agents.Register(runner)
+}
+
+// AgentBackends lists the names of the registered agent backends
+func (s *ClaudeSessionService) AgentBackends() []string {
+	return s.agents.Names()
+}
+
+// conversationFor returns the conversation a session's next turn resumes. Conversation
+// IDs belong to the backend that started them, so another backend starts a fresh one.
+func conversationFor(session *models.Session, runner AgentRunner) string {
+	if session.ConversationBackend != runner.Name() {
+		return ""
+	}
+	return session.ClaudeSessionID
 }
 
-// handleToolResultMessage handles tool result messages
-func (s *ClaudeSessionService) handleToolResultMessage(sessionID int, msg map[string]interface{}) {
-	message, ok := msg["message"].(map[string]interface{})
-	if !ok {
+// recordClaudeSessionID stores the Claude conversation ID reported for a turn
+// and makes it the conversation the session resumes next time
+func (s *ClaudeSessionService) recordClaudeSessionID(turn *models.Turn, claudeSessionID string) {
+	if claudeSessionID == "" || claudeSessionID == turn.ClaudeSessionID {
 		return
 	}
+	turn.ClaudeSessionID = claudeSessionID
 
-	content, ok := message["content"].([]interface{})
-	if !ok {
+	if err := s.turnRepo.UpdateClaudeSessionID(turn.ID, claudeSessionID); err != nil {
+		fmt.Printf("Failed to update turn claude session ID: %v\n", err)
+	}
+	if err := s.sessionRepo.UpdateClaudeSessionID(turn.SessionID, claudeSessionID, turn.Backend); err != nil {
+		fmt.Printf("Failed to update session claude session ID: %v\n", err)
+	}
+}
+
+// recordTurnModel stores the model the agent reports for a turn that did not pick one
+func (s *ClaudeSessionService) recordTurnModel(turn *models.Turn, model string) {
+	if model == "" || turn.Model != "" {
 		return
 	}
+	turn.Model = model
 
-	for _, item := range content {
-		itemMap, ok := item.(map[string]interface{})
-		if !ok {
-			continue
+	if err := s.turnRepo.UpdateModel(turn.ID, model); err != nil {
+		fmt.Printf("Failed to update turn model: %v\n", err)
+	}
+}
+
+// failTurn records a failed turn and reports the error
+func (s *ClaudeSessionService) failTurn(turn *models.Turn, err error) {
+	if turn.ID != 0 {
+		if completeErr := s.turnRepo.Complete(turn.ID, models.TurnStatusFailed, err.Error()); completeErr != nil {
+			fmt.Printf("Failed to complete turn record: %v\n", completeErr)
 		}
+	}
+	s.handleError(turn.SessionID, err)
+}
 
-		if itemMap["type"] == "tool_result" {
-			toolUseID, _ := itemMap["tool_use_id"].(string)
-			toolContent := itemMap["content"]
+// handleError handles errors during Claude execution
+func (s *ClaudeSessionService) handleError(sessionID int, err error) {
+	fmt.Printf("Claude error for session %d: %v\n", sessionID, err)
 
-			// Save tool result message
-			toolMsg := &models.ChatMessage{
-				SessionID:   sessionID,
-				Role:        "tool_result",
-				Content:     "",
-				ToolUseID:   toolUseID,
-				ToolContent: toolContent,
-			}
-			if err := s.chatRepo.Create(toolMsg); err == nil {
-				fmt.Printf("Created tool_result message\n")
-				// Broadcast tool result
-				s.eventBroadcaster.BroadcastEvent("claude_output", 0, map[string]interface{}{
-					"session_id":    sessionID,
-					"content_type":  "tool_result",
-					"tool_use_id":   toolUseID,
-					"tool_content":  toolContent,
-					"db_message_id": toolMsg.ID,
-				})
-			}
-		}
+	// Update session status
+	if err := s.sessionRepo.UpdateActivityStatus(sessionID, string(models.ActivityStatusIdle)); err != nil {
+		fmt.Printf("Failed to update session status: %v\n", err)
 	}
+
+	// Broadcast error
+	s.eventBroadcaster.BroadcastEvent("claude_error", 0, map[string]interface{}{
+		"session_id": sessionID,
+		"error":      err.Error(),
+	})
 }
 
 // GetChatHistory retrieves chat history for a session
@@ -455,19 +860,44 @@ func (s *ClaudeSessionService) GetChatHistory(sessionID int, limit int) ([]*mode
 	return s.chatRepo.GetBySessionID(sessionID, limit)
 }
 
-// StopGeneration stops the Claude process for a session
+// StopGeneration interrupts the Claude run for a session. The process group gets SIGINT
+// and is killed if it has not exited after the grace period.
 func (s *ClaudeSessionService) StopGeneration(sessionID int) error {
 	s.processMutex.Lock()
-	cmd, exists := s.runningProcesses[sessionID]
+	running, exists := s.runningProcesses[sessionID]
+	var proc agentProcess
+	var turn *models.Turn
+	var ticket *SchedulerTicket
+	var exited chan struct{}
+	if exists {
+		running.stopped = true
+		proc, turn, ticket, exited = running.proc, running.turn, running.ticket, running.exited
+	}
 	s.processMutex.Unlock()
 
 	if !exists {
 		return fmt.Errorf("no running process for session %d", sessionID)
 	}
 
-	// Kill the process
-	if err := cmd.Process.Kill(); err != nil {
-		return fmt.Errorf("failed to kill process: %w", err)
+	// A run still waiting for a slot gives up its place in line
+	if ticket != nil && proc == nil {
+		s.scheduler.Cancel(ticket)
+	}
+
+	// Interrupt the process group; if the process has not started yet it never will
+	if proc != nil {
+		go func() {
+			if err := proc.Interrupt(exited, s.stopGracePeriod); err != nil {
+				fmt.Printf("Failed to stop Claude process group for session %d: %v\n", sessionID, err)
+			}
+		}()
+	}
+
+	if turn != nil {
+		if err := s.turnRepo.Complete(turn.ID, models.TurnStatusStopped, ""); err != nil {
+			fmt.Printf("Failed to complete turn record: %v\n", err)
+		}
+		s.addSystemMessage(sessionID, turn.ID, "Turn interrupted: generation was stopped before Claude finished.")
 	}
 
 	// Update session status
@@ -482,3 +912,235 @@ func (s *ClaudeSessionService) StopGeneration(sessionID int) error {
 
 	return nil
 }
+
+// SetStopGracePeriod sets how long a stopped run may take to exit before it is killed
+func (s *ClaudeSessionService) SetStopGracePeriod(grace time.Duration) {
+	if grace > 0 {
+		s.stopGracePeriod = grace
+	}
+}
+
+// addSystemMessage saves and broadcasts a system note in the session's chat
+func (s *ClaudeSessionService) addSystemMessage(sessionID, turnID int, content string) {
+	msg := &models.ChatMessage{
+		SessionID: sessionID,
+		TurnID:    turnID,
+		Role:      "system",
+		Content:   content,
+	}
+	if err := s.chatRepo.Create(msg); err != nil {
+		fmt.Printf("Failed to save system message: %v\n", err)
+		return
+	}
+
+	s.eventBroadcaster.BroadcastEvent("new_chat_message", 0, map[string]interface{}{
+		"session_id": sessionID,
+		"message":    msg,
+	})
+}
+
+// ListConversations returns the Claude conversations recorded for a session, latest first
+func (s *ClaudeSessionService) ListConversations(sessionID int) ([]*models.ClaudeConversation, error) {
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	conversations, err := s.turnRepo.GetConversations(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversations: %w", err)
+	}
+
+	for _, conversation := range conversations {
+		conversation.IsCurrent = conversation.ClaudeSessionID == session.ClaudeSessionID && conversation.Backend == session.ConversationBackend
+	}
+
+	return conversations, nil
+}
+
+// ResumeConversation makes the session continue a previous Claude conversation on its next turn
+func (s *ClaudeSessionService) ResumeConversation(sessionID int, claudeSessionID string) error {
+	if claudeSessionID == "" {
+		return fmt.Errorf("claude session ID is required")
+	}
+
+	conversations, err := s.turnRepo.GetConversations(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get conversations: %w", err)
+	}
+
+	for _, conversation := range conversations {
+		if conversation.ClaudeSessionID == claudeSessionID {
+			return s.switchConversation(sessionID, claudeSessionID, conversation.Backend)
+		}
+	}
+	return fmt.Errorf("conversation %s not found for session %d", claudeSessionID, sessionID)
+}
+
+// StartNewConversation makes the session start a fresh Claude conversation on its next turn
+func (s *ClaudeSessionService) StartNewConversation(sessionID int) error {
+	if _, err := s.sessionRepo.GetByID(sessionID); err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+
+	return s.switchConversation(sessionID, "", "")
+}
+
+func (s *ClaudeSessionService) switchConversation(sessionID int, claudeSessionID, backend string) error {
+	s.processMutex.Lock()
+	_, running := s.runningProcesses[sessionID]
+	s.processMutex.Unlock()
+	if running {
+		return fmt.Errorf("cannot switch conversation while Claude is running for session %d", sessionID)
+	}
+
+	if err := s.sessionRepo.UpdateClaudeSessionID(sessionID, claudeSessionID, backend); err != nil {
+		return err
+	}
+
+	// A long-lived process is still on the old conversation
+	s.closeSessionAgent(sessionID)
+
+	event := models.NewSessionEvent("session_conversation_changed", sessionID, map[string]interface{}{
+		"claude_session_id": claudeSessionID,
+	})
+	if err := s.eventRepo.Create(event); err != nil {
+		fmt.Printf("Failed to create conversation event: %v\n", err)
+	}
+
+	s.eventBroadcaster.BroadcastEvent("conversation_changed", 0, map[string]interface{}{
+		"session_id":        sessionID,
+		"claude_session_id": claudeSessionID,
+	})
+
+	return nil
+}
+
+// GetTurns returns the most recent turns of a session with their usage
+func (s *ClaudeSessionService) GetTurns(sessionID int, limit int) ([]*models.Turn, error) {
+	if _, err := s.sessionRepo.GetByID(sessionID); err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return s.turnRepo.GetBySessionID(sessionID, limit)
+}
+
+// GetTurn returns a turn together with the chat messages it produced
+func (s *ClaudeSessionService) GetTurn(turnID int) (*models.Turn, []*models.ChatMessage, error) {
+	turn, err := s.turnRepo.GetByID(turnID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	messages, err := s.chatRepo.GetByTurnID(turnID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get turn messages: %w", err)
+	}
+
+	return turn, messages, nil
+}
+
+// GetSessionUsage totals token usage and cost across a session's turns
+func (s *ClaudeSessionService) GetSessionUsage(sessionID int) (*models.UsageSummary, error) {
+	if _, err := s.sessionRepo.GetByID(sessionID); err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return s.turnRepo.GetUsageSummary(sessionID)
+}
+
+// GetProjectUsage totals token usage and cost across all sessions of a project
+func (s *ClaudeSessionService) GetProjectUsage(projectID int) (*models.UsageSummary, error) {
+	if _, err := s.projectRepo.GetByID(projectID); err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	return s.turnRepo.GetProjectUsageSummary(projectID)
+}
+
+// IsRunning reports whether a session has a turn running or waiting for a slot
+func (s *ClaudeSessionService) IsRunning(sessionID int) bool {
+	s.processMutex.Lock()
+	defer s.processMutex.Unlock()
+	_, running := s.runningProcesses[sessionID]
+	return running
+}
+
+// ReleaseSession drops a session's queued prompts and the usage limit it waits out, stops
+// its running turn and waits for it to exit, and closes its long-lived process, e.g.
+// before the session is closed
+func (s *ClaudeSessionService) ReleaseSession(sessionID int) {
+	s.ClearQueue(sessionID)
+	s.processMutex.Lock()
+	_, waiting := s.usageLimits[sessionID]
+	delete(s.usageLimits, sessionID)
+	delete(s.usageLimitRetries, sessionID)
+	s.processMutex.Unlock()
+	s.deleteUsageLimitWait(sessionID)
+	if waiting && !s.IsRunning(sessionID) {
+		if err := s.sessionRepo.UpdateActivityStatus(sessionID, string(models.ActivityStatusIdle)); err != nil {
+			fmt.Printf("Failed to update session activity status: %v\n", err)
+		}
+	}
+	if s.IsRunning(sessionID) {
+		if err := s.StopGeneration(sessionID); err != nil {
+			fmt.Printf("Failed to stop session %d: %v\n", sessionID, err)
+		}
+		// Stopping only signals the run; callers go on to remove its worktree
+		if !s.waitUntilStopped(sessionID, 2*s.stopGracePeriod) {
+			fmt.Printf("Session %d is still running after being stopped\n", sessionID)
+		}
+	}
+	s.closeSessionAgent(sessionID)
+}
+
+// waitUntilStopped waits for a session's run to exit and be cleaned up, and reports
+// whether it did within the timeout
+func (s *ClaudeSessionService) waitUntilStopped(sessionID int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for s.IsRunning(sessionID) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
+
+// GetQueue returns the prompts waiting to run for a session
+func (s *ClaudeSessionService) GetQueue(sessionID int) []*models.QueuedPrompt {
+	return s.promptQueue.List(sessionID)
+}
+
+// ReorderQueue rearranges a session's queued prompts into the given order
+func (s *ClaudeSessionService) ReorderQueue(sessionID int, promptIDs []int) error {
+	if err := s.promptQueue.Reorder(sessionID, promptIDs); err != nil {
+		return err
+	}
+	s.broadcastQueue(sessionID)
+	return nil
+}
+
+// CancelQueuedPrompt removes a prompt from a session's queue before it runs
+func (s *ClaudeSessionService) CancelQueuedPrompt(sessionID, promptID int) error {
+	if err := s.promptQueue.Remove(sessionID, promptID); err != nil {
+		return err
+	}
+	s.forgetUsageLimitPrompt(sessionID, promptID)
+	s.broadcastQueue(sessionID)
+	return nil
+}
+
+// ClearQueue cancels every prompt queued for a session
+func (s *ClaudeSessionService) ClearQueue(sessionID int) int {
+	count := s.promptQueue.Clear(sessionID)
+	if count > 0 {
+		s.forgetUsageLimitPrompt(sessionID, 0)
+		s.broadcastQueue(sessionID)
+	}
+	return count
+}
+
+func (s *ClaudeSessionService) broadcastQueue(sessionID int) {
+	s.eventBroadcaster.BroadcastEvent("prompt_queue_updated", 0, map[string]interface{}{
+		"session_id": sessionID,
+		"queue":      s.promptQueue.List(sessionID),
+	})
+}
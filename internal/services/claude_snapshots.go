@@ -0,0 +1,147 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"habibi-go/internal/models"
+)
+
+// Points of a turn the worktree can be restored to
+const (
+	SnapshotBefore = "before"
+	SnapshotAfter  = "after"
+)
+
+// SetGitService enables worktree snapshots around each turn
+func (s *ClaudeSessionService) SetGitService(gitService *GitService) {
+	s.gitService = gitService
+}
+
+// snapshotsEnabled reports whether turns in a session get worktree snapshots.
+// Snapshots need the worktree on this machine, so SSH projects go without.
+func (s *ClaudeSessionService) snapshotsEnabled(session *models.Session) bool {
+	if s.gitService == nil {
+		return false
+	}
+
+	project, err := s.projectRepo.GetByID(session.ProjectID)
+	if err != nil {
+		fmt.Printf("Failed to get project for snapshot: %v\n", err)
+		return false
+	}
+	return s.sshService == nil || !s.sshService.IsSSHProject(project)
+}
+
+// snapshotTurn records the worktree before or after a turn. Failures are logged;
+// a turn never fails because its snapshot did.
+func (s *ClaudeSessionService) snapshotTurn(session *models.Session, turn *models.Turn, point string) {
+	ref := snapshotRef(session.ID, fmt.Sprintf("turn-%d-%s", turn.ID, point))
+	message := fmt.Sprintf("habibi snapshot %s turn %d", point, turn.ID)
+
+	commit, err := s.gitService.SnapshotWorktree(session.WorktreePath, ref, message)
+	if err != nil {
+		fmt.Printf("Failed to snapshot worktree %s turn %d: %v\n", point, turn.ID, err)
+		return
+	}
+
+	before, after := "", ""
+	if point == SnapshotBefore {
+		turn.SnapshotBefore, before = commit, commit
+	} else {
+		turn.SnapshotAfter, after = commit, commit
+	}
+	if err := s.turnRepo.UpdateSnapshots(turn.ID, before, after); err != nil {
+		fmt.Printf("Failed to update turn snapshots: %v\n", err)
+	}
+}
+
+// GetTurnDiff returns what a turn changed in the worktree
+func (s *ClaudeSessionService) GetTurnDiff(turnID int) ([]DiffFile, error) {
+	turn, err := s.turnRepo.GetByID(turnID)
+	if err != nil {
+		return nil, err
+	}
+	if turn.SnapshotBefore == "" || turn.SnapshotAfter == "" {
+		return nil, fmt.Errorf("turn %d has no worktree snapshots", turnID)
+	}
+	if s.gitService == nil {
+		return nil, fmt.Errorf("worktree snapshots are not available")
+	}
+
+	session, err := s.sessionRepo.GetByID(turn.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	return s.gitService.DiffSnapshots(session.WorktreePath, turn.SnapshotBefore, turn.SnapshotAfter)
+}
+
+// RestoreTurnSnapshot puts a session's worktree back to how it was before or after
+// one of its turns. The worktree is snapshotted first, and that commit is returned so
+// the restore itself can be undone.
+func (s *ClaudeSessionService) RestoreTurnSnapshot(turnID int, point string) (string, error) {
+	turn, err := s.turnRepo.GetByID(turnID)
+	if err != nil {
+		return "", err
+	}
+
+	var target string
+	switch point {
+	case SnapshotBefore:
+		target = turn.SnapshotBefore
+	case SnapshotAfter:
+		target = turn.SnapshotAfter
+	default:
+		return "", fmt.Errorf("invalid snapshot point %q: use %q or %q", point, SnapshotBefore, SnapshotAfter)
+	}
+	if target == "" {
+		return "", fmt.Errorf("turn %d has no snapshot %s it", turnID, point)
+	}
+	if s.gitService == nil {
+		return "", fmt.Errorf("worktree snapshots are not available")
+	}
+
+	sessionID := turn.SessionID
+	s.processMutex.Lock()
+	_, running := s.runningProcesses[sessionID]
+	s.processMutex.Unlock()
+	if running {
+		return "", fmt.Errorf("session %d has a running turn; stop it before restoring", sessionID)
+	}
+
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get session: %w", err)
+	}
+
+	ref := snapshotRef(sessionID, fmt.Sprintf("restore-%d", time.Now().UnixNano()))
+	message := fmt.Sprintf("habibi snapshot before restoring turn %d %s", turnID, point)
+	current, err := s.gitService.SnapshotWorktree(session.WorktreePath, ref, message)
+	if err != nil {
+		return "", fmt.Errorf("failed to snapshot worktree before restoring: %w", err)
+	}
+
+	if err := s.gitService.RestoreSnapshot(session.WorktreePath, current, target); err != nil {
+		return "", err
+	}
+
+	event := models.NewSessionEvent(models.EventTypeWorktreeRestored, sessionID, map[string]interface{}{
+		"turn_id":  turnID,
+		"point":    point,
+		"snapshot": target,
+		"backup":   current,
+	})
+	if err := s.eventRepo.Create(event); err != nil {
+		fmt.Printf("Failed to create worktree restored event: %v\n", err)
+	}
+
+	s.eventBroadcaster.BroadcastEvent("worktree_restored", 0, map[string]interface{}{
+		"session_id": sessionID,
+		"turn_id":    turnID,
+		"point":      point,
+		"backup":     current,
+	})
+
+	return current, nil
+}
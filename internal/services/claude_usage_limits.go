@@ -0,0 +1,218 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"habibi-go/internal/models"
+)
+
+// SetUsageLimitRetryDelay sets how long a session waits before retrying a turn that hit
+// a limit which did not say when it resets
+func (s *ClaudeSessionService) SetUsageLimitRetryDelay(delay time.Duration) {
+	if delay > 0 {
+		s.usageLimitRetryDelay = delay
+	}
+}
+
+// noteUsageLimit remembers a usage limit the agent reported on stderr during a turn.
+// It only counts if the turn then fails.
+func (s *ClaudeSessionService) noteUsageLimit(running *runningTurn, line string) {
+	limit := detectUsageLimit(line, time.Now(), s.usageLimitRetryDelay)
+	if limit == nil {
+		return
+	}
+
+	s.processMutex.Lock()
+	if running.usageLimit == nil || (limit.Exact && !running.usageLimit.Exact) {
+		running.usageLimit = limit
+	}
+	s.processMutex.Unlock()
+}
+
+// turnUsageLimit returns the usage limit a finished turn failed on, from its result or
+// its stderr, and nil if it did not fail or failed for another reason. Once limits that
+// do not say when they reset come maxUsageLimitRetries times in a row, the turn fails.
+func (s *ClaudeSessionService) turnUsageLimit(running *runningTurn, failed bool) *models.UsageLimit {
+	turn := running.turn
+
+	s.processMutex.Lock()
+	var limit *models.UsageLimit
+	if failed || turn.IsError {
+		limit = running.usageLimit
+	}
+	s.processMutex.Unlock()
+
+	if turn.IsError {
+		fromResult := detectUsageLimit(turn.Error, time.Now(), s.usageLimitRetryDelay)
+		if fromResult != nil && (limit == nil || fromResult.Exact || !limit.Exact) {
+			limit = fromResult
+		}
+	}
+
+	s.processMutex.Lock()
+	defer s.processMutex.Unlock()
+	if limit == nil || limit.Exact {
+		delete(s.usageLimitRetries, turn.SessionID)
+	} else {
+		s.usageLimitRetries[turn.SessionID]++
+		if s.usageLimitRetries[turn.SessionID] > maxUsageLimitRetries {
+			delete(s.usageLimitRetries, turn.SessionID)
+			fmt.Printf("Session %d hit %d limits in a row that did not say when they reset; failing the turn\n", turn.SessionID, maxUsageLimitRetries+1)
+			return nil
+		}
+	}
+
+	if limit != nil {
+		limit.SessionID, limit.TurnID = turn.SessionID, turn.ID
+	}
+	return limit
+}
+
+// waitForUsageLimit puts the prompt of a turn that hit a usage limit back at the head of
+// the session's queue, which is held until the limit resets
+func (s *ClaudeSessionService) waitForUsageLimit(running *runningTurn, limit *models.UsageLimit) {
+	turn := running.turn
+	sessionID := turn.SessionID
+
+	if err := s.turnRepo.Complete(turn.ID, models.TurnStatusFailed, fmt.Sprintf("usage limit reached: %s", limit.Message)); err != nil {
+		fmt.Printf("Failed to complete turn record: %v\n", err)
+	}
+
+	s.processMutex.Lock()
+	s.usageLimits[sessionID] = limit
+	s.processMutex.Unlock()
+	queued := s.promptQueue.EnqueueFront(sessionID, turn.Prompt, running.validationIteration)
+	s.processMutex.Lock()
+	limit.PromptID = queued.ID
+	s.processMutex.Unlock()
+	time.AfterFunc(time.Until(limit.ResetAt), s.ResumeHeldQueues)
+
+	// Kept in the database too, so a restarted server still retries the prompt
+	wait := &models.UsageLimitWait{UsageLimit: *limit, Prompt: turn.Prompt, ValidationIteration: running.validationIteration}
+	if err := s.usageLimitRepo.Save(wait); err != nil {
+		fmt.Printf("Failed to save the prompt waiting for the usage limit: %v\n", err)
+	}
+
+	if err := s.sessionRepo.UpdateActivityStatus(sessionID, string(models.ActivityStatusWaitingLimit)); err != nil {
+		fmt.Printf("Failed to update session activity status: %v\n", err)
+	}
+
+	fmt.Printf("Session %d hit a usage limit (%s); retrying at %s\n", sessionID, limit.Message, limit.ResetAt.Format(time.RFC3339))
+	s.addSystemMessage(sessionID, turn.ID, fmt.Sprintf("Usage limit reached: %s. The prompt will be retried automatically at %s.", limit.Message, limit.ResetAt.Format("Jan 2 15:04 MST")))
+
+	s.eventBroadcaster.BroadcastEvent("usage_limit_reached", 0, map[string]interface{}{
+		"session_id": sessionID,
+		"turn_id":    turn.ID,
+		"limit":      limit,
+		"prompt":     queued,
+		"queue":      s.promptQueue.List(sessionID),
+	})
+}
+
+// rearmUsageLimit queues a prompt a previous server kept for retry again and holds it
+// until its usage limit resets
+func (s *ClaudeSessionService) rearmUsageLimit(wait *models.UsageLimitWait) {
+	limit := wait.UsageLimit
+	// A limit that reset while the server was down is retried once the server is up
+	if earliest := time.Now().Add(usageLimitResetMargin); limit.ResetAt.Before(earliest) {
+		limit.ResetAt = earliest
+	}
+
+	queued := s.promptQueue.EnqueueFront(wait.SessionID, wait.Prompt, wait.ValidationIteration)
+	limit.PromptID = queued.ID
+	s.processMutex.Lock()
+	s.usageLimits[wait.SessionID] = &limit
+	s.processMutex.Unlock()
+	time.AfterFunc(time.Until(limit.ResetAt), s.ResumeHeldQueues)
+
+	if err := s.sessionRepo.UpdateActivityStatus(wait.SessionID, string(models.ActivityStatusWaitingLimit)); err != nil {
+		fmt.Printf("Failed to update session activity status: %v\n", err)
+	}
+	fmt.Printf("Session %d waits for a usage limit again; retrying at %s\n", wait.SessionID, limit.ResetAt.Format(time.RFC3339))
+}
+
+// forgetUsageLimitPrompt stops keeping a session's waiting prompt for retry after a
+// restart once it is cancelled; promptID 0 means the whole queue was cleared
+func (s *ClaudeSessionService) forgetUsageLimitPrompt(sessionID, promptID int) {
+	s.processMutex.Lock()
+	limit, waiting := s.usageLimits[sessionID]
+	matches := waiting && (promptID == 0 || limit.PromptID == promptID)
+	s.processMutex.Unlock()
+
+	if matches {
+		s.deleteUsageLimitWait(sessionID)
+	}
+}
+
+// deleteUsageLimitWait forgets the prompt stored for a session's usage limit
+func (s *ClaudeSessionService) deleteUsageLimitWait(sessionID int) {
+	if err := s.usageLimitRepo.Delete(sessionID); err != nil {
+		fmt.Printf("Failed to delete the prompt waiting for the usage limit: %v\n", err)
+	}
+}
+
+// activeUsageLimit returns the usage limit a session is waiting out, or nil
+func (s *ClaudeSessionService) activeUsageLimit(sessionID int) *models.UsageLimit {
+	s.processMutex.Lock()
+	defer s.processMutex.Unlock()
+
+	limit, exists := s.usageLimits[sessionID]
+	if !exists || !time.Now().Before(limit.ResetAt) {
+		return nil
+	}
+	return limit
+}
+
+// GetUsageLimit returns the usage limit a session is waiting out, or nil
+func (s *ClaudeSessionService) GetUsageLimit(sessionID int) *models.UsageLimit {
+	return s.activeUsageLimit(sessionID)
+}
+
+// RetryUsageLimit stops waiting for a session's usage limit to reset and retries its
+// queued prompts now
+func (s *ClaudeSessionService) RetryUsageLimit(sessionID int) error {
+	s.processMutex.Lock()
+	limit, exists := s.usageLimits[sessionID]
+	if exists {
+		retry := *limit
+		retry.ResetAt = time.Now()
+		s.usageLimits[sessionID] = &retry
+	}
+	s.processMutex.Unlock()
+
+	if !exists {
+		return fmt.Errorf("session %d is not waiting for a usage limit", sessionID)
+	}
+	s.ResumeHeldQueues()
+	return nil
+}
+
+// releaseUsageLimits forgets the usage limits that have reset and tells their sessions'
+// viewers. Sessions with nothing left to retry go back to idle.
+func (s *ClaudeSessionService) releaseUsageLimits() {
+	now := time.Now()
+	var released []*models.UsageLimit
+	s.processMutex.Lock()
+	for sessionID, limit := range s.usageLimits {
+		if !now.Before(limit.ResetAt) {
+			delete(s.usageLimits, sessionID)
+			released = append(released, limit)
+		}
+	}
+	s.processMutex.Unlock()
+
+	for _, limit := range released {
+		fmt.Printf("Usage limit of session %d has reset\n", limit.SessionID)
+		s.deleteUsageLimitWait(limit.SessionID)
+		if s.promptQueue.Len(limit.SessionID) == 0 && !s.IsRunning(limit.SessionID) {
+			if err := s.sessionRepo.UpdateActivityStatus(limit.SessionID, string(models.ActivityStatusIdle)); err != nil {
+				fmt.Printf("Failed to update session activity status: %v\n", err)
+			}
+		}
+		s.eventBroadcaster.BroadcastEvent("usage_limit_reset", 0, map[string]interface{}{
+			"session_id": limit.SessionID,
+			"limit":      limit,
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"habibi-go/internal/models"
+)
+
+// maxValidationOutput is how much of a check's output is kept, from the end where errors usually are
+const maxValidationOutput = 16 * 1024
+
+// validateTurn runs the session's checks after a turn the agent finished. When a check
+// fails the output goes back to the agent as the next prompt, up to the configured
+// number of times in a row.
+func (s *ClaudeSessionService) validateTurn(session *models.Session, running *runningTurn) {
+	s.processMutex.Lock()
+	turn, skip := running.turn, running.stopped || running.failReason != ""
+	s.processMutex.Unlock()
+	if skip || turn == nil || turn.ID == 0 {
+		return
+	}
+
+	// Only turns that completed are checked; failed and stopped ones need a person
+	stored, err := s.turnRepo.GetByID(turn.ID)
+	if err != nil || stored.Status != string(models.TurnStatusCompleted) {
+		return
+	}
+
+	project, err := s.projectRepo.GetByID(session.ProjectID)
+	if err != nil {
+		fmt.Printf("Failed to get project for validation: %v\n", err)
+		return
+	}
+	settings, err := models.ResolveValidationSettings(project, session)
+	if err != nil {
+		s.addSystemMessage(session.ID, turn.ID, fmt.Sprintf("Validation skipped: %v", err))
+		return
+	}
+	if settings == nil || len(settings.Checks) == 0 {
+		return
+	}
+	// Checks run in the worktree on this machine
+	if s.sshService != nil && s.sshService.IsSSHProject(project) {
+		return
+	}
+
+	iteration := running.validationIteration
+	s.eventBroadcaster.BroadcastEvent("validation_started", 0, map[string]interface{}{
+		"session_id": session.ID,
+		"turn_id":    turn.ID,
+		"iteration":  iteration,
+		"checks":     settings.Checks,
+	})
+
+	run := &models.ValidationRun{
+		SessionID: session.ID,
+		TurnID:    turn.ID,
+		Iteration: iteration,
+		Passed:    true,
+	}
+	for _, check := range settings.Checks {
+		result := s.runValidationCheck(session.WorktreePath, check)
+		run.Results = append(run.Results, result)
+		if !result.Passed {
+			run.Passed = false
+		}
+	}
+
+	if err := s.validationRepo.Create(run); err != nil {
+		fmt.Printf("Failed to save validation run: %v\n", err)
+	}
+
+	s.eventBroadcaster.BroadcastEvent("validation_completed", 0, map[string]interface{}{
+		"session_id": session.ID,
+		"turn_id":    turn.ID,
+		"iteration":  iteration,
+		"passed":     run.Passed,
+		"results":    run.Results,
+	})
+
+	if run.Passed {
+		s.addSystemMessage(session.ID, turn.ID, fmt.Sprintf("Validation passed: %s", checkNames(run.Results, true)))
+		return
+	}
+
+	failed := checkNames(run.Results, false)
+	if iteration >= settings.Iterations() {
+		s.addSystemMessage(session.ID, turn.ID, fmt.Sprintf(
+			"Validation failed: %s. Stopped after %d fix-up prompts.", failed, iteration))
+		return
+	}
+
+	// A turn stopped while the checks ran gets no fix-up
+	s.processMutex.Lock()
+	stopped := running.stopped
+	s.processMutex.Unlock()
+	if stopped {
+		return
+	}
+
+	s.addSystemMessage(session.ID, turn.ID, fmt.Sprintf(
+		"Validation failed: %s. Sending the output back (%d of %d).", failed, iteration+1, settings.Iterations()))
+	queued := s.promptQueue.EnqueueFront(session.ID, validationPrompt(run.Results), iteration+1)
+	fmt.Printf("Queued validation fix-up prompt %d for session %d\n", queued.ID, session.ID)
+	s.broadcastQueue(session.ID)
+}
+
+// runValidationCheck runs one check in the worktree and collects its output
+func (s *ClaudeSessionService) runValidationCheck(worktreePath string, check models.ValidationCheck) models.ValidationCheckResult {
+	result := models.ValidationCheckResult{
+		Name:    check.DisplayName(),
+		Command: check.Command,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), check.TimeoutDuration())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", check.Command)
+	cmd.Dir = worktreePath
+	// Own process group so a timeout also stops what the check started
+	s.processManager.SetProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return s.processManager.SignalProcessGroup(cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 5 * time.Second
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	started := time.Now()
+	err := cmd.Run()
+	result.DurationMS = int(time.Since(started).Milliseconds())
+	result.Output = tailOutput(output.String())
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		result.Passed = true
+	case ctx.Err() == context.DeadlineExceeded:
+		result.TimedOut = true
+		result.ExitCode = -1
+		result.Output += fmt.Sprintf("\n[timed out after %s]", check.TimeoutDuration())
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		result.ExitCode = -1
+		result.Output += fmt.Sprintf("\n[failed to run: %v]", err)
+	}
+
+	return result
+}
+
+// validationPrompt asks the agent to fix the checks that failed
+func validationPrompt(results []models.ValidationCheckResult) string {
+	var prompt strings.Builder
+	prompt.WriteString("The project's checks failed after your changes. Fix the problems so that they pass.\n")
+
+	for _, result := range results {
+		if result.Passed {
+			continue
+		}
+		status := fmt.Sprintf("exit code %d", result.ExitCode)
+		if result.TimedOut {
+			status = "timed out"
+		}
+		fmt.Fprintf(&prompt, "\n### %s (`%s`, %s)\n```\n%s\n```\n", result.Name, result.Command, status, strings.TrimSpace(result.Output))
+	}
+
+	return prompt.String()
+}
+
+// checkNames lists the checks that passed or failed
+func checkNames(results []models.ValidationCheckResult, passed bool) string {
+	var names []string
+	for _, result := range results {
+		if result.Passed == passed {
+			names = append(names, result.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// tailOutput keeps the end of long output
+func tailOutput(output string) string {
+	if len(output) <= maxValidationOutput {
+		return output
+	}
+	return "[... output truncated ...]\n" + output[len(output)-maxValidationOutput:]
+}
+
+// GetTurnValidation returns the validation runs of a turn
+func (s *ClaudeSessionService) GetTurnValidation(turnID int) ([]*models.ValidationRun, error) {
+	return s.validationRepo.GetByTurnID(turnID)
+}
+
+// GetSessionValidation returns a session's most recent validation runs, oldest first
+func (s *ClaudeSessionService) GetSessionValidation(sessionID int, limit int) ([]*models.ValidationRun, error) {
+	return s.validationRepo.GetBySessionID(sessionID, limit)
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"habibi-go/internal/models"
+)
+
+// SetTimeouts sets the wall-clock and no-output limits for a turn; zero disables a limit
+func (s *ClaudeSessionService) SetTimeouts(turnTimeout, noOutputTimeout time.Duration) {
+	s.processMutex.Lock()
+	defer s.processMutex.Unlock()
+
+	s.turnTimeout = turnTimeout
+	s.noOutputTimeout = noOutputTimeout
+}
+
+// StartWatchdog checks running turns every interval, killing hung ones and reporting healthy ones
+func (s *ClaudeSessionService) StartWatchdog(interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	s.processMutex.Lock()
+	if s.watchdogStop != nil {
+		s.processMutex.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	s.watchdogStop = stop
+	s.processMutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.checkRunningTurns()
+				s.ResumeHeldQueues()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopWatchdog stops the watchdog started by StartWatchdog
+func (s *ClaudeSessionService) StopWatchdog() {
+	s.processMutex.Lock()
+	defer s.processMutex.Unlock()
+
+	if s.watchdogStop != nil {
+		close(s.watchdogStop)
+		s.watchdogStop = nil
+	}
+}
+
+// hungTurn is a run the watchdog decided to kill
+type hungTurn struct {
+	sessionID int
+	running   *runningTurn
+	reason    string
+}
+
+func (s *ClaudeSessionService) checkRunningTurns() {
+	now := time.Now()
+	var hung []hungTurn
+	var heartbeats []map[string]interface{}
+
+	s.processMutex.Lock()
+	for sessionID, running := range s.runningProcesses {
+		// Runs waiting for a slot or already being stopped are not timed
+		if running.proc == nil || running.stopped || running.failReason != "" {
+			continue
+		}
+
+		elapsed := now.Sub(running.startedAt)
+		silent := now.Sub(time.Unix(0, running.lastOutputAt.Load()))
+
+		reason := ""
+		if s.turnTimeout > 0 && elapsed > s.turnTimeout {
+			reason = fmt.Sprintf("turn exceeded the %s time limit", s.turnTimeout)
+		} else if s.noOutputTimeout > 0 && silent > s.noOutputTimeout {
+			reason = fmt.Sprintf("no output from the agent for %s", silent.Round(time.Second))
+		}
+
+		if reason != "" {
+			running.failReason = reason
+			hung = append(hung, hungTurn{sessionID: sessionID, running: running, reason: reason})
+			continue
+		}
+
+		heartbeats = append(heartbeats, map[string]interface{}{
+			"session_id":     sessionID,
+			"turn_id":        running.turn.ID,
+			"elapsed_ms":     elapsed.Milliseconds(),
+			"last_output_ms": silent.Milliseconds(),
+		})
+	}
+	s.processMutex.Unlock()
+
+	for _, heartbeat := range heartbeats {
+		s.eventBroadcaster.BroadcastEvent(string(models.EventTypeAgentHeartbeat), 0, heartbeat)
+	}
+
+	for _, h := range hung {
+		s.killHungTurn(h)
+	}
+}
+
+// killHungTurn kills a run that exceeded its limits and records why
+func (s *ClaudeSessionService) killHungTurn(h hungTurn) {
+	turn := h.running.turn
+	fmt.Printf("Watchdog killing agent for session %d: %s\n", h.sessionID, h.reason)
+
+	if err := h.running.proc.Kill(); err != nil {
+		fmt.Printf("Failed to kill hung agent process: %v\n", err)
+	}
+
+	if err := s.turnRepo.Complete(turn.ID, models.TurnStatusFailed, h.reason); err != nil {
+		fmt.Printf("Failed to complete turn record: %v\n", err)
+	}
+
+	s.addSystemMessage(h.sessionID, turn.ID, fmt.Sprintf("Turn interrupted: %s.", h.reason))
+
+	if err := s.sessionRepo.UpdateActivityStatus(h.sessionID, string(models.ActivityStatusIdle)); err != nil {
+		fmt.Printf("Failed to update session activity status: %v\n", err)
+	}
+
+	event := models.NewSessionEvent(models.EventTypeAgentFailed, h.sessionID, map[string]interface{}{
+		"turn_id": turn.ID,
+		"reason":  h.reason,
+	})
+	if err := s.eventRepo.Create(event); err != nil {
+		fmt.Printf("Failed to create agent failed event: %v\n", err)
+	}
+
+	s.eventBroadcaster.BroadcastEvent(string(models.EventTypeAgentFailed), 0, map[string]interface{}{
+		"session_id": h.sessionID,
+		"turn_id":    turn.ID,
+		"reason":     h.reason,
+	})
+}
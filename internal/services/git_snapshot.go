@@ -0,0 +1,223 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// snapshotRefPrefix keeps snapshot commits reachable without putting them on any branch
+const snapshotRefPrefix = "refs/habibi/snapshots"
+
+// snapshotRef names the ref a session's snapshot is kept under
+func snapshotRef(sessionID int, name string) string {
+	return fmt.Sprintf("%s/session-%d/%s", snapshotRefPrefix, sessionID, name)
+}
+
+// SnapshotWorktree records the worktree, tracked and untracked files alike, as a commit
+// kept under ref. Neither the branch, HEAD nor the index of the worktree is touched;
+// ignored files are left out.
+func (s *GitService) SnapshotWorktree(worktreePath, ref, message string) (string, error) {
+	index, cleanup, err := tempIndex()
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	head, headErr := runGit(worktreePath, nil, "rev-parse", "--verify", "-q", "HEAD")
+
+	// A copy of the worktree's index carries the file stats that let git skip hashing
+	// unchanged files; without one, start from HEAD
+	if !copyWorktreeIndex(worktreePath, index) && headErr == nil {
+		if _, err := runGit(worktreePath, index, "read-tree", "HEAD"); err != nil {
+			return "", fmt.Errorf("failed to read HEAD into snapshot index: %w", err)
+		}
+	}
+	if _, err := runGit(worktreePath, index, "add", "-A"); err != nil {
+		return "", fmt.Errorf("failed to add worktree to snapshot index: %w", err)
+	}
+	tree, err := runGit(worktreePath, index, "write-tree")
+	if err != nil {
+		return "", fmt.Errorf("failed to write snapshot tree: %w", err)
+	}
+
+	args := []string{"commit-tree", tree, "-m", message}
+	if headErr == nil {
+		args = append(args, "-p", head)
+	}
+	commit, err := runGit(worktreePath, snapshotIdentity(), args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to commit snapshot: %w", err)
+	}
+
+	if _, err := runGit(worktreePath, nil, "update-ref", ref, commit); err != nil {
+		return "", fmt.Errorf("failed to keep snapshot ref: %w", err)
+	}
+	return commit, nil
+}
+
+// DiffSnapshots lists the files that differ between two snapshots, with their diffs
+func (s *GitService) DiffSnapshots(worktreePath, from, to string) ([]DiffFile, error) {
+	output, err := runGit(worktreePath, nil, "diff", "--no-renames", "--name-status", "-z", from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot diff: %w", err)
+	}
+
+	// -z output alternates status and path, so paths need no unquoting
+	fields := strings.Split(strings.TrimRight(output, "\x00"), "\x00")
+	diffFiles := []DiffFile{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		status, path := fields[i], fields[i+1]
+		if status == "" {
+			continue
+		}
+
+		var fileStatus string
+		switch status[0] {
+		case 'A':
+			fileStatus = "added"
+		case 'D':
+			fileStatus = "deleted"
+		default:
+			fileStatus = "modified"
+		}
+
+		var additions, deletions int
+		if numstat, err := runGit(worktreePath, nil, "diff", "--numstat", from, to, "--", path); err == nil {
+			if fields := strings.Fields(numstat); len(fields) >= 3 {
+				additions, _ = strconv.Atoi(fields[0])
+				deletions, _ = strconv.Atoi(fields[1])
+			}
+		}
+
+		// Same limits as the worktree diff to keep the browser responsive
+		const maxDiffSize = 1024 * 1024
+		const maxDiffLines = 5000
+
+		var fileDiff string
+		var isTruncated bool
+		if additions+deletions > maxDiffLines {
+			fileDiff = fmt.Sprintf("Diff too large to display (%d additions, %d deletions)\n", additions, deletions)
+			isTruncated = true
+		} else {
+			fileDiff, _ = runGit(worktreePath, nil, "diff", from, to, "--", path)
+			if len(fileDiff) > maxDiffSize {
+				fileDiff = fileDiff[:maxDiffSize] + "\n\n... Diff truncated (file too large) ...\n"
+				isTruncated = true
+			}
+		}
+
+		diffFiles = append(diffFiles, DiffFile{
+			Path:        path,
+			Status:      fileStatus,
+			Diff:        fileDiff,
+			Additions:   additions,
+			Deletions:   deletions,
+			IsTruncated: isTruncated,
+		})
+	}
+
+	return diffFiles, nil
+}
+
+// RestoreSnapshot makes the worktree match the target snapshot. current must be a
+// snapshot of the worktree as it is now; files it has that the target lacks are
+// removed. HEAD, the branch and the index stay as they are.
+func (s *GitService) RestoreSnapshot(worktreePath, current, target string) error {
+	index, cleanup, err := tempIndex()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if _, err := runGit(worktreePath, index, "read-tree", current); err != nil {
+		return fmt.Errorf("failed to read current snapshot: %w", err)
+	}
+	// Fill in file stats so git sees the worktree matches the current snapshot
+	if _, err := runGit(worktreePath, index, "update-index", "-q", "--refresh"); err != nil {
+		return fmt.Errorf("worktree changed since the current snapshot: %w", err)
+	}
+	// A two-tree merge moves the files from one snapshot to the other, like a checkout
+	if _, err := runGit(worktreePath, index, "read-tree", "-m", "-u", current, target); err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	return nil
+}
+
+// DeleteSnapshots removes the snapshot refs of a session so git can collect the commits
+func (s *GitService) DeleteSnapshots(repoPath string, sessionID int) error {
+	refs, err := runGit(repoPath, nil, "for-each-ref", "--format=%(refname)", snapshotRef(sessionID, ""))
+	if err != nil {
+		return fmt.Errorf("failed to list snapshot refs: %w", err)
+	}
+
+	for _, ref := range strings.Fields(refs) {
+		if _, err := runGit(repoPath, nil, "update-ref", "-d", ref); err != nil {
+			return fmt.Errorf("failed to delete snapshot ref %s: %w", ref, err)
+		}
+	}
+	return nil
+}
+
+// runGit runs git in dir with extra environment variables and returns its trimmed output
+func runGit(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// tempIndex creates a scratch index file so snapshots never touch the worktree's own index
+func tempIndex() ([]string, func(), error) {
+	file, err := os.CreateTemp("", "habibi-snapshot-index-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create snapshot index: %w", err)
+	}
+	path := file.Name()
+	file.Close()
+	// git refuses an empty file as an index, so start from none
+	os.Remove(path)
+
+	return []string{"GIT_INDEX_FILE=" + path}, func() { os.Remove(path) }, nil
+}
+
+// copyWorktreeIndex copies the worktree's own index into a scratch index and reports
+// whether there was one to copy
+func copyWorktreeIndex(worktreePath string, index []string) bool {
+	source, err := runGit(worktreePath, nil, "rev-parse", "--git-path", "index")
+	if err != nil {
+		return false
+	}
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(worktreePath, source)
+	}
+
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return false
+	}
+	return os.WriteFile(strings.TrimPrefix(index[0], "GIT_INDEX_FILE="), data, 0600) == nil
+}
+
+// snapshotIdentity lets commit-tree work in repositories without a configured user
+func snapshotIdentity() []string {
+	return []string{
+		"GIT_AUTHOR_NAME=habibi-go",
+		"GIT_AUTHOR_EMAIL=habibi-go@localhost",
+		"GIT_COMMITTER_NAME=habibi-go",
+		"GIT_COMMITTER_EMAIL=habibi-go@localhost",
+	}
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"habibi-go/internal/database/repositories"
+	"habibi-go/internal/models"
+)
+
+// remoteMCPConfigDir holds the MCP config files written on SSH hosts, relative to the
+// SSH user's home directory
+const remoteMCPConfigDir = ".habibi/mcp"
+
+// MCPServerService keeps each project's registry of MCP servers and writes the MCP
+// config file a session's agent loads when it starts
+type MCPServerService struct {
+	mcpRepo     *repositories.MCPServerRepository
+	projectRepo *repositories.ProjectRepository
+	sessionRepo *repositories.SessionRepository
+	sshService  *SSHService
+	configDir   string
+}
+
+// NewMCPServerService creates an MCP server service. Config files for local sessions
+// are written to configDir, by default ~/.habibi/mcp.
+func NewMCPServerService(
+	mcpRepo *repositories.MCPServerRepository,
+	projectRepo *repositories.ProjectRepository,
+	sessionRepo *repositories.SessionRepository,
+	sshService *SSHService,
+	configDir string,
+) *MCPServerService {
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = os.TempDir()
+		}
+		configDir = filepath.Join(home, ".habibi", "mcp")
+	}
+
+	return &MCPServerService{
+		mcpRepo:     mcpRepo,
+		projectRepo: projectRepo,
+		sessionRepo: sessionRepo,
+		sshService:  sshService,
+		configDir:   configDir,
+	}
+}
+
+// CreateServer adds an MCP server to a project's registry
+func (s *MCPServerService) CreateServer(projectID int, req *models.MCPServerRequest) (*models.MCPServer, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	project, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+
+	server := &models.MCPServer{ProjectID: project.ID}
+	req.Apply(server)
+	if err := s.checkCommand(project, server); err != nil {
+		return nil, err
+	}
+
+	if err := s.mcpRepo.Create(server); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// GetProjectServers lists a project's MCP servers
+func (s *MCPServerService) GetProjectServers(projectID int) ([]*models.MCPServer, error) {
+	if _, err := s.projectRepo.GetByID(projectID); err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	return s.mcpRepo.GetByProject(projectID)
+}
+
+// GetServer returns one MCP server definition
+func (s *MCPServerService) GetServer(id int) (*models.MCPServer, error) {
+	return s.mcpRepo.GetByID(id)
+}
+
+// UpdateServer replaces an MCP server definition
+func (s *MCPServerService) UpdateServer(id int, req *models.MCPServerRequest) (*models.MCPServer, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	server, err := s.mcpRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	project, err := s.projectRepo.GetByID(server.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+
+	req.Apply(server)
+	if err := s.checkCommand(project, server); err != nil {
+		return nil, err
+	}
+
+	if err := s.mcpRepo.Update(server); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// DeleteServer removes an MCP server from its project's registry
+func (s *MCPServerService) DeleteServer(id int) error {
+	if _, err := s.mcpRepo.GetByID(id); err != nil {
+		return err
+	}
+	return s.mcpRepo.Delete(id)
+}
+
+// GetSessionServers lists the MCP servers of a session's project and whether the
+// session loads each
+func (s *MCPServerService) GetSessionServers(sessionID int) ([]*models.SessionMCPServer, error) {
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	servers, err := s.mcpRepo.GetByProject(session.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides, err := s.mcpRepo.GetSessionOverrides(session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*models.SessionMCPServer, 0, len(servers))
+	for _, server := range servers {
+		entry := &models.SessionMCPServer{Server: server, Enabled: server.Enabled}
+		if enabled, exists := overrides[server.ID]; exists {
+			entry.Enabled = enabled
+			entry.Override = &enabled
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// SetSessionServer turns a server on or off for one session. A nil enabled returns the
+// session to the project's default.
+func (s *MCPServerService) SetSessionServer(sessionID, serverID int, enabled *bool) ([]*models.SessionMCPServer, error) {
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	server, err := s.mcpRepo.GetByID(serverID)
+	if err != nil {
+		return nil, err
+	}
+	if server.ProjectID != session.ProjectID {
+		return nil, fmt.Errorf("MCP server %d does not belong to the session's project", serverID)
+	}
+
+	if enabled == nil {
+		err = s.mcpRepo.DeleteSessionOverride(session.ID, server.ID)
+	} else {
+		err = s.mcpRepo.SetSessionOverride(session.ID, server.ID, *enabled)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetSessionServers(session.ID)
+}
+
+// SessionConfig returns the MCP config JSON for the servers a session loads, or nil
+// if it loads none
+func (s *MCPServerService) SessionConfig(session *models.Session) ([]byte, error) {
+	servers, err := s.GetSessionServers(session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]interface{})
+	for _, entry := range servers {
+		if entry.Enabled {
+			entries[entry.Server.Name] = entry.Server.ClaudeConfig()
+		}
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.MarshalIndent(map[string]interface{}{"mcpServers": entries}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal MCP config: %w", err)
+	}
+	return data, nil
+}
+
+// WriteConfig writes a session's MCP config where its agent runs and returns the
+// file's path: under configDir locally, or on the project's SSH host
+func (s *MCPServerService) WriteConfig(project *models.Project, session *models.Session, config []byte, remote bool) (string, error) {
+	name := fmt.Sprintf("session-%d.json", session.ID)
+
+	if remote {
+		path, err := s.sshService.WriteHomeFile(project, remoteMCPConfigDir+"/"+name, config)
+		if err != nil {
+			return "", fmt.Errorf("failed to write MCP config: %w", err)
+		}
+		return path, nil
+	}
+
+	// The config may hold tokens in env and headers. Chmod fails on a directory someone
+	// else created, and tightens one left over with wider permissions.
+	if err := os.MkdirAll(s.configDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create MCP config directory: %w", err)
+	}
+	if err := os.Chmod(s.configDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to secure MCP config directory: %w", err)
+	}
+	path := filepath.Join(s.configDir, name)
+	if err := os.WriteFile(path, config, 0600); err != nil {
+		return "", fmt.Errorf("failed to write MCP config: %w", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		return "", fmt.Errorf("failed to secure MCP config: %w", err)
+	}
+	return path, nil
+}
+
+// checkCommand makes sure a stdio server's command exists where the project's agents
+// run. Relative paths are resolved against the project directory.
+func (s *MCPServerService) checkCommand(project *models.Project, server *models.MCPServer) error {
+	if server.Type != models.MCPServerTypeStdio {
+		return nil
+	}
+
+	if s.sshService != nil && s.sshService.IsSSHProject(project) {
+		return s.sshService.LookPath(project, server.Command)
+	}
+
+	command := server.Command
+	if strings.Contains(command, "/") && !filepath.IsAbs(command) {
+		command = filepath.Join(project.Path, command)
+	}
+	if _, err := exec.LookPath(command); err != nil {
+		return fmt.Errorf("command %q not found: %w", server.Command, err)
+	}
+	return nil
+}
@@ -0,0 +1,423 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"habibi-go/internal/database/repositories"
+	"habibi-go/internal/models"
+)
+
+// PermissionDecision is a human's answer to a tool permission request
+type PermissionDecision string
+
+const (
+	PermissionAllow       PermissionDecision = "allow"
+	PermissionDeny        PermissionDecision = "deny"
+	PermissionAlwaysAllow PermissionDecision = "always_allow"
+)
+
+// Names Claude uses to reach the permission prompt tool
+const (
+	permissionMCPServerName = "habibi"
+	PermissionMCPToolName   = "approval_prompt"
+)
+
+// PermissionPromptTool is the --permission-prompt-tool value for habibi's MCP tool
+const PermissionPromptTool = "mcp__" + permissionMCPServerName + "__" + PermissionMCPToolName
+
+// PermissionRequest is a tool call waiting for a human to approve or deny it
+type PermissionRequest struct {
+	ID          string      `json:"id"`
+	SessionID   int         `json:"session_id"`
+	TurnID      int         `json:"turn_id"`
+	ToolName    string      `json:"tool_name"`
+	ToolUseID   string      `json:"tool_use_id,omitempty"`
+	Input       interface{} `json:"input"`
+	RequestedAt time.Time   `json:"requested_at"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+
+	token    string
+	response chan permissionResponse
+}
+
+// PermissionResult is what the permission prompt tool returns to Claude
+type PermissionResult struct {
+	Behavior     string      `json:"behavior"`
+	UpdatedInput interface{} `json:"updatedInput,omitempty"`
+	Message      string      `json:"message,omitempty"`
+}
+
+type permissionResponse struct {
+	decision  PermissionDecision
+	message   string
+	decidedBy string
+}
+
+// permissionRun is the turn a permission prompt token was issued for
+type permissionRun struct {
+	sessionID int
+	turnID    int
+}
+
+// PermissionService routes tool permission prompts from running agents to
+// WebSocket viewers and waits for their decision
+type PermissionService struct {
+	sessionRepo      *repositories.SessionRepository
+	projectRepo      *repositories.ProjectRepository
+	eventRepo        *repositories.EventRepository
+	eventBroadcaster EventBroadcaster
+	baseURL          string
+	// Whether baseURL is reachable from agents on SSH hosts, not just this machine
+	remoteReachable bool
+	timeout         time.Duration
+	defaultDecision PermissionDecision
+
+	mutex         sync.Mutex
+	runs          map[string]permissionRun
+	pending       map[string]*PermissionRequest
+	alwaysAllowed map[int]map[string]bool
+}
+
+// NewPermissionService creates a permission service. baseURL is where agents reach
+// habibi's API; unanswered requests get defaultDecision after the timeout.
+func NewPermissionService(
+	sessionRepo *repositories.SessionRepository,
+	projectRepo *repositories.ProjectRepository,
+	eventRepo *repositories.EventRepository,
+	baseURL string,
+	timeout time.Duration,
+	defaultDecision PermissionDecision,
+) *PermissionService {
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	if defaultDecision == "" {
+		defaultDecision = PermissionDeny
+	}
+
+	return &PermissionService{
+		sessionRepo:      sessionRepo,
+		projectRepo:      projectRepo,
+		eventRepo:        eventRepo,
+		eventBroadcaster: &NoOpBroadcaster{},
+		baseURL:          baseURL,
+		timeout:          timeout,
+		defaultDecision:  defaultDecision,
+		runs:             make(map[string]permissionRun),
+		pending:          make(map[string]*PermissionRequest),
+		alwaysAllowed:    make(map[int]map[string]bool),
+	}
+}
+
+// SetEventBroadcaster sets the event broadcaster
+func (s *PermissionService) SetEventBroadcaster(broadcaster EventBroadcaster) {
+	s.eventBroadcaster = broadcaster
+}
+
+// SetRemoteReachable records whether agents on SSH hosts can reach the base URL. The
+// default loopback URL only works for agents running next to the server.
+func (s *PermissionService) SetRemoteReachable(reachable bool) {
+	s.remoteReachable = reachable
+}
+
+// RemoteReachable reports whether agents on SSH hosts can use the permission prompt tool
+func (s *PermissionService) RemoteReachable() bool {
+	return s.remoteReachable
+}
+
+// Timeout returns how long a request waits for a decision
+func (s *PermissionService) Timeout() time.Duration {
+	return s.timeout
+}
+
+// IsValidPermissionDecision reports whether a decision string is known
+func IsValidPermissionDecision(decision PermissionDecision) bool {
+	switch decision {
+	case PermissionAllow, PermissionDeny, PermissionAlwaysAllow:
+		return true
+	default:
+		return false
+	}
+}
+
+// RegisterRun issues the token a turn's agent uses to reach the permission prompt tool
+func (s *PermissionService) RegisterRun(sessionID, turnID int) (string, error) {
+	token, err := randomHex(16)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate permission token: %w", err)
+	}
+
+	s.mutex.Lock()
+	s.runs[token] = permissionRun{sessionID: sessionID, turnID: turnID}
+	s.mutex.Unlock()
+
+	return token, nil
+}
+
+// SetRunTurn moves a token to another turn, for agent processes that serve several turns
+func (s *PermissionService) SetRunTurn(token string, turnID int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if run, exists := s.runs[token]; exists {
+		run.turnID = turnID
+		s.runs[token] = run
+	}
+}
+
+// UnregisterRun revokes a run's token and denies anything it still has pending
+func (s *PermissionService) UnregisterRun(token string) {
+	s.mutex.Lock()
+	delete(s.runs, token)
+	var orphaned []*PermissionRequest
+	for _, req := range s.pending {
+		if req.token == token {
+			orphaned = append(orphaned, req)
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, req := range orphaned {
+		s.resolve(req, permissionResponse{decision: PermissionDeny, message: "Turn ended before a decision was made", decidedBy: "turn_ended"})
+	}
+}
+
+// MCPConfig returns the --mcp-config JSON pointing Claude at the permission prompt tool.
+// The run's token authenticates it, so it holds no server credentials.
+func (s *PermissionService) MCPConfig(token string) (string, error) {
+	server := map[string]interface{}{
+		"type":    "http",
+		"url":     s.baseURL + "/api/mcp/permissions",
+		"headers": map[string]string{"Authorization": "Bearer " + token},
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"mcpServers": map[string]interface{}{permissionMCPServerName: server},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal MCP config: %w", err)
+	}
+	return string(data), nil
+}
+
+// ValidToken reports whether a token belongs to a running turn
+func (s *PermissionService) ValidToken(token string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, exists := s.runs[token]
+	return exists
+}
+
+// RequestApproval asks the session's viewers whether a tool call may run and
+// blocks until they answer, the timeout passes or ctx is cancelled
+func (s *PermissionService) RequestApproval(ctx context.Context, token, toolName string, input interface{}, toolUseID string) (*PermissionResult, error) {
+	s.mutex.Lock()
+	run, exists := s.runs[token]
+	if !exists {
+		s.mutex.Unlock()
+		return nil, fmt.Errorf("unknown permission token")
+	}
+	alwaysAllowed := s.alwaysAllowed[run.sessionID][toolName]
+	s.mutex.Unlock()
+
+	if alwaysAllowed {
+		return &PermissionResult{Behavior: "allow", UpdatedInput: input}, nil
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate permission request ID: %w", err)
+	}
+	now := time.Now()
+	req := &PermissionRequest{
+		ID:          id,
+		SessionID:   run.sessionID,
+		TurnID:      run.turnID,
+		ToolName:    toolName,
+		ToolUseID:   toolUseID,
+		Input:       input,
+		RequestedAt: now,
+		ExpiresAt:   now.Add(s.timeout),
+		token:       token,
+		response:    make(chan permissionResponse, 1),
+	}
+
+	s.mutex.Lock()
+	s.pending[req.ID] = req
+	s.mutex.Unlock()
+
+	fmt.Printf("Waiting for permission to run %s in session %d (request %s)\n", toolName, run.sessionID, req.ID)
+	s.eventBroadcaster.BroadcastEvent("permission_request", 0, map[string]interface{}{
+		"session_id": run.sessionID,
+		"request":    req,
+	})
+
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	// Exactly one resolve wins and delivers its response, even if a decision races the timeout
+	var resp permissionResponse
+	select {
+	case resp = <-req.response:
+	case <-timer.C:
+		s.resolve(req, permissionResponse{decision: s.defaultDecision, message: "No decision before the timeout", decidedBy: "timeout"})
+		resp = <-req.response
+	case <-ctx.Done():
+		s.resolve(req, permissionResponse{decision: PermissionDeny, message: "Agent stopped waiting for a decision", decidedBy: "cancelled"})
+		resp = <-req.response
+	}
+
+	if resp.decision == PermissionDeny {
+		message := "Denied by user"
+		if resp.message != "" {
+			message = resp.message
+		}
+		return &PermissionResult{Behavior: "deny", Message: message}, nil
+	}
+	return &PermissionResult{Behavior: "allow", UpdatedInput: input}, nil
+}
+
+// Respond records a viewer's decision on a pending request
+func (s *PermissionService) Respond(sessionID int, requestID string, decision PermissionDecision, message string) error {
+	if !IsValidPermissionDecision(decision) {
+		return fmt.Errorf("invalid permission decision: %s", decision)
+	}
+
+	s.mutex.Lock()
+	req, exists := s.pending[requestID]
+	s.mutex.Unlock()
+	if !exists || req.SessionID != sessionID {
+		return fmt.Errorf("permission request %s not found for session %d", requestID, sessionID)
+	}
+
+	if !s.resolve(req, permissionResponse{decision: decision, message: message, decidedBy: "user"}) {
+		return fmt.Errorf("permission request %s was already decided", requestID)
+	}
+	return nil
+}
+
+// Pending lists the requests waiting for a decision in a session, oldest first
+func (s *PermissionService) Pending(sessionID int) []*PermissionRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	requests := make([]*PermissionRequest, 0)
+	for _, req := range s.pending {
+		if req.SessionID == sessionID {
+			requests = append(requests, req)
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].RequestedAt.Before(requests[j].RequestedAt)
+	})
+	return requests
+}
+
+// resolve settles a pending request once; it reports false if it was already settled
+func (s *PermissionService) resolve(req *PermissionRequest, resp permissionResponse) bool {
+	s.mutex.Lock()
+	if _, exists := s.pending[req.ID]; !exists {
+		s.mutex.Unlock()
+		return false
+	}
+	delete(s.pending, req.ID)
+	if resp.decision == PermissionAlwaysAllow {
+		if s.alwaysAllowed[req.SessionID] == nil {
+			s.alwaysAllowed[req.SessionID] = make(map[string]bool)
+		}
+		s.alwaysAllowed[req.SessionID][req.ToolName] = true
+	}
+	s.mutex.Unlock()
+
+	req.response <- resp
+
+	if resp.decision == PermissionAlwaysAllow {
+		s.persistAlwaysAllow(req.SessionID, req.ToolName)
+	}
+
+	fmt.Printf("Permission request %s for %s in session %d: %s (%s)\n", req.ID, req.ToolName, req.SessionID, resp.decision, resp.decidedBy)
+
+	event := models.NewSessionEvent(models.EventTypePermissionDecision, req.SessionID, map[string]interface{}{
+		"request_id":  req.ID,
+		"turn_id":     req.TurnID,
+		"tool_name":   req.ToolName,
+		"tool_use_id": req.ToolUseID,
+		"input":       req.Input,
+		"decision":    string(resp.decision),
+		"decided_by":  resp.decidedBy,
+		"message":     resp.message,
+	})
+	if err := s.eventRepo.Create(event); err != nil {
+		fmt.Printf("Failed to create permission decision event: %v\n", err)
+	}
+
+	s.eventBroadcaster.BroadcastEvent("permission_resolved", 0, map[string]interface{}{
+		"session_id": req.SessionID,
+		"request_id": req.ID,
+		"tool_name":  req.ToolName,
+		"decision":   string(resp.decision),
+		"decided_by": resp.decidedBy,
+	})
+	return true
+}
+
+// persistAlwaysAllow adds a tool to the session's allowed tools so later turns skip the prompt
+func (s *PermissionService) persistAlwaysAllow(sessionID int, toolName string) {
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil {
+		fmt.Printf("Failed to get session for always-allow: %v\n", err)
+		return
+	}
+
+	settings, err := models.ParseAgentSettings(session.Config)
+	if err != nil {
+		fmt.Printf("Failed to read agent settings for always-allow: %v\n", err)
+		return
+	}
+	// Session lists replace project lists, so start from the project's list unless the
+	// session cleared it
+	cleared := false
+	for i, field := range settings.Clear {
+		if field == "allowed_tools" {
+			settings.Clear = append(settings.Clear[:i:i], settings.Clear[i+1:]...)
+			cleared = true
+			break
+		}
+	}
+	if settings.AllowedTools == nil && !cleared {
+		if project, err := s.projectRepo.GetByID(session.ProjectID); err == nil {
+			if projectSettings, err := models.ParseAgentSettings(project.Config); err == nil {
+				settings.AllowedTools = append([]string{}, projectSettings.AllowedTools...)
+			}
+		}
+	}
+	for _, tool := range settings.AllowedTools {
+		if tool == toolName {
+			return
+		}
+	}
+	settings.AllowedTools = append(settings.AllowedTools, toolName)
+
+	if session.Config == nil {
+		session.Config = make(map[string]interface{})
+	}
+	session.Config[models.AgentSettingsConfigKey] = settings
+	if err := s.sessionRepo.Update(session); err != nil {
+		fmt.Printf("Failed to save always-allowed tool: %v\n", err)
+	}
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -14,6 +14,8 @@ type ProjectService struct {
 	projectRepo *repositories.ProjectRepository
 	eventRepo   *repositories.EventRepository
 	gitService  *GitService
+	
+	agentBackends []string
 }
 
 func NewProjectService(projectRepo *repositories.ProjectRepository, eventRepo *repositories.EventRepository, gitService *GitService) *ProjectService {
@@ -24,6 +26,11 @@ func NewProjectService(projectRepo *repositories.ProjectRepository, eventRepo *r
 	}
 }
 
+// SetAgentBackends sets the agent backends a project config may pick
+func (s *ProjectService) SetAgentBackends(backends []string) {
+	s.agentBackends = backends
+}
+
 func (s *ProjectService) CreateProject(req *models.CreateProjectRequest) (*models.Project, error) {
 	// Validate request
 	if req.Name == "" {
@@ -193,6 +200,9 @@ func (s *ProjectService) UpdateProject(id int, req *models.UpdateProjectRequest)
 	if err := project.Validate(); err != nil {
 		return nil, fmt.Errorf("project validation failed: %w", err)
 	}
+	if err := validateAgentBackend(project.Config, s.agentBackends); err != nil {
+		return nil, fmt.Errorf("project validation failed: %w", err)
+	}
 	
 	if err := s.projectRepo.Update(project); err != nil {
 		return nil, fmt.Errorf("failed to update project: %w", err)
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"habibi-go/internal/models"
+)
+
+// PromptQueue holds the prompts waiting to run for each session, in FIFO order
+type PromptQueue struct {
+	queues map[int][]*models.QueuedPrompt
+	nextID int
+	mutex  sync.Mutex
+}
+
+// NewPromptQueue creates an empty prompt queue
+func NewPromptQueue() *PromptQueue {
+	return &PromptQueue{
+		queues: make(map[int][]*models.QueuedPrompt),
+	}
+}
+
+// Enqueue appends a prompt to the end of a session's queue
+func (q *PromptQueue) Enqueue(sessionID int, prompt string) *models.QueuedPrompt {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.nextID++
+	queued := &models.QueuedPrompt{
+		ID:        q.nextID,
+		SessionID: sessionID,
+		Prompt:    prompt,
+		QueuedAt:  time.Now(),
+	}
+	q.queues[sessionID] = append(q.queues[sessionID], queued)
+	queued.Position = len(q.queues[sessionID])
+
+	return q.copy(queued)
+}
+
+// EnqueueFront puts a fix-up prompt for failing checks at the head of a session's queue
+func (q *PromptQueue) EnqueueFront(sessionID int, prompt string, validationIteration int) *models.QueuedPrompt {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.nextID++
+	queued := &models.QueuedPrompt{
+		ID:                  q.nextID,
+		SessionID:           sessionID,
+		Prompt:              prompt,
+		QueuedAt:            time.Now(),
+		ValidationIteration: validationIteration,
+	}
+	q.set(sessionID, append([]*models.QueuedPrompt{queued}, q.queues[sessionID]...))
+
+	return q.copy(queued)
+}
+
+// Dequeue removes and returns the oldest prompt of a session's queue
+func (q *PromptQueue) Dequeue(sessionID int) (*models.QueuedPrompt, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	queue := q.queues[sessionID]
+	if len(queue) == 0 {
+		return nil, false
+	}
+
+	next := queue[0]
+	q.set(sessionID, queue[1:])
+	next.Position = 0
+
+	return next, true
+}
+
+// List returns a snapshot of a session's queue
+func (q *PromptQueue) List(sessionID int) []*models.QueuedPrompt {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	queue := q.queues[sessionID]
+	prompts := make([]*models.QueuedPrompt, 0, len(queue))
+	for _, queued := range queue {
+		prompts = append(prompts, q.copy(queued))
+	}
+	return prompts
+}
+
+// Len returns the number of prompts waiting for a session
+func (q *PromptQueue) Len(sessionID int) int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return len(q.queues[sessionID])
+}
+
+// Sessions lists the sessions with prompts waiting
+func (q *PromptQueue) Sessions() []int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	sessions := make([]int, 0, len(q.queues))
+	for sessionID, queue := range q.queues {
+		if len(queue) > 0 {
+			sessions = append(sessions, sessionID)
+		}
+	}
+	return sessions
+}
+
+// Remove cancels a single queued prompt
+func (q *PromptQueue) Remove(sessionID, promptID int) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	queue := q.queues[sessionID]
+	for i, queued := range queue {
+		if queued.ID == promptID {
+			remaining := append(append([]*models.QueuedPrompt{}, queue[:i]...), queue[i+1:]...)
+			q.set(sessionID, remaining)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("queued prompt %d not found for session %d", promptID, sessionID)
+}
+
+// Reorder rearranges a session's queue; promptIDs must list every queued prompt exactly once
+func (q *PromptQueue) Reorder(sessionID int, promptIDs []int) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	queue := q.queues[sessionID]
+	if len(promptIDs) != len(queue) {
+		return fmt.Errorf("expected %d prompt IDs, got %d", len(queue), len(promptIDs))
+	}
+
+	byID := make(map[int]*models.QueuedPrompt, len(queue))
+	for _, queued := range queue {
+		byID[queued.ID] = queued
+	}
+
+	reordered := make([]*models.QueuedPrompt, 0, len(queue))
+	for _, id := range promptIDs {
+		queued, exists := byID[id]
+		if !exists {
+			return fmt.Errorf("queued prompt %d not found or listed twice", id)
+		}
+		delete(byID, id)
+		reordered = append(reordered, queued)
+	}
+
+	q.set(sessionID, reordered)
+	return nil
+}
+
+// Clear drops every prompt queued for a session and returns how many were removed
+func (q *PromptQueue) Clear(sessionID int) int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	count := len(q.queues[sessionID])
+	delete(q.queues, sessionID)
+	return count
+}
+
+// set replaces a session's queue and renumbers positions; callers must hold the mutex
+func (q *PromptQueue) set(sessionID int, queue []*models.QueuedPrompt) {
+	if len(queue) == 0 {
+		delete(q.queues, sessionID)
+		return
+	}
+	for i, queued := range queue {
+		queued.Position = i + 1
+	}
+	q.queues[sessionID] = queue
+}
+
+func (q *PromptQueue) copy(queued *models.QueuedPrompt) *models.QueuedPrompt {
+	c := *queued
+	return &c
+}
@@ -16,6 +16,9 @@ type SessionService struct {
 	eventRepo    *repositories.EventRepository
 	gitService   *GitService
 	sshService   *SSHService
+	
+	defaultAgentSettings *models.AgentSettings
+	agentBackends        []string
 }
 
 func NewSessionService(
@@ -34,6 +37,26 @@ func NewSessionService(
 	}
 }
 
+// SetDefaultAgentSettings sets the agent settings used where projects and sessions set none
+func (s *SessionService) SetDefaultAgentSettings(settings *models.AgentSettings) {
+	s.defaultAgentSettings = settings
+}
+
+// SetAgentBackends sets the agent backends a session config may pick
+func (s *SessionService) SetAgentBackends(backends []string) {
+	s.agentBackends = backends
+}
+
+// applyAgentSettings fills in the settings the session's agent will run with
+func (s *SessionService) applyAgentSettings(session *models.Session, project *models.Project) {
+	settings, err := models.ResolveAgentSettings(s.defaultAgentSettings, project, session)
+	if err != nil {
+		fmt.Printf("Failed to resolve agent settings for session %d: %v\n", session.ID, err)
+		return
+	}
+	session.AgentSettings = settings
+}
+
 func (s *SessionService) CreateSession(req *models.CreateSessionRequest) (*models.Session, error) {
 	// Validate request
 	if req.Name == "" {
@@ -192,6 +215,10 @@ func (s *SessionService) GetSession(id int) (*models.Session, error) {
 		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
 	
+	if project, err := s.projectRepo.GetByID(session.ProjectID); err == nil {
+		s.applyAgentSettings(session, project)
+	}
+	
 	return session, nil
 }
 
@@ -223,6 +250,8 @@ func (s *SessionService) GetSessionsByProject(projectID int) ([]*models.Session,
 			if currentBranch, err := s.gitService.GetCurrentBranch(session.WorktreePath); err == nil {
 				session.Config["current_branch"] = currentBranch
 			}
+			
+			s.applyAgentSettings(session, project)
 		}
 	}
 	
@@ -248,6 +277,8 @@ func (s *SessionService) GetAllSessions() ([]*models.Session, error) {
 			if currentBranch, err := s.gitService.GetCurrentBranch(session.WorktreePath); err == nil {
 				session.Config["current_branch"] = currentBranch
 			}
+			
+			s.applyAgentSettings(session, project)
 		}
 	}
 	
@@ -261,7 +292,7 @@ func (s *SessionService) UpdateSession(id int, req *models.UpdateSessionRequest)
 	}
 	
 	// Get project for validation
-	_, err = s.projectRepo.GetByID(session.ProjectID)
+	project, err := s.projectRepo.GetByID(session.ProjectID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get project: %w", err)
 	}
@@ -332,6 +363,9 @@ func (s *SessionService) UpdateSession(id int, req *models.UpdateSessionRequest)
 		if err := session.Validate(); err != nil {
 			return nil, fmt.Errorf("session validation failed: %w", err)
 		}
+		if err := validateAgentBackend(session.Config, s.agentBackends); err != nil {
+			return nil, fmt.Errorf("session validation failed: %w", err)
+		}
 		
 		if err := s.sessionRepo.Update(session); err != nil {
 			return nil, fmt.Errorf("failed to update session: %w", err)
@@ -350,6 +384,8 @@ func (s *SessionService) UpdateSession(id int, req *models.UpdateSessionRequest)
 		}
 	}
 	
+	s.applyAgentSettings(session, project)
+	
 	return session, nil
 }
 
@@ -371,6 +407,11 @@ func (s *SessionService) DeleteSession(id int) error {
 		fmt.Printf("Warning: failed to remove worktree: %v\n", err)
 	}
 	
+	// Let git collect the worktree snapshots of the session's turns
+	if err := s.gitService.DeleteSnapshots(project.Path, session.ID); err != nil {
+		fmt.Printf("Warning: failed to delete worktree snapshots: %v\n", err)
+	}
+	
 	// Delete session from database
 	if err := s.sessionRepo.Delete(id); err != nil {
 		return fmt.Errorf("failed to delete session: %w", err)
@@ -715,6 +756,11 @@ func (s *SessionService) CloseSession(id int) error {
 		fmt.Printf("Warning: failed to remove worktree: %v\n", err)
 	}
 	
+	// Let git collect the worktree snapshots of the session's turns
+	if err := s.gitService.DeleteSnapshots(project.Path, session.ID); err != nil {
+		fmt.Printf("Warning: failed to delete worktree snapshots: %v\n", err)
+	}
+	
 	// Create close event before deletion
 	// Create close event before deletion
 	event := models.NewSessionEvent("session_closed", session.ID, map[string]interface{}{
@@ -778,23 +824,7 @@ func getUpdatedFields(req *models.UpdateSessionRequest) []string {
 // Helper methods for SSH support
 
 func (s *SessionService) isSSHProject(project *models.Project) bool {
-	if project.Config == nil {
-		return false
-	}
-	
-	// Check for SSH configuration in project config
-	if sshHost, ok := project.Config["ssh_host"].(string); ok && sshHost != "" {
-		return true
-	}
-	
-	// Check for nested SSH config
-	if sshConfig, ok := project.Config["ssh"].(map[string]interface{}); ok {
-		if host, ok := sshConfig["host"].(string); ok && host != "" {
-			return true
-		}
-	}
-	
-	return false
+	return s.sshService.IsSSHProject(project)
 }
 
 func (s *SessionService) getSSHConfig(project *models.Project) (*models.ProjectConfig, error) {
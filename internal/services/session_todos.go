@@ -0,0 +1,63 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"habibi-go/internal/models"
+)
+
+// todoWriteTool is the tool Claude keeps its task list with
+const todoWriteTool = "TodoWrite"
+
+// recordTodos stores the task list from a TodoWrite call and announces it
+func (s *ClaudeSessionService) recordTodos(turn *models.Turn, event AgentEvent) {
+	// The tool input is whatever the parser decoded; round-trip it into the typed list
+	data, err := json.Marshal(event.ToolInput)
+	if err != nil {
+		fmt.Printf("Failed to read %s input: %v\n", todoWriteTool, err)
+		return
+	}
+	var input struct {
+		Todos []models.Todo `json:"todos"`
+	}
+	if err := json.Unmarshal(data, &input); err != nil {
+		fmt.Printf("Failed to read %s input: %v\n", todoWriteTool, err)
+		return
+	}
+
+	list := &models.TodoList{
+		SessionID: turn.SessionID,
+		TurnID:    turn.ID,
+		ToolUseID: event.ToolUseID,
+		Todos:     input.Todos,
+	}
+	if err := s.todoRepo.Create(list); err != nil {
+		fmt.Printf("Failed to save todo list: %v\n", err)
+		return
+	}
+
+	s.eventBroadcaster.BroadcastEvent("todos_updated", 0, map[string]interface{}{
+		"session_id": turn.SessionID,
+		"turn_id":    turn.ID,
+		"todos":      list.Todos,
+		"list_id":    list.ID,
+	})
+}
+
+// GetTodos returns a session's current task list; it is empty if the agent never wrote one
+func (s *ClaudeSessionService) GetTodos(sessionID int) (*models.TodoList, error) {
+	list, err := s.todoRepo.GetLatest(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = &models.TodoList{SessionID: sessionID, Todos: []models.Todo{}}
+	}
+	return list, nil
+}
+
+// GetTodoHistory returns the most recent versions of a session's task list, oldest first
+func (s *ClaudeSessionService) GetTodoHistory(sessionID int, limit int) ([]*models.TodoList, error) {
+	return s.todoRepo.GetHistory(sessionID, limit)
+}
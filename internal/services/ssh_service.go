@@ -1,12 +1,16 @@
 package services
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 	
 	"golang.org/x/crypto/ssh"
 	"habibi-go/internal/models"
@@ -14,6 +18,7 @@ import (
 
 type SSHService struct {
 	connections map[int]*SSHConnection // project ID -> connection
+	mutex       sync.Mutex
 }
 
 type SSHConnection struct {
@@ -75,6 +80,8 @@ func (s *SSHService) Connect(project *models.Project) error {
 	}
 	
 	// Store connection
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	s.connections[project.ID] = &SSHConnection{
 		client: client,
 		config: config,
@@ -87,14 +94,15 @@ func (s *SSHService) Connect(project *models.Project) error {
 
 // Disconnect closes the SSH connection for a project
 func (s *SSHService) Disconnect(projectID int) error {
+	s.mutex.Lock()
 	conn, exists := s.connections[projectID]
+	delete(s.connections, projectID)
+	s.mutex.Unlock()
 	if !exists {
 		return nil
 	}
 	
-	err := conn.client.Close()
-	delete(s.connections, projectID)
-	return err
+	return conn.client.Close()
 }
 
 // ExecuteSetupCommand runs the project setup command with environment variables
@@ -142,7 +150,9 @@ func (s *SSHService) ExecuteSetupCommand(project *models.Project, worktreePath s
 
 // ExecuteCommand runs a command on the remote server
 func (s *SSHService) ExecuteCommand(projectID int, command string) (string, error) {
+	s.mutex.Lock()
 	conn, exists := s.connections[projectID]
+	s.mutex.Unlock()
 	if !exists {
 		return "", fmt.Errorf("no SSH connection for project %d", projectID)
 	}
@@ -183,43 +193,152 @@ func (s *SSHService) CreateRemoteWorktree(project *models.Project, branchName st
 	return err
 }
 
-// StreamClaudeOutput starts a Claude process on the remote server and streams its output
-func (s *SSHService) StreamClaudeOutput(projectID int, worktreePath string, args []string) (io.ReadCloser, error) {
-	conn, exists := s.connections[projectID]
-	if !exists {
-		return nil, fmt.Errorf("no SSH connection for project %d", projectID)
+// StartAgentProcess starts an agent command in a remote worktree. The remote shell reports its PID
+// before exec'ing the agent, so the process group can be signalled later over a separate session.
+func (s *SSHService) StartAgentProcess(project *models.Project, worktreePath, command string, args []string, withStdin bool) (*RemoteAgentProcess, error) {
+	conn, err := s.getConnection(project)
+	if err != nil {
+		return nil, err
 	}
 	
-	// Create a new session
+	// Create a new session, reconnecting once if the connection went stale
 	session, err := conn.client.NewSession()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+		s.Disconnect(project.ID)
+		if conn, err = s.getConnection(project); err != nil {
+			return nil, err
+		}
+		if session, err = conn.client.NewSession(); err != nil {
+			return nil, fmt.Errorf("failed to create SSH session: %w", err)
+		}
+	}
+	
+	var stdin io.WriteCloser
+	if withStdin {
+		if stdin, err = session.StdinPipe(); err != nil {
+			session.Close()
+			return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
+		}
 	}
 	
-	// Get stdout pipe
 	stdout, err := session.StdoutPipe()
 	if err != nil {
 		session.Close()
 		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
 	}
 	
-	// Build claude command
-	claudeCmd := fmt.Sprintf("cd %s && claude %s", worktreePath, strings.Join(args, " "))
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
+	}
 	
-	// Start the command
-	err = session.Start(claudeCmd)
+	// Build agent command with the project's environment
+	envVars := s.prepareEnvironmentVars(conn.config, project.Path, worktreePath)
+	var cmdBuilder strings.Builder
+	for key, value := range envVars {
+		cmdBuilder.WriteString(fmt.Sprintf("export %s=%s; ", key, shellQuote(value)))
+	}
+	cmdBuilder.WriteString(fmt.Sprintf("cd %s && echo %s$$ && exec %s", shellQuote(worktreePath), remotePIDPrefix, shellQuote(command)))
+	for _, arg := range args {
+		cmdBuilder.WriteString(" ")
+		cmdBuilder.WriteString(shellQuote(arg))
+	}
+	
+	if err := session.Start(cmdBuilder.String()); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to start %s: %w", command, err)
+	}
+	
+	// The first stdout line carries the PID of the remote process group
+	reader := bufio.NewReader(stdout)
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, remotePIDPrefix) {
+		session.Close()
+		return nil, fmt.Errorf("failed to start %s in %s: remote shell exited early", command, worktreePath)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, remotePIDPrefix)))
 	if err != nil {
 		session.Close()
-		return nil, fmt.Errorf("failed to start claude: %w", err)
+		return nil, fmt.Errorf("failed to read remote agent PID: %w", err)
 	}
 	
-	// Return a wrapper that closes the session when done
-	return &sshStreamReader{
-		reader:  stdout,
-		session: session,
+	return &RemoteAgentProcess{
+		sshService: s,
+		projectID:  project.ID,
+		session:    session,
+		stdin:      stdin,
+		stdout:     reader,
+		stderr:     stderr,
+		pid:        pid,
 	}, nil
 }
 
+// IsSSHProject reports whether a project's sessions live on a remote host
+func (s *SSHService) IsSSHProject(project *models.Project) bool {
+	if project.Config == nil {
+		return false
+	}
+	
+	// Check for SSH configuration in project config
+	if sshHost, ok := project.Config["ssh_host"].(string); ok && sshHost != "" {
+		return true
+	}
+	
+	// Check for nested SSH config
+	if sshConfig, ok := project.Config["ssh"].(map[string]interface{}); ok {
+		if host, ok := sshConfig["host"].(string); ok && host != "" {
+			return true
+		}
+	}
+	
+	return false
+}
+
+// LookPath checks that a command can be found on a project's remote host, resolving
+// relative paths against the remote project directory
+func (s *SSHService) LookPath(project *models.Project, command string) error {
+	conn, err := s.getConnection(project)
+	if err != nil {
+		return err
+	}
+	
+	check := fmt.Sprintf("cd %s && command -v %s", shellQuote(conn.config.RemoteProjectPath), shellQuote(command))
+	if _, err := s.ExecuteCommand(project.ID, check); err != nil {
+		return fmt.Errorf("command %q not found on %s", command, conn.config.SSHHost)
+	}
+	return nil
+}
+
+// WriteHomeFile writes a file only the SSH user can read on a project's remote host, at
+// path relative to the user's home directory, and returns its absolute path
+func (s *SSHService) WriteHomeFile(project *models.Project, path string, data []byte) (string, error) {
+	conn, err := s.getConnection(project)
+	if err != nil {
+		return "", err
+	}
+	
+	session, err := conn.client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+	
+	var stdout, stderr bytes.Buffer
+	session.Stdin = bytes.NewReader(data)
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	
+	// chmod covers a directory or file left over with wider permissions
+	dir := shellQuote(filepath.Dir(path))
+	write := fmt.Sprintf("cd && umask 077 && mkdir -p %s && chmod 700 %s && cat > %s && chmod 600 %s && pwd",
+		dir, dir, shellQuote(path), shellQuote(path))
+	if err := session.Run(write); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w\nstderr: %s", path, err, stderr.String())
+	}
+	return strings.TrimSpace(stdout.String()) + "/" + path, nil
+}
+
 // Helper methods
 
 // ParseProjectSSHConfig extracts SSH configuration from a project
@@ -296,13 +415,17 @@ func (s *SSHService) loadSSHKey(keyPath string) (ssh.Signer, error) {
 }
 
 func (s *SSHService) getConnection(project *models.Project) (*SSHConnection, error) {
+	s.mutex.Lock()
 	conn, exists := s.connections[project.ID]
+	s.mutex.Unlock()
 	if !exists {
 		// Try to connect
 		if err := s.Connect(project); err != nil {
 			return nil, err
 		}
+		s.mutex.Lock()
 		conn = s.connections[project.ID]
+		s.mutex.Unlock()
 	}
 	return conn, nil
 }
@@ -332,16 +455,68 @@ func (s *SSHService) expandVariables(command string, vars map[string]string) str
 	return result
 }
 
-// sshStreamReader wraps an SSH stdout reader and closes the session when done
-type sshStreamReader struct {
-	reader  io.Reader
-	session *ssh.Session
+const remotePIDPrefix = "habibi-pid:"
+
+// RemoteAgentProcess is an agent process running on an SSH host
+type RemoteAgentProcess struct {
+	sshService *SSHService
+	projectID  int
+	session    *ssh.Session
+	stdin      io.WriteCloser
+	stdout     io.Reader
+	stderr     io.Reader
+	pid        int
 }
 
-func (r *sshStreamReader) Read(p []byte) (n int, err error) {
-	return r.reader.Read(p)
+func (p *RemoteAgentProcess) Stdin() io.WriteCloser {
+	return p.stdin
 }
 
-func (r *sshStreamReader) Close() error {
-	return r.session.Close()
-}
\ No newline at end of file
+func (p *RemoteAgentProcess) Stdout() io.Reader {
+	return p.stdout
+}
+
+func (p *RemoteAgentProcess) Stderr() io.Reader {
+	return p.stderr
+}
+
+// Wait waits for the remote command to exit and closes the SSH session
+func (p *RemoteAgentProcess) Wait() error {
+	defer p.session.Close()
+	return p.session.Wait()
+}
+
+// Signal sends a signal such as INT or KILL to the remote process group
+func (p *RemoteAgentProcess) Signal(signal string) error {
+	cmd := fmt.Sprintf("kill -%s -- -%d 2>/dev/null || kill -%s %d 2>/dev/null || true", signal, p.pid, signal, p.pid)
+	if _, err := p.sshService.ExecuteCommand(p.projectID, cmd); err != nil {
+		return fmt.Errorf("failed to send %s to remote agent: %w", signal, err)
+	}
+	return nil
+}
+
+// Interrupt sends SIGINT, waits for exit or the grace period, then kills the remote group
+func (p *RemoteAgentProcess) Interrupt(exited <-chan struct{}, grace time.Duration) error {
+	if err := p.Signal("INT"); err != nil {
+		return err
+	}
+	
+	select {
+	case <-exited:
+	case <-time.After(grace):
+	}
+	
+	return p.Kill()
+}
+
+// Kill kills the remote process group and closes the SSH session
+func (p *RemoteAgentProcess) Kill() error {
+	err := p.Signal("KILL")
+	p.session.Close()
+	return err
+}
+
+// shellQuote quotes a value for a POSIX shell command line
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
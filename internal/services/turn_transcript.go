@@ -0,0 +1,214 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"habibi-go/internal/models"
+)
+
+// maxTranscriptLineSize bounds one line when reading a transcript back; tool results can be large
+const maxTranscriptLineSize = 16 * 1024 * 1024
+
+// turnTranscript collects the raw stdout lines of a turn, gzip compressed as they arrive,
+// and when each arrived
+type turnTranscript struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+	gz    *gzip.Writer
+	times []int64
+}
+
+func newTurnTranscript() *turnTranscript {
+	t := &turnTranscript{}
+	t.gz = gzip.NewWriter(&t.buf)
+	return t
+}
+
+// Add appends one line of agent output
+func (t *turnTranscript) Add(line string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if _, err := io.WriteString(t.gz, line+"\n"); err != nil {
+		fmt.Printf("Failed to record transcript line: %v\n", err)
+		return
+	}
+	t.times = append(t.times, time.Now().UnixMilli())
+}
+
+// Close finishes the compressed stream and returns it with the arrival time of each line
+func (t *turnTranscript) Close() ([]byte, []int64, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err := t.gz.Close(); err != nil {
+		return nil, nil, fmt.Errorf("failed to compress transcript: %w", err)
+	}
+	return t.buf.Bytes(), t.times, nil
+}
+
+// saveTranscript stores the raw output of a finished turn next to its record
+func (s *ClaudeSessionService) saveTranscript(running *runningTurn) {
+	if running.transcript == nil || running.turn == nil || running.turn.ID == 0 {
+		return
+	}
+
+	data, times, err := running.transcript.Close()
+	if err != nil {
+		fmt.Printf("Failed to save transcript for turn %d: %v\n", running.turn.ID, err)
+		return
+	}
+	if len(times) == 0 {
+		return
+	}
+
+	err = s.turnRepo.SaveTranscript(&models.TurnTranscript{
+		TurnID:    running.turn.ID,
+		Backend:   running.turn.Backend,
+		Data:      data,
+		LineCount: len(times),
+		LineTimes: times,
+	})
+	if err != nil {
+		fmt.Printf("Failed to save transcript for turn %d: %v\n", running.turn.ID, err)
+	}
+}
+
+// GetTurnTranscript returns the raw output a turn's agent wrote, one line per message
+func (s *ClaudeSessionService) GetTurnTranscript(turnID int) ([]byte, error) {
+	transcript, err := s.turnRepo.GetTranscript(turnID)
+	if err != nil {
+		return nil, err
+	}
+	if transcript == nil {
+		return nil, fmt.Errorf("no transcript saved for turn %d", turnID)
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(transcript.Data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+	return data, nil
+}
+
+// ChatRebuildResult reports what RebuildChatHistory did
+type ChatRebuildResult struct {
+	TurnsRebuilt    int `json:"turns_rebuilt"`
+	TurnsSkipped    int `json:"turns_skipped"`
+	MessagesCreated int `json:"messages_created"`
+}
+
+// RebuildChatHistory parses the saved transcripts of a session's turns again with
+// the current parsers and replaces the agent messages saved for them. Turns without
+// a transcript keep their messages.
+func (s *ClaudeSessionService) RebuildChatHistory(sessionID int) (*ChatRebuildResult, error) {
+	s.processMutex.Lock()
+	_, running := s.runningProcesses[sessionID]
+	s.processMutex.Unlock()
+	if running {
+		return nil, fmt.Errorf("session %d has a running turn; stop it before rebuilding", sessionID)
+	}
+
+	// A negative limit returns every turn
+	turns, err := s.turnRepo.GetBySessionID(sessionID, -1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get turns: %w", err)
+	}
+
+	result := &ChatRebuildResult{}
+	for _, turn := range turns {
+		transcript, err := s.turnRepo.GetTranscript(turn.ID)
+		if err != nil {
+			return result, err
+		}
+		if transcript == nil {
+			result.TurnsSkipped++
+			continue
+		}
+
+		messages, err := s.rebuildTurnMessages(turn, transcript)
+		if err != nil {
+			fmt.Printf("Skipping turn %d while rebuilding chat: %v\n", turn.ID, err)
+			result.TurnsSkipped++
+			continue
+		}
+
+		if err := s.chatRepo.ReplaceTurnMessages(turn.ID, messages); err != nil {
+			return result, fmt.Errorf("failed to replace messages of turn %d: %w", turn.ID, err)
+		}
+		result.TurnsRebuilt++
+		result.MessagesCreated += len(messages)
+	}
+
+	s.eventBroadcaster.BroadcastEvent("claude_chat_rebuilt", 0, map[string]interface{}{
+		"session_id": sessionID,
+		"result":     result,
+	})
+	return result, nil
+}
+
+// rebuildTurnMessages runs a transcript through its backend's parser and returns the
+// messages it produces, dated by when their lines arrived if the transcript recorded
+// it. Usage from the result messages is stored again as well.
+func (s *ClaudeSessionService) rebuildTurnMessages(turn *models.Turn, transcript *models.TurnTranscript) ([]*models.ChatMessage, error) {
+	runner, err := s.agents.Get(transcript.Backend)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(transcript.Data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+	defer reader.Close()
+
+	// Results are counted again from scratch, but the cost stays as recorded: a long-lived
+	// process reports a running total that the turn's transcript alone cannot split
+	turn.TurnUsage = models.TurnUsage{TotalCostUSD: turn.TotalCostUSD}
+
+	var messages []*models.ChatMessage
+	var lineTime time.Time
+	handle := func(events []AgentEvent) {
+		for _, event := range events {
+			if msg := chatMessageForEvent(turn, event); msg != nil {
+				msg.CreatedAt = lineTime
+				messages = append(messages, msg)
+			} else if event.Type == AgentEventResult && event.Usage != nil {
+				event.Usage.TotalCostUSD = 0
+				turn.TurnUsage.Add(event.Usage)
+			}
+		}
+	}
+
+	parser := runner.NewParser()
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxTranscriptLineSize)
+	for line := 0; scanner.Scan(); line++ {
+		if line < len(transcript.LineTimes) {
+			lineTime = time.UnixMilli(transcript.LineTimes[line])
+		}
+		handle(parser.ParseLine(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+	handle(parser.Flush())
+
+	// Only the stored usage changes; the turn's budgets were checked when it ran
+	if err := s.turnRepo.UpdateUsage(turn.ID, &turn.TurnUsage); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"habibi-go/internal/models"
+)
+
+// usageLimitResetMargin is added to a reset time the agent reports, so the retry does
+// not race a clock that is slightly off
+const usageLimitResetMargin = 30 * time.Second
+
+// maxUsageLimitRetries caps how often in a row a session retries limits that do not say
+// when they reset, which may be a different failure that merely looks like one
+const maxUsageLimitRetries = 3
+
+var (
+	// "Claude AI usage limit reached|1760212800"
+	usageLimitEpochPattern = regexp.MustCompile(`(?i)usage limit reached\|(\d{9,11})`)
+	// "5-hour limit reached ∙ resets 3pm", "Your limit will reset at 11:30pm (Europe/Berlin)"
+	usageLimitClockPattern = regexp.MustCompile(`(?i)\blimit (?:reached\b.*?\bresets|will reset at) (\d{1,2})(?::(\d{2}))? ?([ap]m)(?: \(([^)]+)\))?`)
+	// Limits that do not say when they reset: the CLI's limit notices and the API's 429s
+	usageLimitPattern = regexp.MustCompile(`(?i)\busage limit reached\b|\b(?:5-hour|session|weekly|opus) limit reached\b|\bAPI Error: 429\b|"type":\s*"rate_limit_error"`)
+)
+
+// detectUsageLimit recognizes the agent's account usage or rate limit messages in an error
+// or stderr line. It returns nil for anything else. Limits that do not say when they
+// reset are retried after retryDelay.
+func detectUsageLimit(text string, now time.Time, retryDelay time.Duration) *models.UsageLimit {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+
+	if match := usageLimitEpochPattern.FindStringSubmatch(text); match != nil {
+		// A reset time already past would retry straight into the same limit
+		if seconds, err := strconv.ParseInt(match[1], 10, 64); err == nil && time.Unix(seconds, 0).After(now) {
+			return &models.UsageLimit{
+				Message: strings.TrimSpace(text[:strings.Index(text, "|")]),
+				ResetAt: time.Unix(seconds, 0).Add(usageLimitResetMargin),
+				Exact:   true,
+			}
+		}
+	}
+
+	if match := usageLimitClockPattern.FindStringSubmatch(text); match != nil {
+		return &models.UsageLimit{
+			Message: text,
+			ResetAt: nextClockTime(now, match[1], match[2], match[3], match[4]).Add(usageLimitResetMargin),
+			Exact:   true,
+		}
+	}
+
+	if usageLimitPattern.MatchString(text) {
+		return &models.UsageLimit{
+			Message: text,
+			ResetAt: now.Add(retryDelay),
+		}
+	}
+	return nil
+}
+
+// nextClockTime returns the next time the clock shows hour:minute am/pm, in the named
+// time zone if it is known and the local one otherwise
+func nextClockTime(now time.Time, hour, minute, meridiem, zone string) time.Time {
+	location := now.Location()
+	if zone != "" {
+		if loaded, err := time.LoadLocation(zone); err == nil {
+			location = loaded
+		}
+	}
+
+	h, _ := strconv.Atoi(hour)
+	m, _ := strconv.Atoi(minute)
+	h %= 12
+	if strings.EqualFold(meridiem, "pm") {
+		h += 12
+	}
+
+	local := now.In(location)
+	next := time.Date(local.Year(), local.Month(), local.Day(), h, m, 0, 0, location)
+	if !next.After(local) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
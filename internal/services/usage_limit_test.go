@@ -0,0 +1,115 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetectUsageLimit(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	retryDelay := 5 * time.Minute
+
+	tests := []struct {
+		name    string
+		text    string
+		want    bool
+		exact   bool
+		resetAt time.Time
+	}{
+		{
+			name:    "epoch",
+			text:    "Claude AI usage limit reached|1792152000",
+			want:    true,
+			exact:   true,
+			resetAt: time.Unix(1792152000, 0).Add(usageLimitResetMargin),
+		},
+		{
+			name:    "past epoch waits the retry delay",
+			text:    "Claude AI usage limit reached|1760212800",
+			want:    true,
+			resetAt: now.Add(retryDelay),
+		},
+		{
+			name:    "resets 3pm",
+			text:    "5-hour limit reached ∙ resets 3pm",
+			want:    true,
+			exact:   true,
+			resetAt: time.Date(2026, 10, 16, 15, 0, 0, 0, time.UTC).Add(usageLimitResetMargin),
+		},
+		{
+			name:    "resets with minutes and time zone",
+			text:    "Claude usage limit reached. Your limit will reset at 11:30pm (Europe/Berlin).",
+			want:    true,
+			exact:   true,
+			resetAt: time.Date(2026, 10, 16, 23, 30, 0, 0, berlin).Add(usageLimitResetMargin),
+		},
+		{
+			name:    "reset time already past today",
+			text:    "Session limit reached ∙ resets 9am",
+			want:    true,
+			exact:   true,
+			resetAt: time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC).Add(usageLimitResetMargin),
+		},
+		{
+			name:    "API rate limit",
+			text:    `API Error: 429 {"type":"error","error":{"type":"rate_limit_error","message":"Number of requests has exceeded your rate limit"}}`,
+			want:    true,
+			resetAt: now.Add(retryDelay),
+		},
+		{name: "empty", text: "  "},
+		{name: "other API error", text: `API Error: 529 {"type":"error","error":{"type":"overloaded_error"}}`},
+		{name: "limit in the agent's prose", text: "I added a rate limit to the login handler; requests over the limit get 429."},
+		{name: "tool output", text: "Error: max_turns limit reached"},
+		{name: "status code in a path", text: "open /tmp/build-429/out: no such file or directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := detectUsageLimit(tt.text, now, retryDelay)
+			if !tt.want {
+				if limit != nil {
+					t.Fatalf("got limit %+v, want none", limit)
+				}
+				return
+			}
+			if limit == nil {
+				t.Fatal("got no limit")
+			}
+			if limit.Exact != tt.exact {
+				t.Errorf("exact = %v, want %v", limit.Exact, tt.exact)
+			}
+			if !limit.ResetAt.Equal(tt.resetAt) {
+				t.Errorf("reset at %s, want %s", limit.ResetAt, tt.resetAt)
+			}
+		})
+	}
+}
+
+func TestNextClockTime(t *testing.T) {
+	now := time.Date(2026, 10, 16, 14, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name                         string
+		hour, minute, meridiem, zone string
+		want                         time.Time
+	}{
+		{"later today", "3", "", "pm", "", time.Date(2026, 10, 16, 15, 0, 0, 0, time.UTC)},
+		{"tomorrow", "2", "15", "pm", "", time.Date(2026, 10, 17, 14, 15, 0, 0, time.UTC)},
+		{"noon", "12", "", "pm", "", time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)},
+		{"midnight", "12", "", "am", "", time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)},
+		{"unknown zone uses local time", "4", "", "PM", "Nowhere/Town", time.Date(2026, 10, 16, 16, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextClockTime(now, tt.hour, tt.minute, tt.meridiem, tt.zone)
+			if !got.Equal(tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
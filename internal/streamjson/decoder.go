@@ -0,0 +1,180 @@
+package streamjson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// maxLineSize bounds one line of output; tool results with file contents can be large
+const maxLineSize = 16 * 1024 * 1024
+
+// Decode parses one line of stream-json output
+func Decode(line []byte) (Message, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(line, &envelope); err != nil {
+		return nil, fmt.Errorf("invalid stream-json line: %w", err)
+	}
+
+	var msg Message
+	switch envelope.Type {
+	case TypeSystem:
+		msg = &SystemMessage{}
+	case TypeAssistant:
+		msg = &AssistantMessage{}
+	case TypeUser:
+		msg = &UserMessage{}
+	case TypeResult:
+		msg = &ResultMessage{}
+	case TypeStreamEvent:
+		msg = &StreamEvent{}
+	case BlockToolUse, BlockToolResult:
+		msg = &BlockMessage{}
+	case "message_start", "message_delta", "message_stop",
+		"content_block_start", "content_block_delta", "content_block_stop":
+		// Older CLI versions sent partial events without the stream_event wrapper
+		event := &StreamEvent{Envelope: envelope}
+		if err := json.Unmarshal(line, &event.Event); err != nil {
+			return nil, fmt.Errorf("invalid %s message: %w", envelope.Type, err)
+		}
+		event.Type = TypeStreamEvent
+		return event, nil
+	default:
+		msg = &UnknownMessage{}
+	}
+
+	if err := json.Unmarshal(line, msg); err != nil {
+		return nil, fmt.Errorf("invalid %s message: %w", envelope.Type, err)
+	}
+	return msg, nil
+}
+
+// Decoder reads messages from a stream, one per line
+type Decoder struct {
+	scanner *bufio.Scanner
+	line    []byte
+	lineNo  int
+}
+
+// NewDecoder creates a decoder reading from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{scanner: NewLineScanner(r)}
+}
+
+// NewLineScanner returns a scanner for the raw lines of r that accepts lines up to the
+// size the decoder does
+func NewLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return scanner
+}
+
+// Next returns the next message, or io.EOF at the end of the stream. A line that
+// does not decode returns an error, and the following call moves on to the next line.
+func (d *Decoder) Next() (Message, error) {
+	for d.scanner.Scan() {
+		d.lineNo++
+		d.line = d.scanner.Bytes()
+		if len(bytes.TrimSpace(d.line)) == 0 {
+			continue
+		}
+
+		msg, err := Decode(d.line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", d.lineNo, err)
+		}
+		return msg, nil
+	}
+
+	if err := d.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Line returns the raw line behind the last message or error; it is only valid until the next call
+func (d *Decoder) Line() []byte {
+	return d.line
+}
+
+// decodeKeepingExtra decodes data into v and stores the fields v has no place for in extra
+func decodeKeepingExtra(data []byte, v interface{}, extra *map[string]json.RawMessage) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	known := knownFields(reflect.TypeOf(v).Elem())
+	for name := range fields {
+		if known[name] {
+			delete(fields, name)
+		}
+	}
+
+	*extra = nil
+	if len(fields) > 0 {
+		*extra = fields
+	}
+	return nil
+}
+
+// encodeKeepingExtra encodes v and adds the fields of extra it does not set itself
+func encodeKeepingExtra(v interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range extra {
+		if _, exists := fields[name]; !exists {
+			fields[name] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+var knownFieldsCache sync.Map
+
+// knownFields returns the JSON names a struct type decodes, including embedded structs
+func knownFields(t reflect.Type) map[string]bool {
+	if cached, ok := knownFieldsCache.Load(t); ok {
+		return cached.(map[string]bool)
+	}
+
+	known := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			for name := range knownFields(field.Type) {
+				known[name] = true
+			}
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		known[name] = true
+	}
+
+	knownFieldsCache.Store(t, known)
+	return known
+}
@@ -0,0 +1,327 @@
+package streamjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// decodeFixture reads every message of a file in testdata
+func decodeFixture(t *testing.T, name string) []Message {
+	t.Helper()
+
+	file, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	defer file.Close()
+
+	var messages []Message
+	decoder := NewDecoder(file)
+	for {
+		msg, err := decoder.Next()
+		if err == io.EOF {
+			return messages
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		messages = append(messages, msg)
+	}
+}
+
+func TestDecodeSimpleTurn(t *testing.T) {
+	messages := decodeFixture(t, "simple_turn.jsonl")
+	if len(messages) != 6 {
+		t.Fatalf("got %d messages, want 6 (blank lines skipped)", len(messages))
+	}
+
+	system, ok := messages[0].(*SystemMessage)
+	if !ok {
+		t.Fatalf("message 0 is %T, want *SystemMessage", messages[0])
+	}
+	if system.Subtype != "init" || system.Model != "claude-sonnet-4-5" || system.SessionID != "8f2c1d4e-0001" {
+		t.Errorf("unexpected init message: %+v", system.Envelope)
+	}
+	if len(system.Tools) != 3 || len(system.MCPServers) != 1 || system.MCPServers[0].Status != "connected" {
+		t.Errorf("tools or MCP servers not decoded: %+v", system)
+	}
+	for _, field := range []string{"slash_commands", "apiKeySource", "output_style"} {
+		if _, ok := system.Extra[field]; !ok {
+			t.Errorf("unknown field %s was dropped", field)
+		}
+	}
+	if _, ok := system.Extra["model"]; ok {
+		t.Error("known field model ended up in Extra")
+	}
+
+	text := messages[1].(*AssistantMessage)
+	if got := text.Message.Content[0]; got.Type != BlockText || got.Text != "Let me look at the tests." {
+		t.Errorf("unexpected text block: %+v", got)
+	}
+	if text.Message.Usage == nil || text.Message.Usage.CacheCreationInputTokens != 1200 {
+		t.Errorf("message usage not decoded: %+v", text.Message.Usage)
+	}
+	if text.ParentToolUseID != "" {
+		t.Errorf("null parent_tool_use_id decoded as %q", text.ParentToolUseID)
+	}
+
+	toolUse := messages[2].(*AssistantMessage).Message.Content[0]
+	input, _ := toolUse.Input.(map[string]interface{})
+	if toolUse.Type != BlockToolUse || toolUse.Name != "Bash" || toolUse.ID != "toolu_01" || input["command"] != "go test ./..." {
+		t.Errorf("unexpected tool use block: %+v", toolUse)
+	}
+
+	toolResult := messages[3].(*UserMessage).Message.Content[0]
+	if toolResult.Type != BlockToolResult || toolResult.ToolUseID != "toolu_01" || toolResult.Content != "ok  \tapp\t0.012s" {
+		t.Errorf("unexpected tool result block: %+v", toolResult)
+	}
+
+	result, ok := messages[5].(*ResultMessage)
+	if !ok {
+		t.Fatalf("message 5 is %T, want *ResultMessage", messages[5])
+	}
+	if result.IsError || result.NumTurns != 3 || result.DurationMS != 5120 || result.TotalCostUSD != 0.0213 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if result.Usage.OutputTokens != 57 || result.Usage.CacheReadInputTokens != 2400 {
+		t.Errorf("result usage not decoded: %+v", result.Usage)
+	}
+	if _, ok := result.Usage.Extra["server_tool_use"]; !ok {
+		t.Error("unknown usage field server_tool_use was dropped")
+	}
+	if _, ok := result.Extra["permission_denials"]; !ok {
+		t.Error("unknown result field permission_denials was dropped")
+	}
+}
+
+func TestDecodePartialMessages(t *testing.T) {
+	messages := decodeFixture(t, "partial_messages.jsonl")
+	if len(messages) != 10 {
+		t.Fatalf("got %d messages, want 10", len(messages))
+	}
+
+	var events []PartialEvent
+	for i, msg := range messages {
+		event, ok := msg.(*StreamEvent)
+		if !ok {
+			t.Fatalf("message %d is %T, want *StreamEvent", i, msg)
+		}
+		events = append(events, event.Event)
+	}
+
+	if events[0].Type != "message_start" || events[0].Message == nil || events[0].Message.ID != "msg_10" {
+		t.Errorf("unexpected message_start: %+v", events[0])
+	}
+	if events[1].ContentBlock == nil || events[1].ContentBlock.Type != BlockText {
+		t.Errorf("unexpected content_block_start: %+v", events[1])
+	}
+
+	var text strings.Builder
+	for _, event := range events[2:4] {
+		if event.Delta == nil || event.Delta.Type != "text_delta" {
+			t.Fatalf("unexpected delta: %+v", event)
+		}
+		text.WriteString(event.Delta.Text)
+	}
+	if text.String() != "Hello, world" {
+		t.Errorf("deltas joined to %q", text.String())
+	}
+
+	if events[5].Index != 1 || events[5].ContentBlock.Name != "Read" {
+		t.Errorf("unexpected tool use start: %+v", events[5])
+	}
+	if events[6].Delta.PartialJSON != `{"file_path":` {
+		t.Errorf("partial JSON decoded as %q", events[6].Delta.PartialJSON)
+	}
+	if events[7].Delta.StopReason != "tool_use" || events[7].Usage == nil || events[7].Usage.OutputTokens != 21 {
+		t.Errorf("unexpected message_delta: %+v", events[7])
+	}
+	if _, ok := events[7].Delta.Extra["stop_sequence"]; !ok {
+		t.Error("unknown delta field stop_sequence was dropped")
+	}
+
+	// Partial events of older CLI versions come without the stream_event wrapper
+	legacy := messages[9].(*StreamEvent)
+	if legacy.Type != TypeStreamEvent || legacy.Event.Type != "content_block_delta" || legacy.Event.Delta.Text != "legacy" {
+		t.Errorf("unexpected legacy event: %+v", legacy)
+	}
+}
+
+func TestDecodeSubAgentNesting(t *testing.T) {
+	messages := decodeFixture(t, "subagent.jsonl")
+
+	wantParents := []string{"", "toolu_task", "toolu_task", "toolu_task", "toolu_task", ""}
+	if len(messages) != len(wantParents) {
+		t.Fatalf("got %d messages, want %d", len(messages), len(wantParents))
+	}
+	for i, msg := range messages {
+		if got := msg.Header().ParentToolUseID; got != wantParents[i] {
+			t.Errorf("message %d: parent_tool_use_id %q, want %q", i, got, wantParents[i])
+		}
+	}
+
+	nested := messages[3].(*UserMessage).Message.Content[0]
+	blocks, ok := nested.Content.([]interface{})
+	if !ok || len(blocks) != 1 {
+		t.Fatalf("tool result content decoded as %#v", nested.Content)
+	}
+}
+
+func TestDecodeThinkingAndImages(t *testing.T) {
+	messages := decodeFixture(t, "thinking_and_images.jsonl")
+
+	content := messages[0].(*AssistantMessage).Message.Content
+	if len(content) != 3 {
+		t.Fatalf("got %d blocks, want 3", len(content))
+	}
+	if content[0].Type != BlockThinking || content[0].Thinking != "The screenshot shows a broken layout." || content[0].Signature == "" {
+		t.Errorf("unexpected thinking block: %+v", content[0])
+	}
+	if content[1].Type != BlockRedactedThinking || content[1].Data == "" {
+		t.Errorf("unexpected redacted thinking block: %+v", content[1])
+	}
+
+	image := messages[2].(*AssistantMessage).Message.Content[0]
+	if image.Type != BlockImage || image.Source == nil || image.Source.URL != "https://example.com/diagram.png" {
+		t.Errorf("unexpected image block: %+v", image)
+	}
+	if _, ok := image.Extra["cache_control"]; !ok {
+		t.Error("unknown block field cache_control was dropped")
+	}
+
+	// A plain string prompt decodes as one text block
+	prompt := messages[3].(*UserMessage).Message.Content
+	if len(prompt) != 1 || prompt[0].Type != BlockText || prompt[0].Text != "Please continue" {
+		t.Errorf("string content decoded as %+v", prompt)
+	}
+}
+
+func TestDecodeUnknownTypes(t *testing.T) {
+	messages := decodeFixture(t, "unknown.jsonl")
+
+	boundary := messages[0].(*SystemMessage)
+	if boundary.Subtype != "compact_boundary" {
+		t.Errorf("unexpected subtype %q", boundary.Subtype)
+	}
+	if _, ok := boundary.Extra["compact_metadata"]; !ok {
+		t.Error("compact_metadata was dropped")
+	}
+
+	unknown, ok := messages[1].(*UnknownMessage)
+	if !ok {
+		t.Fatalf("message 1 is %T, want *UnknownMessage", messages[1])
+	}
+	if unknown.Type != "rate_limit_notice" || string(unknown.Extra["retry_after_ms"]) != "3000" {
+		t.Errorf("unexpected unknown message: %+v", unknown)
+	}
+
+	assistant := messages[2].(*AssistantMessage)
+	if block := assistant.Message.Content[0]; block.Type != "server_tool_use" || block.Name != "web_search" {
+		t.Errorf("unknown block type not kept: %+v", block)
+	}
+	if _, ok := assistant.Message.Extra["container"]; !ok {
+		t.Error("unknown message field container was dropped")
+	}
+}
+
+func TestDecoderReportsBadLines(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader("not json\n{\"type\":\"result\",\"is_error\":true}\n"))
+
+	if _, err := decoder.Next(); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("expected an error for line 1, got %v", err)
+	}
+	if string(decoder.Line()) != "not json" {
+		t.Errorf("Line() = %q", decoder.Line())
+	}
+
+	msg, err := decoder.Next()
+	if err != nil {
+		t.Fatalf("decoder did not recover: %v", err)
+	}
+	if result, ok := msg.(*ResultMessage); !ok || !result.IsError {
+		t.Errorf("unexpected message after bad line: %#v", msg)
+	}
+
+	if _, err := decoder.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestEncodingKeepsEveryField(t *testing.T) {
+	for _, name := range []string{"simple_turn.jsonl", "partial_messages.jsonl", "subagent.jsonl", "thinking_and_images.jsonl", "unknown.jsonl"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatalf("failed to read fixture: %v", err)
+		}
+
+		for i, line := range strings.Split(string(data), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			msg, err := Decode([]byte(line))
+			if err != nil {
+				t.Fatalf("%s line %d: %v", name, i+1, err)
+			}
+			encoded, err := json.Marshal(msg)
+			if err != nil {
+				t.Fatalf("%s line %d: failed to encode: %v", name, i+1, err)
+			}
+
+			var want, got interface{}
+			json.Unmarshal([]byte(line), &want)
+			json.Unmarshal(encoded, &got)
+			if want.(map[string]interface{})["type"] != msg.Header().Type {
+				// Older CLI versions' partial events come back in their stream_event wrapper
+				got = got.(map[string]interface{})["event"]
+			}
+			if path := missingField(want, got, ""); path != "" {
+				t.Errorf("%s line %d: %s lost when encoding again: %s", name, i+1, path, encoded)
+			}
+		}
+	}
+}
+
+// missingField returns the path of the first value of want that got lacks or changed,
+// or "" if got has them all. Fields got adds do not count, and neither do zero values
+// it leaves out or a message's string content it turns into one text block.
+func missingField(want, got interface{}, path string) string {
+	if got == nil && (want == nil || want == false || want == "" || want == float64(0)) {
+		return ""
+	}
+	if text, ok := want.(string); ok && strings.HasSuffix(path, "message.content") {
+		want = []interface{}{map[string]interface{}{"type": "text", "text": text}}
+	}
+
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return path
+		}
+		for name, value := range w {
+			if missing := missingField(value, g[name], path+"."+name); missing != "" {
+				return missing
+			}
+		}
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(w) {
+			return path
+		}
+		for i := range w {
+			if missing := missingField(w[i], g[i], fmt.Sprintf("%s[%d]", path, i)); missing != "" {
+				return missing
+			}
+		}
+	default:
+		if want != got {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,351 @@
+// Package streamjson decodes the stream-json output of the Claude CLI
+// (--output-format stream-json) into typed messages. Fields the types do not
+// know about are kept in each value's Extra map instead of being dropped, and are
+// written out again when the value is encoded.
+package streamjson
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Message types on the top level of the stream
+const (
+	TypeSystem      = "system"
+	TypeAssistant   = "assistant"
+	TypeUser        = "user"
+	TypeResult      = "result"
+	TypeStreamEvent = "stream_event"
+)
+
+// Content block types inside assistant and user messages
+const (
+	BlockText             = "text"
+	BlockThinking         = "thinking"
+	BlockRedactedThinking = "redacted_thinking"
+	BlockToolUse          = "tool_use"
+	BlockToolResult       = "tool_result"
+	BlockImage            = "image"
+)
+
+// Message is one line of the stream
+type Message interface {
+	Header() *Envelope
+}
+
+// Envelope holds the fields every message carries
+type Envelope struct {
+	Type      string `json:"type"`
+	Subtype   string `json:"subtype,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	UUID      string `json:"uuid,omitempty"`
+	// ParentToolUseID is the Task tool call a sub-agent message belongs to, empty on the top level
+	ParentToolUseID string `json:"parent_tool_use_id,omitempty"`
+}
+
+func (e *Envelope) Header() *Envelope {
+	return e
+}
+
+// SystemMessage reports the session setup, e.g. the "init" subtype at the start of a run
+type SystemMessage struct {
+	Envelope
+	Model             string                     `json:"model,omitempty"`
+	Cwd               string                     `json:"cwd,omitempty"`
+	Tools             []string                   `json:"tools,omitempty"`
+	MCPServers        []MCPServerStatus          `json:"mcp_servers,omitempty"`
+	PermissionMode    string                     `json:"permissionMode,omitempty"`
+	ClaudeCodeVersion string                     `json:"claude_code_version,omitempty"`
+	Extra             map[string]json.RawMessage `json:"-"`
+}
+
+// MCPServerStatus is the connection state of one MCP server
+type MCPServerStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// AssistantMessage is a complete message from the model
+type AssistantMessage struct {
+	Envelope
+	Message APIMessage                 `json:"message"`
+	Extra   map[string]json.RawMessage `json:"-"`
+}
+
+// UserMessage carries tool results back to the model, or a prompt being replayed
+type UserMessage struct {
+	Envelope
+	Message APIMessage                 `json:"message"`
+	Extra   map[string]json.RawMessage `json:"-"`
+}
+
+// ResultMessage ends a run with its outcome, cost and usage
+type ResultMessage struct {
+	Envelope
+	Result        string                     `json:"result,omitempty"`
+	IsError       bool                       `json:"is_error"`
+	TotalCostUSD  float64                    `json:"total_cost_usd"`
+	DurationMS    int                        `json:"duration_ms"`
+	DurationAPIMS int                        `json:"duration_api_ms"`
+	NumTurns      int                        `json:"num_turns"`
+	Usage         Usage                      `json:"usage"`
+	Extra         map[string]json.RawMessage `json:"-"`
+}
+
+// StreamEvent wraps a partial message event, sent with --include-partial-messages
+type StreamEvent struct {
+	Envelope
+	Event PartialEvent               `json:"event"`
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// BlockMessage is a content block sent on its own line by older CLI versions
+type BlockMessage struct {
+	Envelope
+	Block ContentBlock
+}
+
+// UnknownMessage is a message type this package does not know; all its fields are in Extra
+type UnknownMessage struct {
+	Envelope
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// APIMessage is the model API message inside assistant and user messages
+type APIMessage struct {
+	ID         string                     `json:"id,omitempty"`
+	Type       string                     `json:"type,omitempty"`
+	Role       string                     `json:"role"`
+	Model      string                     `json:"model,omitempty"`
+	Content    Content                    `json:"content"`
+	StopReason string                     `json:"stop_reason,omitempty"`
+	Usage      *Usage                     `json:"usage,omitempty"`
+	Extra      map[string]json.RawMessage `json:"-"`
+}
+
+// Content is a message's list of content blocks. A plain string decodes as one text block.
+type Content []ContentBlock
+
+// ContentBlock is one block of message content. Which fields are set depends on Type.
+type ContentBlock struct {
+	Type string `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// thinking and redacted_thinking
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+
+	// tool_use
+	ID    string      `json:"id,omitempty"`
+	Name  string      `json:"name,omitempty"`
+	Input interface{} `json:"input,omitempty"`
+
+	// tool_result; Content is a string or a list of blocks
+	ToolUseID string      `json:"tool_use_id,omitempty"`
+	Content   interface{} `json:"content,omitempty"`
+	IsError   bool        `json:"is_error,omitempty"`
+
+	// image
+	Source *ImageSource `json:"source,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// ImageSource is the data or location of an image block
+type ImageSource struct {
+	Type      string                     `json:"type"`
+	MediaType string                     `json:"media_type,omitempty"`
+	Data      string                     `json:"data,omitempty"`
+	URL       string                     `json:"url,omitempty"`
+	Extra     map[string]json.RawMessage `json:"-"`
+}
+
+// Usage counts the tokens of a message or a whole run
+type Usage struct {
+	InputTokens              int                        `json:"input_tokens"`
+	OutputTokens             int                        `json:"output_tokens"`
+	CacheCreationInputTokens int                        `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int                        `json:"cache_read_input_tokens"`
+	ServiceTier              string                     `json:"service_tier,omitempty"`
+	Extra                    map[string]json.RawMessage `json:"-"`
+}
+
+// PartialEvent is a streaming event of the model API, e.g. content_block_delta
+type PartialEvent struct {
+	Type         string                     `json:"type"`
+	Index        int                        `json:"index"`
+	Message      *APIMessage                `json:"message,omitempty"`
+	ContentBlock *ContentBlock              `json:"content_block,omitempty"`
+	Delta        *Delta                     `json:"delta,omitempty"`
+	Usage        *Usage                     `json:"usage,omitempty"`
+	Extra        map[string]json.RawMessage `json:"-"`
+}
+
+// Delta is the incremental part of a partial event
+type Delta struct {
+	Type        string                     `json:"type,omitempty"`
+	Text        string                     `json:"text,omitempty"`
+	Thinking    string                     `json:"thinking,omitempty"`
+	Signature   string                     `json:"signature,omitempty"`
+	PartialJSON string                     `json:"partial_json,omitempty"`
+	StopReason  string                     `json:"stop_reason,omitempty"`
+	Extra       map[string]json.RawMessage `json:"-"`
+}
+
+func (m *SystemMessage) UnmarshalJSON(data []byte) error {
+	type plain SystemMessage
+	return decodeKeepingExtra(data, (*plain)(m), &m.Extra)
+}
+
+func (m SystemMessage) MarshalJSON() ([]byte, error) {
+	type plain SystemMessage
+	return encodeKeepingExtra(plain(m), m.Extra)
+}
+
+func (m *AssistantMessage) UnmarshalJSON(data []byte) error {
+	type plain AssistantMessage
+	return decodeKeepingExtra(data, (*plain)(m), &m.Extra)
+}
+
+func (m AssistantMessage) MarshalJSON() ([]byte, error) {
+	type plain AssistantMessage
+	return encodeKeepingExtra(plain(m), m.Extra)
+}
+
+func (m *UserMessage) UnmarshalJSON(data []byte) error {
+	type plain UserMessage
+	return decodeKeepingExtra(data, (*plain)(m), &m.Extra)
+}
+
+func (m UserMessage) MarshalJSON() ([]byte, error) {
+	type plain UserMessage
+	return encodeKeepingExtra(plain(m), m.Extra)
+}
+
+func (m *ResultMessage) UnmarshalJSON(data []byte) error {
+	type plain ResultMessage
+	return decodeKeepingExtra(data, (*plain)(m), &m.Extra)
+}
+
+func (m ResultMessage) MarshalJSON() ([]byte, error) {
+	type plain ResultMessage
+	return encodeKeepingExtra(plain(m), m.Extra)
+}
+
+func (m *StreamEvent) UnmarshalJSON(data []byte) error {
+	type plain StreamEvent
+	return decodeKeepingExtra(data, (*plain)(m), &m.Extra)
+}
+
+func (m StreamEvent) MarshalJSON() ([]byte, error) {
+	type plain StreamEvent
+	return encodeKeepingExtra(plain(m), m.Extra)
+}
+
+func (m *UnknownMessage) UnmarshalJSON(data []byte) error {
+	type plain UnknownMessage
+	return decodeKeepingExtra(data, (*plain)(m), &m.Extra)
+}
+
+func (m UnknownMessage) MarshalJSON() ([]byte, error) {
+	type plain UnknownMessage
+	return encodeKeepingExtra(plain(m), m.Extra)
+}
+
+func (m *BlockMessage) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.Envelope); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &m.Block)
+}
+
+// MarshalJSON writes the block on the top level again, with the envelope's fields
+func (m BlockMessage) MarshalJSON() ([]byte, error) {
+	envelope, err := json.Marshal(m.Envelope)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(envelope, &fields); err != nil {
+		return nil, err
+	}
+	return encodeKeepingExtra(m.Block, fields)
+}
+
+func (m *APIMessage) UnmarshalJSON(data []byte) error {
+	type plain APIMessage
+	return decodeKeepingExtra(data, (*plain)(m), &m.Extra)
+}
+
+func (m APIMessage) MarshalJSON() ([]byte, error) {
+	type plain APIMessage
+	return encodeKeepingExtra(plain(m), m.Extra)
+}
+
+func (c *Content) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = Content{{Type: BlockText, Text: text}}
+		return nil
+	}
+
+	var blocks []ContentBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return fmt.Errorf("content is neither a string nor a list of blocks: %w", err)
+	}
+	*c = blocks
+	return nil
+}
+
+func (b *ContentBlock) UnmarshalJSON(data []byte) error {
+	type plain ContentBlock
+	return decodeKeepingExtra(data, (*plain)(b), &b.Extra)
+}
+
+func (b ContentBlock) MarshalJSON() ([]byte, error) {
+	type plain ContentBlock
+	return encodeKeepingExtra(plain(b), b.Extra)
+}
+
+func (s *ImageSource) UnmarshalJSON(data []byte) error {
+	type plain ImageSource
+	return decodeKeepingExtra(data, (*plain)(s), &s.Extra)
+}
+
+func (s ImageSource) MarshalJSON() ([]byte, error) {
+	type plain ImageSource
+	return encodeKeepingExtra(plain(s), s.Extra)
+}
+
+func (u *Usage) UnmarshalJSON(data []byte) error {
+	type plain Usage
+	return decodeKeepingExtra(data, (*plain)(u), &u.Extra)
+}
+
+func (u Usage) MarshalJSON() ([]byte, error) {
+	type plain Usage
+	return encodeKeepingExtra(plain(u), u.Extra)
+}
+
+func (e *PartialEvent) UnmarshalJSON(data []byte) error {
+	type plain PartialEvent
+	return decodeKeepingExtra(data, (*plain)(e), &e.Extra)
+}
+
+func (e PartialEvent) MarshalJSON() ([]byte, error) {
+	type plain PartialEvent
+	return encodeKeepingExtra(plain(e), e.Extra)
+}
+
+func (d *Delta) UnmarshalJSON(data []byte) error {
+	type plain Delta
+	return decodeKeepingExtra(data, (*plain)(d), &d.Extra)
+}
+
+func (d Delta) MarshalJSON() ([]byte, error) {
+	type plain Delta
+	return encodeKeepingExtra(plain(d), d.Extra)
+}
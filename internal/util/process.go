@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
@@ -148,6 +149,101 @@ func (pm *ProcessManager) KillProcessGroup(pid int) error {
 	return nil
 }
 
+// FindProcesses lists processes whose command line mentions one of the given program
+// names and whose working directory is inside one of dirs
+func (pm *ProcessManager) FindProcesses(names []string, dirs []string) ([]*ProcessInfo, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /proc: %w", err)
+	}
+	
+	self := os.Getpid()
+	var found []*ProcessInfo
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		
+		cmdline, err := pm.getProcessCmdline(pid)
+		if err != nil || !cmdlineMatches(cmdline, names) {
+			continue
+		}
+		
+		wd, err := pm.getProcessWorkingDir(pid)
+		if err != nil || !pathWithin(wd, dirs) {
+			continue
+		}
+		
+		info := &ProcessInfo{PID: pid, Command: cmdline[0], Args: cmdline[1:], WorkingDir: wd}
+		if status, err := pm.getProcessStatus(pid); err == nil {
+			info.Status = status
+		}
+		found = append(found, info)
+	}
+	
+	return found, nil
+}
+
+// cmdlineMatches reports whether the program or, for interpreters such as node, its script is one of names
+func cmdlineMatches(cmdline []string, names []string) bool {
+	for i := 0; i < len(cmdline) && i < 2; i++ {
+		base := filepath.Base(cmdline[i])
+		for _, name := range names {
+			if base == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pathWithin reports whether path is one of dirs or below one of them
+func pathWithin(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
+
+// SetProcessGroup makes cmd start in its own process group so it can be signalled with its children
+func (pm *ProcessManager) SetProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// SignalProcessGroup sends a signal to every process in the group led by pid
+func (pm *ProcessManager) SignalProcessGroup(pid int, sig syscall.Signal) error {
+	if err := syscall.Kill(-pid, sig); err != nil && err != syscall.ESRCH {
+		return fmt.Errorf("failed to signal process group %d: %w", pid, err)
+	}
+	return nil
+}
+
+// InterruptProcessGroup sends SIGINT to the group led by pid, waits until exited is closed
+// or the grace period passes, then SIGKILLs whatever is left of the group
+func (pm *ProcessManager) InterruptProcessGroup(pid int, exited <-chan struct{}, grace time.Duration) error {
+	if err := pm.SignalProcessGroup(pid, syscall.SIGINT); err != nil {
+		return err
+	}
+	
+	select {
+	case <-exited:
+	case <-time.After(grace):
+	}
+	
+	// Children such as dev servers may outlive the leader, so always clean up the group
+	return pm.SignalProcessGroup(pid, syscall.SIGKILL)
+}
+
 // WaitForProcessExit waits for a process to exit with a timeout
 func (pm *ProcessManager) WaitForProcessExit(cmd *exec.Cmd, timeout time.Duration) error {
 	done := make(chan error, 1)
@@ -98,9 +98,9 @@ export function ClaudeChat() {
         if (response.ok) {
           const data = await response.json()
           if (data.data && Array.isArray(data.data)) {
-            // Find the most recent TodoWrite tool use
+            // Find the most recent TodoWrite tool use of the main agent, not a sub-agent
             const todoMessages = data.data
-              .filter((msg: any) => msg.role === 'tool_use' && msg.tool_name === 'TodoWrite')
+              .filter((msg: any) => msg.role === 'tool_use' && msg.tool_name === 'TodoWrite' && !msg.parent_tool_use_id)
               .sort((a: any, b: any) => new Date(b.created_at).getTime() - new Date(a.created_at).getTime())
             
             if (todoMessages.length > 0) {
@@ -192,8 +192,8 @@ export function ClaudeChat() {
             }
 
             case 'tool_use': {
-              // Handle TodoWrite tool for task tracking
-              if (data.tool_name === 'TodoWrite') {
+              // Handle TodoWrite tool for task tracking; sub-agents keep lists of their own
+              if (data.tool_name === 'TodoWrite' && !data.parent_tool_use_id) {
                 try {
                   let toolInput = data.tool_input
                   if (typeof toolInput === 'string') {
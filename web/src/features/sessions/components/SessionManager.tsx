@@ -144,7 +144,8 @@ export function SessionManager() {
                       <div className={`w-2 h-2 rounded-full ${session.activity_status === 'streaming' ? 'bg-yellow-500 animate-pulse' :
                         session.activity_status === 'new' ? 'bg-green-500' :
                           session.activity_status === 'viewed' ? 'bg-blue-500' :
-                            'bg-gray-400'
+                            session.activity_status === 'waiting_limit' ? 'bg-orange-500' :
+                              'bg-gray-400'
                         }`} title={`Activity: ${session.activity_status}`} />
                     )}
                     <div>
@@ -12,96 +12,45 @@ interface Todo {
 export function TodoList() {
   const [todos, setTodos] = useState<Todo[]>([])
   const { currentSession } = useAppStore()
-  
-  console.log('TodoList component rendered, currentSession:', currentSession?.id)
 
-  // Load existing todos from chat history
+  // Load the current list from the server
   useEffect(() => {
     if (!currentSession) return
 
     const loadExistingTodos = async () => {
       try {
-        const response = await fetch(`/api/v1/sessions/${currentSession.id}/chat`, {
+        const response = await fetch(`/api/v1/sessions/${currentSession.id}/todos`, {
           headers: {
             'Authorization': 'Basic ' + btoa('moe:jay')
           }
         })
         if (response.ok) {
           const data = await response.json()
-          if (data.data && Array.isArray(data.data)) {
-            // Find the most recent TodoWrite tool use
-            const todoMessages = data.data
-              .filter((msg: any) => msg.role === 'tool_use' && msg.tool_name === 'TodoWrite')
-              .sort((a: any, b: any) => new Date(b.created_at).getTime() - new Date(a.created_at).getTime())
-            
-            if (todoMessages.length > 0) {
-              const latestTodos = todoMessages[0]
-              try {
-                const toolInput = typeof latestTodos.tool_input === 'string' 
-                  ? JSON.parse(latestTodos.tool_input) 
-                  : latestTodos.tool_input
-                if (toolInput?.todos && Array.isArray(toolInput.todos)) {
-                  console.log('Loaded existing todos from chat history:', toolInput.todos)
-                  setTodos(toolInput.todos)
-                }
-              } catch (error) {
-                console.error('Failed to parse existing todos:', error)
-              }
-            }
+          if (data.data && Array.isArray(data.data.todos)) {
+            setTodos(data.data.todos)
           }
         }
       } catch (error) {
-        console.error('Failed to load chat history for todos:', error)
+        console.error('Failed to load todos:', error)
       }
     }
 
     loadExistingTodos()
   }, [currentSession?.id])
 
-  // Listen for real-time TodoWrite tool calls - separate effect to avoid re-registration issues
+  // Listen for task list updates - separate effect to avoid re-registration issues
   useEffect(() => {
-    const handleClaudeOutput = (message: any) => {
-      console.log('TodoList received claude_output:', message)
-      
-      // Check if this message is for any session (not just current)
-      if (message.data) {
-        const data = message.data
-        console.log('TodoList checking message - session_id:', data.session_id, 'content_type:', data.content_type, 'tool_name:', data.tool_name)
-        
-        // Only process if it's for the current session
-        if (data.session_id === currentSession?.id) {
-          if (data.content_type === 'tool_use' && data.tool_name === 'TodoWrite') {
-            console.log('TodoWrite detected! Tool input:', data.tool_input)
-            try {
-              let toolInput = data.tool_input
-              
-              // If tool_input is a string, try to parse it
-              if (typeof toolInput === 'string') {
-                console.log('Parsing tool_input string:', toolInput)
-                toolInput = JSON.parse(toolInput)
-              }
-              
-              // Check if toolInput.todos exists and is an array
-              if (toolInput && toolInput.todos && Array.isArray(toolInput.todos)) {
-                console.log('Updating todos from WebSocket:', toolInput.todos)
-                setTodos(toolInput.todos)
-              } else {
-                console.warn('TodoWrite tool_input missing todos array:', toolInput)
-              }
-            } catch (error) {
-              console.error('Failed to parse todo list from WebSocket:', error)
-            }
-          }
-        }
+    const handleTodosUpdated = (message: any) => {
+      // Only process if it's for the current session
+      if (message.data && message.data.session_id === currentSession?.id && Array.isArray(message.data.todos)) {
+        setTodos(message.data.todos)
       }
     }
 
-    console.log('TodoList registering WebSocket handler')
-    wsClient.on('claude_output', handleClaudeOutput)
+    wsClient.on('todos_updated', handleTodosUpdated)
 
     return () => {
-      console.log('TodoList unregistering WebSocket handler')
-      wsClient.off('claude_output', handleClaudeOutput)
+      wsClient.off('todos_updated', handleTodosUpdated)
     }
   }, [currentSession?.id])
 
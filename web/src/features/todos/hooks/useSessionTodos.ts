@@ -23,37 +23,20 @@ export function useSessionTodos(sessionId?: number) {
     setTodos(cachedTodos)
     updateInProgressTask(cachedTodos)
 
-    // Load from API
+    // Load the current list from the server
     const loadTodos = async () => {
       try {
-        const response = await fetch(`/api/v1/sessions/${sessionId}/chat`, {
+        const response = await fetch(`/api/v1/sessions/${sessionId}/todos`, {
           headers: {
             'Authorization': 'Basic ' + btoa('moe:jay')
           }
         })
         if (response.ok) {
           const data = await response.json()
-          if (data.data && Array.isArray(data.data)) {
-            // Find the most recent TodoWrite tool use
-            const todoMessages = data.data
-              .filter((msg: any) => msg.role === 'tool_use' && msg.tool_name === 'TodoWrite')
-              .sort((a: any, b: any) => new Date(b.created_at).getTime() - new Date(a.created_at).getTime())
-            
-            if (todoMessages.length > 0) {
-              const latestTodos = todoMessages[0]
-              try {
-                const toolInput = typeof latestTodos.tool_input === 'string' 
-                  ? JSON.parse(latestTodos.tool_input) 
-                  : latestTodos.tool_input
-                if (toolInput?.todos && Array.isArray(toolInput.todos)) {
-                  sessionTodos.set(sessionId, toolInput.todos)
-                  setTodos(toolInput.todos)
-                  updateInProgressTask(toolInput.todos)
-                }
-              } catch (error) {
-                console.error('Failed to parse todos:', error)
-              }
-            }
+          if (data.data && Array.isArray(data.data.todos)) {
+            sessionTodos.set(sessionId, data.data.todos)
+            setTodos(data.data.todos)
+            updateInProgressTask(data.data.todos)
           }
         }
       } catch (error) {
@@ -66,35 +49,24 @@ export function useSessionTodos(sessionId?: number) {
 
   // Listen for real-time updates
   useEffect(() => {
-    const handleClaudeOutput = (message: any) => {
-      if (message.data && message.data.content_type === 'tool_use' && message.data.tool_name === 'TodoWrite') {
+    const handleTodosUpdated = (message: any) => {
+      if (message.data && Array.isArray(message.data.todos)) {
         const msgSessionId = message.data.session_id
-        
-        try {
-          let toolInput = message.data.tool_input
-          if (typeof toolInput === 'string') {
-            toolInput = JSON.parse(toolInput)
-          }
-          
-          if (toolInput?.todos && Array.isArray(toolInput.todos)) {
-            // Update cache for this session
-            sessionTodos.set(msgSessionId, toolInput.todos)
-            
-            // Update state if it's the current session
-            if (msgSessionId === sessionId) {
-              setTodos(toolInput.todos)
-              updateInProgressTask(toolInput.todos)
-            }
-          }
-        } catch (error) {
-          console.error('Failed to parse todo update:', error)
+
+        // Update cache for this session
+        sessionTodos.set(msgSessionId, message.data.todos)
+
+        // Update state if it's the current session
+        if (msgSessionId === sessionId) {
+          setTodos(message.data.todos)
+          updateInProgressTask(message.data.todos)
         }
       }
     }
 
-    wsClient.on('claude_output', handleClaudeOutput)
+    wsClient.on('todos_updated', handleTodosUpdated)
     return () => {
-      wsClient.off('claude_output', handleClaudeOutput)
+      wsClient.off('todos_updated', handleTodosUpdated)
     }
   }, [sessionId])
 
@@ -39,7 +39,7 @@ export const SessionSchema = z.object({
   created_at: z.string(),
   last_used_at: z.string(),
   last_activity_at: z.string().nullable().optional(),
-  activity_status: z.enum(['idle', 'streaming', 'new', 'viewed']).nullable().optional(),
+  activity_status: z.enum(['idle', 'streaming', 'new', 'viewed', 'waiting_limit']).nullable().optional(),
   last_viewed_at: z.string().nullable().optional(),
 })
 
@@ -37,7 +37,7 @@ export interface Session {
   created_at: string
   last_used_at: string
   last_activity_at?: string
-  activity_status?: 'idle' | 'streaming' | 'new' | 'viewed'
+  activity_status?: 'idle' | 'streaming' | 'new' | 'viewed' | 'waiting_limit'
   last_viewed_at?: string
 }
 